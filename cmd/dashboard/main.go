@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -47,6 +49,26 @@ func main() {
 	}
 	defer db.Close()
 
+	// Payloads encrypted at rest are decrypted only for requests bearing the
+	// API token.
+	access := payloadAccess{token: cfg.Server.APIToken}
+	if cfg.Encryption.KeyFile != "" {
+		keys, err := flow.NewKeyFile(cfg.Encryption.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+		if access.token == "" {
+			log.Printf("Encryption keys loaded but server.api_token is not set: payloads stay encrypted")
+		}
+		access.keys = keys
+	}
+
+	// Production mode skips schema migration; the client is used read-only.
+	client, err := flow.NewClient(db, flow.FlowConfig{IsProduction: true, Encryption: access.keys})
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+
 	fs := http.FileServer(http.Dir("./cmd/dashboard/static"))
 	http.Handle("/", fs)
 
@@ -90,7 +112,7 @@ func main() {
 			argIdx++
 		}
 		if search != "" {
-			where += fmt.Sprintf(" AND (name ILIKE $%d OR identifier ILIKE $%d OR service ILIKE $%d)", argIdx, argIdx, argIdx)
+			where += fmt.Sprintf(" AND (name ILIKE $%d OR identifier ILIKE $%d OR service ILIKE $%d OR EXISTS (SELECT 1 FROM flow_identifiers fi WHERE fi.flow_id = flows.id AND fi.value ILIKE $%d))", argIdx, argIdx, argIdx, argIdx)
 			args = append(args, "%"+search+"%")
 			argIdx++
 		}
@@ -167,7 +189,19 @@ func main() {
 
 		// /api/flows/:id/compare
 		if len(parts) >= 5 && parts[4] == "compare" {
-			handleCompare(db, w, idStr)
+			if !access.require(w, r) {
+				return
+			}
+			handleCompare(db, w, r, access, idStr)
+			return
+		}
+
+		// /api/flows/:id/drift
+		if len(parts) >= 5 && parts[4] == "drift" {
+			if !access.require(w, r) {
+				return
+			}
+			handleDrift(client, w, r, idStr)
 			return
 		}
 
@@ -203,26 +237,47 @@ func main() {
 			flowInfo.UpdatedAt = updatedAt.Time
 		}
 
+		if iRows, err := db.Query("SELECT kind, value FROM flow_identifiers WHERE flow_id = $1 ORDER BY id ASC", flowID); err == nil {
+			for iRows.Next() {
+				var fi flow.FlowIdentifier
+				if iRows.Scan(&fi.Kind, &fi.Value) == nil {
+					flowInfo.Aliases = append(flowInfo.Aliases, fi)
+				}
+			}
+			iRows.Close()
+		}
+
 		var timeline []TimelineEvent = []TimelineEvent{}
 
 		pRows, err := db.Query(
-			"SELECT id, description, expected, service_name, schema, timeout, created_at FROM points WHERE flow_id = $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
+			"SELECT id, description, expected, service_name, schema, timeout, compare, validator, expressions, content_type, raw, created_at FROM points WHERE flow_id = $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
 			flowID, limit, offset,
 		)
 		if err == nil {
 			defer pRows.Close()
 			for pRows.Next() {
 				var p flow.Point
-				var exp, schema []byte
+				var exp, schema, cmp, exprs []byte
 				var timeoutMs sql.NullInt64
-				pRows.Scan(&p.ID, &p.Description, &exp, &p.ServiceName, &schema, &timeoutMs, &p.CreatedAt)
+				var validator, contentType sql.NullString
+				pRows.Scan(&p.ID, &p.Description, &exp, &p.ServiceName, &schema, &timeoutMs, &cmp, &validator, &exprs, &contentType, &p.Raw, &p.CreatedAt)
 				p.FlowID = flowID
+				p.Validator = validator.String
+				p.ContentType = contentType.String
+				p.Raw = access.open(r, p.Raw)
 				if exp != nil {
-					p.Expected = json.RawMessage(exp)
+					p.Expected = access.open(r, exp)
 				}
 				if schema != nil {
 					p.Schema = json.RawMessage(schema)
 				}
+				if cmp != nil {
+					p.Compare = &flow.CompareOptions{}
+					json.Unmarshal(cmp, p.Compare)
+				}
+				if exprs != nil {
+					json.Unmarshal(exprs, &p.Expressions)
+				}
 				if timeoutMs.Valid {
 					d := time.Duration(timeoutMs.Int64) * time.Millisecond
 					p.Timeout = &d
@@ -232,7 +287,7 @@ func main() {
 		}
 
 		aRows, err := db.Query(
-			"SELECT id, actual, service_name, processed_at, created_at FROM assertions WHERE flow_id = $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
+			"SELECT id, actual, service_name, processed_at, content_type, raw, created_at FROM assertions WHERE flow_id = $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
 			flowID, limit, offset,
 		)
 		if err == nil {
@@ -241,10 +296,13 @@ func main() {
 				var a flow.Assertion
 				var act []byte
 				var processedAt sql.NullTime
-				aRows.Scan(&a.ID, &act, &a.ServiceName, &processedAt, &a.CreatedAt)
+				var contentType sql.NullString
+				aRows.Scan(&a.ID, &act, &a.ServiceName, &processedAt, &contentType, &a.Raw, &a.CreatedAt)
 				a.FlowID = flowID
+				a.ContentType = contentType.String
+				a.Raw = access.open(r, a.Raw)
 				if act != nil {
-					a.Actual = json.RawMessage(act)
+					a.Actual = access.open(r, act)
 				}
 				if processedAt.Valid {
 					a.ProcessedAt = &processedAt.Time
@@ -272,12 +330,36 @@ func main() {
 		json.NewEncoder(w).Encode(response)
 	})
 
+	// ───── GET /api/schemas?flow=<name>&enum=<n> ─────
+	http.HandleFunc("/api/schemas", func(w http.ResponseWriter, r *http.Request) {
+		enableCors(w)
+		flowName := r.URL.Query().Get("flow")
+		if flowName == "" {
+			http.Error(w, "flow is required", 400)
+			return
+		}
+		enum, _ := strconv.Atoi(r.URL.Query().Get("enum"))
+		if !access.require(w, r) {
+			return
+		}
+
+		schemas, err := client.InferSchemas(r.Context(), flowName, flow.EnumThreshold(enum))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"flow":    flowName,
+			"schemas": schemas,
+		})
+	})
+
 	fmt.Printf("Dashboard running at http://localhost:%d\n", cfg.Server.Port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.Port), nil))
 }
 
 // handleCompare runs multi-diff comparison for a flow and returns results.
-func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
+func handleCompare(db *sql.DB, w http.ResponseWriter, r *http.Request, access payloadAccess, idStr string) {
 	flowID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid ID", 400)
@@ -285,7 +367,7 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 	}
 
 	// Fetch all points
-	pRows, err := db.Query("SELECT id, description, expected FROM points WHERE flow_id = $1 ORDER BY id ASC", flowID)
+	pRows, err := db.Query("SELECT id, description, expected, compare, validator, expressions FROM points WHERE flow_id = $1 ORDER BY id ASC", flowID)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -296,17 +378,31 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 		ID          int64
 		Description string
 		Expected    json.RawMessage
+		Compare     flow.CompareOptions
+		Validator   string
+		Expressions []string
 	}
 	for pRows.Next() {
 		var p struct {
 			ID          int64
 			Description string
 			Expected    json.RawMessage
+			Compare     flow.CompareOptions
+			Validator   string
+			Expressions []string
 		}
-		var exp []byte
-		pRows.Scan(&p.ID, &p.Description, &exp)
+		var exp, cmp, exprs []byte
+		var validator sql.NullString
+		pRows.Scan(&p.ID, &p.Description, &exp, &cmp, &validator, &exprs)
+		p.Validator = validator.String
 		if exp != nil {
-			p.Expected = json.RawMessage(exp)
+			p.Expected = access.open(r, exp)
+		}
+		if cmp != nil {
+			json.Unmarshal(cmp, &p.Compare)
+		}
+		if exprs != nil {
+			json.Unmarshal(exprs, &p.Expressions)
 		}
 		points = append(points, p)
 	}
@@ -331,7 +427,7 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 		var act []byte
 		aRows.Scan(&a.ID, &act)
 		if act != nil {
-			a.Actual = json.RawMessage(act)
+			a.Actual = access.open(r, act)
 		}
 		assertions = append(assertions, a)
 	}
@@ -343,9 +439,12 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 		Description string           `json:"description"`
 		Match       bool             `json:"match"`
 		Diffs       []flow.DiffEntry `json:"diffs,omitempty"`
+		Patch       []flow.PatchOp   `json:"patch,omitempty"`
+		Unified     string           `json:"unified,omitempty"`
 		Expected    json.RawMessage  `json:"expected,omitempty"`
 		Actual      json.RawMessage  `json:"actual,omitempty"`
 		Status      string           `json:"status"`
+		Validator   string           `json:"validator,omitempty"`
 	}
 
 	var results []CompareResult
@@ -376,9 +475,36 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 			r.Description = points[i].Description
 			r.Expected = points[i].Expected
 			r.Actual = assertions[i].Actual
-			diffs, equal := flow.DeepCompare(points[i].Expected, assertions[i].Actual)
+			if points[i].Validator != "" {
+				// Custom validators run in the services' Finish, not here.
+				r.Validator = points[i].Validator
+				r.Status = "validator"
+				results = append(results, r)
+				continue
+			}
+			if len(points[i].Expressions) > 0 {
+				r.Diffs = flow.EvaluateExpressions(points[i].Expressions, points[i].Expected, assertions[i].Actual)
+				r.Diffs = flow.ClassifyDiffs(points[i].Compare, r.Diffs)
+				errs, _ := flow.SplitDiffs(r.Diffs)
+				r.Match = len(errs) == 0
+				r.Status = "mismatch"
+				if r.Match {
+					r.Status = "match"
+				}
+				results = append(results, r)
+				continue
+			}
+			diffs, equal := flow.DeepCompareWithOptions(points[i].Expected, assertions[i].Actual, points[i].Compare)
 			r.Match = equal
 			r.Diffs = diffs
+			if len(diffs) > 0 {
+				r.Patch, _ = flow.JSONPatchWithOptions(points[i].Expected, assertions[i].Actual, points[i].Compare)
+				unified, err := flow.UnifiedDiff(points[i].Expected, assertions[i].Actual, false)
+				if flow.IsDiffTooLarge(err) {
+					unified = "@@ documents too large to diff line by line; see the diffs and patch @@"
+				}
+				r.Unified = unified
+			}
 			if equal {
 				r.Status = "match"
 			} else {
@@ -388,26 +514,108 @@ func handleCompare(db *sql.DB, w http.ResponseWriter, idStr string) {
 		results = append(results, r)
 	}
 
-	matchCount := 0
+	matchCount, warningCount, unverifiedCount := 0, 0, 0
 	for _, r := range results {
 		if r.Match {
 			matchCount++
 		}
+		if r.Status == "validator" {
+			unverifiedCount++
+		}
+		_, warnings := flow.SplitDiffs(r.Diffs)
+		warningCount += len(warnings)
 	}
 
 	response := map[string]interface{}{
 		"results":       results,
 		"total":         len(results),
 		"matches":       matchCount,
-		"mismatches":    len(results) - matchCount,
-		"success":       matchCount == len(results),
+		"mismatches":    len(results) - matchCount - unverifiedCount,
+		"unverified":    unverifiedCount,
+		"warnings":      warningCount,
+		"success":       matchCount+unverifiedCount == len(results),
 		"total_points":  len(points),
 		"total_asserts": len(assertions),
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleDrift compares the shape of a flow with a baseline run (?baseline=<id>)
+// or with recent runs of the same flow name (?window=<n>).
+func handleDrift(client *flow.FlowClient, w http.ResponseWriter, r *http.Request, idStr string) {
+	flowID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", 400)
+		return
+	}
+
+	var opts []flow.DriftOption
+	if baseline, err := strconv.ParseInt(r.URL.Query().Get("baseline"), 10, 64); err == nil {
+		opts = append(opts, flow.AgainstRun(baseline))
+	}
+	if window, err := strconv.Atoi(r.URL.Query().Get("window")); err == nil {
+		opts = append(opts, flow.AgainstRecent(window))
+	}
+
+	report, err := client.DetectDrift(r.Context(), flowID, opts...)
+	if err != nil {
+		var cfgErr *flow.ConfigError
+		switch {
+		case errors.As(err, &cfgErr):
+			http.Error(w, err.Error(), 400)
+		case flow.IsNotFound(err):
+			http.Error(w, err.Error(), 404)
+		case flow.IsNoBaseline(err):
+			// The first runs of a flow name have nothing to drift from.
+			json.NewEncoder(w).Encode(map[string]interface{}{"flow_id": flowID, "findings": []flow.DriftFinding{}, "no_baseline": true})
+		default:
+			http.Error(w, err.Error(), 500)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
 func enableCors(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 }
+
+// payloadAccess opens stored payloads, decrypting them only for requests
+// bearing the API token.
+type payloadAccess struct {
+	keys  flow.KeyProvider
+	token string
+}
+
+func (pa payloadAccess) authorized(r *http.Request) bool {
+	if pa.keys == nil {
+		return true // nothing to decrypt
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && pa.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(pa.token)) == 1
+}
+
+// require answers 401 to unauthorized requests for endpoints that only make
+// sense on decrypted payloads.
+func (pa payloadAccess) require(w http.ResponseWriter, r *http.Request) bool {
+	if pa.authorized(r) {
+		return true
+	}
+	http.Error(w, "payloads are encrypted: API token required", http.StatusUnauthorized)
+	return false
+}
+
+// open decrypts and decompresses a stored payload, keeping the stored bytes
+// when it cannot be opened for r.
+func (pa payloadAccess) open(r *http.Request, stored []byte) json.RawMessage {
+	var keys flow.KeyProvider
+	if pa.authorized(r) {
+		keys = pa.keys
+	}
+	doc, err := flow.DecryptPayload(r.Context(), keys, stored)
+	if err != nil {
+		return json.RawMessage(stored)
+	}
+	return doc
+}
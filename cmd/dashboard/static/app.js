@@ -16,6 +16,25 @@ let timelineTotalPages = 1;
 let timelineLoading = false;
 
 let allExpanded = false;
+let timelineCompare = [];
+let lastInferredSchemas = null;
+let timelineDrift = [];
+
+// API token for decrypting payloads encrypted at rest: open the dashboard once
+// with ?token=<server.api_token> and it is kept in this browser.
+const TOKEN_KEY = 'flowApiToken';
+(() => {
+    const params = new URLSearchParams(location.search);
+    if (!params.has('token')) return;
+    localStorage.setItem(TOKEN_KEY, params.get('token'));
+    params.delete('token');
+    history.replaceState(null, '', location.pathname + (params.toString() ? `?${params}` : ''));
+})();
+
+function apiFetch(url) {
+    const token = localStorage.getItem(TOKEN_KEY);
+    return fetch(url, token ? { headers: { Authorization: `Bearer ${token}` } } : undefined);
+}
 
 // ───── Init ─────
 document.addEventListener('DOMContentLoaded', () => {
@@ -201,6 +220,9 @@ async function selectFlow(flow, el) {
     document.getElementById('emptyState').classList.add('hidden');
     document.getElementById('detailView').classList.remove('hidden');
     document.getElementById('comparePanel').classList.add('hidden');
+    document.getElementById('schemaPanel').classList.add('hidden');
+    document.getElementById('driftPanel').classList.add('hidden');
+    document.getElementById('detailDrift').classList.add('hidden');
 
     // Header
     document.getElementById('detailTitle').textContent = flow.name;
@@ -210,6 +232,8 @@ async function selectFlow(flow, el) {
     if (flow.identifier) { identEl.textContent = flow.identifier; identEl.classList.remove('hidden'); }
     else { identEl.classList.add('hidden'); }
 
+    document.getElementById('detailAliases').innerHTML = '';
+
     const svcEl = document.getElementById('detailService');
     if (flow.service) { svcEl.textContent = flow.service; svcEl.classList.remove('hidden'); }
     else { svcEl.classList.add('hidden'); }
@@ -237,7 +261,14 @@ async function loadMoreTimeline(reset = false) {
     const container = document.getElementById('timelineContainer');
 
     try {
-        const res = await fetch(`${API_BASE}/flows/${currentFlowId}?page=${timelinePage}&limit=${timelineLimit}`);
+        // Server-side comparison applies the rules stored with each point
+        if (reset) {
+            timelineCompare = await fetchCompareResults(currentFlowId);
+            timelineDrift = await fetchDrift(currentFlowId);
+            renderDriftBadge();
+        }
+
+        const res = await apiFetch(`${API_BASE}/flows/${currentFlowId}?page=${timelinePage}&limit=${timelineLimit}`);
         const response = await res.json();
 
         timelineTotalPages = response.meta.pages;
@@ -247,6 +278,7 @@ async function loadMoreTimeline(reset = false) {
         document.getElementById('summaryAssertions').textContent = `${response.meta.total_assertions} assertions`;
 
         if (response.flow) {
+            renderAliases(response.flow.aliases || []);
             const created = new Date(response.flow.created_at);
             const updated = response.flow.updated_at ? new Date(response.flow.updated_at) : created;
             const diff = updated - created;
@@ -263,6 +295,79 @@ async function loadMoreTimeline(reset = false) {
     }
 }
 
+function renderAliases(aliases) {
+    document.getElementById('detailAliases').innerHTML = aliases
+        .map(a => `<span class="badge badge-identifier" title="${a.kind}">${a.kind}: ${a.value}</span>`)
+        .join('');
+}
+
+async function fetchCompareResults(flowId) {
+    try {
+        const res = await apiFetch(`${API_BASE}/flows/${flowId}/compare`);
+        const data = await res.json();
+        return data.results || [];
+    } catch (e) {
+        console.error('Compare error:', e);
+        return [];
+    }
+}
+
+// Drift findings of the flow against recent runs of the same flow name.
+async function fetchDrift(flowId) {
+    try {
+        const res = await apiFetch(`${API_BASE}/flows/${flowId}/drift`);
+        if (!res.ok) return [];
+        const data = await res.json();
+        return data.findings || [];
+    } catch (e) {
+        console.error('Drift error:', e);
+        return [];
+    }
+}
+
+function renderDriftBadge() {
+    const el = document.getElementById('detailDrift');
+    const errors = timelineDrift.filter(f => f.severity !== 'warning').length;
+    if (timelineDrift.length === 0) { el.classList.add('hidden'); return; }
+    el.textContent = `⚠ ${timelineDrift.length} drift`;
+    el.title = `${errors} breaking, ${timelineDrift.length - errors} additive change(s) vs recent runs`;
+    el.classList.toggle('badge-drift-warning', errors === 0);
+    el.classList.remove('hidden');
+}
+
+// Findings for a point; repeated descriptions are keyed "description #2".
+function driftFor(description) {
+    return timelineDrift.filter(f => f.point === description || (f.point || '').startsWith(description + ' #'));
+}
+
+function renderDriftFindings(findings, style = '') {
+    if (findings.length === 0) return '';
+    return `
+        <div class="diff-highlights drift-findings" style="${style}">
+            <div class="diff-highlight-header">⚠ ${findings.length} drift finding${findings.length > 1 ? 's' : ''} vs recent runs</div>
+            ${findings.map(f => `
+                <div class="diff-highlight-item ${f.severity === 'warning' ? 'drift-additive' : ''}" title="${escapeHtml(f.message)}">
+                    <span class="dh-path">${escapeHtml(f.point ? `${f.point}${f.side ? ' · ' + f.side : ''}` : f.side || '')} ${escapeHtml(f.path || '')}</span>
+                    <span class="dh-kind">${f.kind}</span>
+                    <span class="dh-expected">${escapeHtml(f.baseline || '∅')}</span>
+                    <span class="dh-arrow">→</span>
+                    <span class="dh-actual">${escapeHtml(f.current || '∅')}</span>
+                </div>
+            `).join('')}
+        </div>
+    `;
+}
+
+function showDrift() {
+    document.getElementById('driftPanel').classList.remove('hidden');
+    document.getElementById('driftResults').innerHTML = renderDriftFindings(timelineDrift, 'margin:16px')
+        || '<div style="padding:20px;text-align:center;color:var(--text-muted)">No drift against recent runs</div>';
+}
+
+function closeDrift() {
+    document.getElementById('driftPanel').classList.add('hidden');
+}
+
 // ───── Render Timeline ─────
 function renderTimeline(events, container, meta, reset) {
     if (reset && (!events || events.length === 0)) {
@@ -293,28 +398,18 @@ function renderTimeline(events, container, meta, reset) {
                 Waiting for assertion...
             </div>`;
         } else {
-            const diffs = deepCompare(p.data.expected, a.data.actual);
-            const isMatch = diffs.length === 0;
+            const cmp = timelineCompare[groupIndex - 1];
+            const diffs = p.data.validator ? []
+                : cmp && cmp.point_id === p.data.id && cmp.assertion_id === a.data.id
+                ? (cmp.diffs || [])
+                : p.data.expressions ? []
+                : deepCompare(p.data.expected, a.data.actual);
+            const isMatch = !diffs.some(isFailingDiff);
             const matchClass = isMatch ? 'match-success' : 'match-fail';
             const icon = isMatch ? '✓' : '✕';
             rowStatusClass = isMatch ? 'row-success' : 'row-fail';
 
-            let diffHtml = '';
-            if (!isMatch) {
-                diffHtml = `
-                    <div class="diff-highlights">
-                        <div class="diff-highlight-header">⚠ ${diffs.length} difference${diffs.length > 1 ? 's' : ''} found</div>
-                        ${diffs.map(d => `
-                            <div class="diff-highlight-item">
-                                <span class="dh-path">${d.path}</span>
-                                <span class="dh-expected">${formatValue(d.expected)}</span>
-                                <span class="dh-arrow">→</span>
-                                <span class="dh-actual">${formatValue(d.actual)}</span>
-                            </div>
-                        `).join('')}
-                    </div>
-                `;
-            }
+            const diffHtml = renderDiffHighlights(diffs);
 
             const aService = a.data.service_name || 'Unknown';
             const processedAt = a.data.processed_at ? `<span class="timestamp">Processed: ${new Date(a.data.processed_at).toLocaleTimeString()}</span>` : '';
@@ -323,7 +418,7 @@ function renderTimeline(events, container, meta, reset) {
                 <div class="assertion-container ${matchClass}">
                     <div class="assertion-header">
                         <div class="check-icon">${icon}</div>
-                        <span>${isMatch ? 'Contract Match' : 'Contract Violation'}</span>
+                        <span>${p.data.validator ? `Validator "${escapeHtml(p.data.validator)}" (checked on Finish)` : isMatch ? 'Contract Match' : 'Contract Violation'}</span>
                         <span class="service-tag" style="margin-left:auto">${aService}</span>
                         <span class="timestamp">${new Date(a.timestamp).toLocaleTimeString()}</span>
                         ${processedAt}
@@ -331,11 +426,11 @@ function renderTimeline(events, container, meta, reset) {
                     <div class="comparison-grid">
                         <div class="grid-col">
                             <h4>Expected <span>(Contract)</span></h4>
-                            <div class="code-block">${syntaxHighlight(p.data.expected)}</div>
+                            <div class="code-block">${renderPayload(p.data.expected, p.data)}</div>
                         </div>
                         <div class="grid-col">
                             <h4>Actual <span>(Reality)</span></h4>
-                            <div class="code-block diff">${syntaxHighlight(a.data.actual)}</div>
+                            <div class="code-block diff">${renderPayload(a.data.actual, a.data)}</div>
                         </div>
                     </div>
                     ${diffHtml}
@@ -346,6 +441,11 @@ function renderTimeline(events, container, meta, reset) {
         // Meta tags
         const schemaTag = hasSchema ? '<span class="schema-tag">schema</span>' : '';
         const timeoutTag = timeout ? `<span class="timeout-tag">${formatTimeout(timeout)}s</span>` : '';
+        const validatorTag = p.data.validator ? `<span class="schema-tag" title="Checked by a custom validator on Finish">validator: ${escapeHtml(p.data.validator)}</span>` : '';
+        const drift = driftFor(p.data.description);
+        const driftTag = drift.length ? `<span class="drift-tag" title="${escapeHtml(drift.map(f => f.message).join('\n'))}">drift ${drift.length}</span>` : '';
+        const exprTag = p.data.expressions ? `<span class="schema-tag" title="${escapeHtml(p.data.expressions.join('\n'))}">expr ${p.data.expressions.length}</span>` : '';
+        const rulesTag = p.data.compare ? `<span class="schema-tag" title="${escapeHtml(JSON.stringify(p.data.compare))}">rules</span>` : '';
 
         el.innerHTML = `
             <div class="timeline-track">
@@ -362,6 +462,10 @@ function renderTimeline(events, container, meta, reset) {
                             <span class="label-pill pill-point">POINT</span>
                             ${schemaTag}
                             ${timeoutTag}
+                            ${rulesTag}
+                            ${validatorTag}
+                            ${exprTag}
+                            ${driftTag}
                         </div>
                         <div class="point-meta-row">
                             <span class="service-tag">${service}</span>
@@ -371,6 +475,7 @@ function renderTimeline(events, container, meta, reset) {
                     </div>
                 </div>
                 <div class="waterfall-content">
+                    ${renderDriftFindings(drift, 'margin:0 0 14px')}
                     ${assertionHtml}
                 </div>
             </div>
@@ -390,7 +495,7 @@ function renderTimeline(events, container, meta, reset) {
                     <span class="service-tag">${o.data.service_name || 'Unknown'}</span>
                     <span class="timestamp">${new Date(o.timestamp).toLocaleTimeString()}</span>
                 </div>
-                <div class="code-block">${syntaxHighlight(o.data.actual)}</div>
+                <div class="code-block">${renderPayload(o.data.actual, o.data)}</div>
             `;
             container.appendChild(el);
         });
@@ -407,7 +512,7 @@ async function runCompare() {
     results.innerHTML = '<div style="padding:20px;text-align:center;color:var(--text-muted)">Running comparison...</div>';
 
     try {
-        const res = await fetch(`${API_BASE}/flows/${currentFlowId}/compare`);
+        const res = await apiFetch(`${API_BASE}/flows/${currentFlowId}/compare`);
         const data = await res.json();
         renderCompareResults(data);
     } catch (e) {
@@ -430,6 +535,9 @@ function renderCompareResults(data) {
             <div class="compare-summary-item" style="color:var(--danger)">
                 <strong>${data.mismatches}</strong> ✕ Mismatch
             </div>
+            <div class="compare-summary-item" style="color:var(--warning)">
+                <strong>${data.warnings || 0}</strong> ⚠ Warnings
+            </div>
             <div class="compare-summary-item" style="color:var(--accent)">
                 <strong>${data.total_points}</strong> Points
             </div>
@@ -443,26 +551,12 @@ function renderCompareResults(data) {
         let statusIcon = '', statusLabel = '', cardClass = '';
         if (item.status === 'match') { statusIcon = '✓'; statusLabel = 'Match'; cardClass = 'diff-match'; }
         else if (item.status === 'mismatch') { statusIcon = '✕'; statusLabel = 'Mismatch'; cardClass = 'diff-mismatch'; }
+        else if (item.status === 'validator') { statusIcon = '◇'; statusLabel = `Checked by validator "${item.validator}" on Finish`; cardClass = 'diff-missing'; }
         else if (item.status === 'missing_assertion') { statusIcon = '?'; statusLabel = 'Missing Assertion'; cardClass = 'diff-missing'; }
         else { statusIcon = '⚠'; statusLabel = 'Orphan'; cardClass = 'diff-missing'; }
 
-        // Diff entries (for mismatches)
-        let diffsHtml = '';
-        if (item.diffs && item.diffs.length > 0) {
-            diffsHtml = `
-                <div class="diff-highlights" style="margin:12px 16px 0">
-                    <div class="diff-highlight-header">⚠ ${item.diffs.length} difference${item.diffs.length > 1 ? 's' : ''} found</div>
-                    ${item.diffs.map(d => `
-                        <div class="diff-highlight-item">
-                            <span class="dh-path">${d.path}</span>
-                            <span class="dh-expected">${formatValue(d.expected)}</span>
-                            <span class="dh-arrow">→</span>
-                            <span class="dh-actual">${formatValue(d.actual)}</span>
-                        </div>
-                    `).join('')}
-                </div>
-            `;
-        }
+        // Diff entries (for mismatches and warnings)
+        const diffsHtml = renderDiffHighlights(item.diffs || [], 'margin:12px 16px 0') + renderDiffFormats(item);
 
         // Expected/Actual comparison grid (always shown)
         let comparisonHtml = '';
@@ -482,6 +576,7 @@ function renderCompareResults(data) {
                     <div class="diff-status">
                         <div class="diff-status-icon">${statusIcon}</div>
                         <span>#${item.index + 1} ${item.description}</span>
+                        ${item.status === 'validator' ? `<span class="schema-tag">${escapeHtml(statusLabel)}</span>` : ''}
                     </div>
                     <span class="expand-icon">▼</span>
                 </div>
@@ -496,10 +591,117 @@ function renderCompareResults(data) {
     results.innerHTML = summaryHtml + cardsHtml;
 }
 
+// Diffs with severity "warning" or "info" do not fail the comparison.
+function isFailingDiff(d) {
+    return d.severity !== 'warning' && d.severity !== 'info';
+}
+
+// Renders failing diffs, warnings and infos as separate blocks.
+function renderDiffHighlights(diffs, style = '') {
+    const block = (list, cls, label) => list.length === 0 ? '' : `
+        <div class="diff-highlights ${cls}" style="${style}">
+            <div class="diff-highlight-header">⚠ ${list.length} ${label}${list.length > 1 ? 's' : ''} found</div>
+            ${list.map(d => `
+                <div class="diff-highlight-item" title="${escapeHtml(d.message || '')}">
+                    <span class="dh-path">${d.path}</span>
+                    ${d.kind ? `<span class="dh-kind">${d.kind}</span>` : ''}
+                    <span class="dh-expected">${formatValue(d.expected)}</span>
+                    <span class="dh-arrow">→</span>
+                    <span class="dh-actual">${formatValue(d.actual)}</span>
+                </div>
+            `).join('')}
+        </div>
+    `;
+    const errors = diffs.filter(isFailingDiff);
+    const warnings = diffs.filter(d => d.severity === 'warning');
+    const infos = diffs.filter(d => d.severity === 'info');
+    return block(errors, '', 'difference') + block(warnings, 'diff-warnings', 'warning')
+        + block(infos, 'diff-infos', 'note');
+}
+
+// Renders the unified diff and the RFC 6902 patch returned by the compare endpoint.
+function renderDiffFormats(item) {
+    if (!item.unified && !(item.patch && item.patch.length)) return '';
+    const unified = (item.unified || '').split('\n').map(line => {
+        let cls = '';
+        if (line.startsWith('@@')) cls = 'ud-hunk';
+        else if (line.startsWith('+')) cls = 'ud-add';
+        else if (line.startsWith('-')) cls = 'ud-del';
+        return `<div class="${cls}">${escapeHtml(line) || '&nbsp;'}</div>`;
+    }).join('');
+    return `
+        <div class="comparison-grid" style="padding:16px">
+            <div class="grid-col"><h4>Unified Diff</h4><div class="code-block unified-diff">${unified}</div></div>
+            <div class="grid-col"><h4>JSON Patch <span>(RFC 6902)</span></h4><div class="code-block">${syntaxHighlight(item.patch || [])}</div></div>
+        </div>
+    `;
+}
+
 function closeCompare() {
     document.getElementById('comparePanel').classList.add('hidden');
 }
 
+// ───── Inferred Schemas ─────
+async function runInferSchemas() {
+    if (!currentFlow) return;
+    const panel = document.getElementById('schemaPanel');
+    const results = document.getElementById('schemaResults');
+
+    panel.classList.remove('hidden');
+    results.innerHTML = '<div style="padding:20px;text-align:center;color:var(--text-muted)">Inferring schemas...</div>';
+
+    try {
+        const res = await apiFetch(`${API_BASE}/schemas?flow=${encodeURIComponent(currentFlow.name)}&enum=10`);
+        const data = await res.json();
+        renderInferredSchemas(data);
+    } catch (e) {
+        results.innerHTML = '<div style="padding:20px;text-align:center;color:var(--danger)">Failed to infer schemas</div>';
+    }
+}
+
+function renderInferredSchemas(data) {
+    const schemas = data.schemas || [];
+    const exportBtn = schemas.length === 0 ? '' : `
+        <div class="compare-summary">
+            <div class="compare-summary-item" style="color:var(--text-bright)">
+                <strong>${schemas.length}</strong> Point descriptions
+            </div>
+            <button class="action-btn" onclick="exportSchemas()">Export contract</button>
+        </div>
+    `;
+    const cards = schemas.map(s => `
+        <div class="diff-card diff-match">
+            <div class="diff-card-header" onclick="this.parentElement.classList.toggle('open')">
+                <div class="diff-status">
+                    <span>${escapeHtml(s.description)}</span>
+                    <span class="schema-tag">${s.samples} sample${s.samples > 1 ? 's' : ''}</span>
+                </div>
+                <span class="expand-icon">▼</span>
+            </div>
+            <div class="diff-details">
+                <div class="code-block" style="margin:16px">${syntaxHighlight(s.schema)}</div>
+            </div>
+        </div>
+    `).join('');
+    document.getElementById('schemaResults').innerHTML = exportBtn + cards;
+    lastInferredSchemas = data;
+}
+
+// Downloads the inferred schemas as a contract document.
+function exportSchemas() {
+    if (!lastInferredSchemas) return;
+    const blob = new Blob([JSON.stringify(lastInferredSchemas, null, 2)], { type: 'application/json' });
+    const a = document.createElement('a');
+    a.href = URL.createObjectURL(blob);
+    a.download = `${lastInferredSchemas.flow.replace(/[^a-z0-9]+/gi, '_')}.schemas.json`;
+    a.click();
+    URL.revokeObjectURL(a.href);
+}
+
+function closeSchemas() {
+    document.getElementById('schemaPanel').classList.add('hidden');
+}
+
 // ───── Toggle ─────
 function toggleGroup(header) {
     header.parentElement.classList.toggle('open');
@@ -519,6 +721,12 @@ function toggleAllGroups() {
 // ───── Deep Compare (frontend) ─────
 function deepCompare(expected, actual, path = '$') {
     let diffs = [];
+    if (isMatcher(expected)) {
+        if (!matchValue(expected, actual)) {
+            diffs.push({ path, expected: describeMatcher(expected), actual, message: `${path}: ${actual} does not match ${describeMatcher(expected)}` });
+        }
+        return diffs;
+    }
     if (expected === actual) return diffs;
     if (expected === null || expected === undefined) {
         if (actual !== null && actual !== undefined) diffs.push({ path, expected, actual, message: `${path}: expected null, got ${actual}` });
@@ -561,7 +769,47 @@ function deepCompare(expected, actual, path = '$') {
     return diffs;
 }
 
+// ───── Matchers ($flow_matcher placeholders) ─────
+const MATCHER_KEY = '$flow_matcher';
+
+function isMatcher(v) {
+    return v !== null && typeof v === 'object' && !Array.isArray(v) && typeof v[MATCHER_KEY] === 'string';
+}
+
+function describeMatcher(m) {
+    const bound = v => (v === undefined || v === null ? '*' : v);
+    switch (m[MATCHER_KEY]) {
+        case 'regex': return `regex(${m.pattern})`;
+        case 'between': return `between(${bound(m.min)}, ${bound(m.max)})`;
+        case 'timestamp': return m.layout ? `timestamp(${m.layout})` : 'timestamp()';
+        case 'string': return 'anyString()';
+        case 'number': return 'anyNumber()';
+        default: return `${m[MATCHER_KEY]}()`;
+    }
+}
+
+// Approximates the Go matchers; the server result takes precedence when available.
+function matchValue(m, actual) {
+    switch (m[MATCHER_KEY]) {
+        case 'any': return actual !== undefined;
+        case 'string': return typeof actual === 'string';
+        case 'number': return typeof actual === 'number';
+        case 'regex':
+            try { return typeof actual === 'string' && new RegExp(m.pattern).test(actual); } catch (e) { return false; }
+        case 'between':
+            return typeof actual === 'number'
+                && (m.min === undefined || actual >= m.min)
+                && (m.max === undefined || actual <= m.max);
+        case 'timestamp': return typeof actual === 'string' && (m.layout ? true : !isNaN(Date.parse(actual)));
+        default: return false;
+    }
+}
+
 // ───── Helpers ─────
+function escapeHtml(str) {
+    return String(str).replace(/&/g, '&amp;').replace(/"/g, '&quot;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+}
+
 function truncate(str, len) {
     return str.length > len ? str.substring(0, len) + '…' : str;
 }
@@ -589,11 +837,29 @@ function formatDate(d) {
     return d.toLocaleString(undefined, { month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit' });
 }
 
+// Renders a payload in its original encoding when it was recorded with a
+// codec other than JSON (raw is base64 in the API), otherwise as JSON.
+function renderPayload(doc, item) {
+    if (doc && doc.$flow_payload === 'encrypted') {
+        return `<span class="encrypted-tag">encrypted · key ${escapeHtml(doc.key)}</span><pre>Payload is encrypted at rest. Open the dashboard with ?token=… to decrypt it.</pre>`;
+    }
+    if (!item.content_type || !item.raw) return syntaxHighlight(doc);
+    const bytes = atob(item.raw);
+    const tag = `<span class="content-type-tag">${escapeHtml(item.content_type)}</span>`;
+    if (item.content_type.startsWith('application/octet-stream')) {
+        const hex = Array.from(bytes.slice(0, 512), c => c.charCodeAt(0).toString(16).padStart(2, '0')).join(' ');
+        return `${tag}<pre>${hex}${bytes.length > 512 ? ` … (${bytes.length} bytes)` : ''}</pre>`;
+    }
+    const text = new TextDecoder().decode(Uint8Array.from(bytes, c => c.charCodeAt(0)));
+    return `${tag}<pre>${escapeHtml(text)}</pre>`;
+}
+
 function syntaxHighlight(obj) {
-    const json = JSON.stringify(obj, null, 2);
+    const json = JSON.stringify(obj, (k, v) => (isMatcher(v) ? `‹${describeMatcher(v)}›` : v), 2);
     if (!json) return '';
     return json
         .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;')
+        .replace(/"‹([^›]*)›"/g, '<span class="matcher-value">‹$1›</span>')
         .replace(/"([^"]+)":/g, '<span style="color:#7dd3fc">"$1"</span>:')
         .replace(/: "([^"]*)"/g, ': <span style="color:#86efac">"$1"</span>')
         .replace(/: (\d+\.?\d*)/g, ': <span style="color:#fbbf24">$1</span>')
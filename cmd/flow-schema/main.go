@@ -0,0 +1,69 @@
+// Command flow-schema infers JSON Schemas from the points recorded for a flow
+// and prints them as a contract document.
+//
+//	go run ./cmd/flow-schema -flow "Order Processing" -enum 10 > order.schemas.json
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"flow-tool/pkg/config"
+	"flow-tool/pkg/flow"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	flowName := flag.String("flow", "", "flow name to infer schemas for (required)")
+	enum := flag.Int("enum", 0, "turn string fields with at most this many distinct values into enums")
+	configPath := flag.String("config", "flow.config.yaml", "path to the configuration file")
+	flag.Parse()
+
+	if *flowName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := sql.Open("postgres", cfg.GetConnString())
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	// Payloads encrypted at rest need the key file to be read.
+	var keys flow.KeyProvider
+	if cfg.Encryption.KeyFile != "" {
+		if keys, err = flow.NewKeyFile(cfg.Encryption.KeyFile); err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+	}
+
+	// Production mode skips schema migration: this command only reads.
+	client, err := flow.NewClient(db, flow.FlowConfig{IsProduction: true, Encryption: keys})
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+
+	schemas, err := client.InferSchemas(context.Background(), *flowName, flow.EnumThreshold(*enum))
+	if err != nil {
+		log.Fatalf("Failed to infer schemas: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{"flow": *flowName, "schemas": schemas}); err != nil {
+		log.Fatalf("Failed to write schemas: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Inferred %d schemas for %q\n", len(schemas), *flowName)
+}
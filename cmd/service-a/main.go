@@ -88,6 +88,11 @@ func main() {
 	checkErr(err)
 
 	fmt.Printf("Service A completed. Flow '%s' is ready for Service B.\n", orderID)
+
+	// Propagate the exact flow identity, as an HTTP header or message attribute would.
+	carrier := flow.MapCarrier{}
+	flow.Inject(f.Context(ctx), carrier)
+	fmt.Printf("Run Service B with: make run-b FLOW='%s'\n", carrier.Get(flow.BaggageKey))
 }
 
 func checkErr(err error) {
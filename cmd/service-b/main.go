@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"flow-tool/pkg/flow"
@@ -29,31 +30,24 @@ func main() {
 		log.Fatalf("Failed to create client: %v", err)
 	}
 
-	// Discover the most recent active flow (simulates receiving the order ID from a queue/API)
-	var flowName string
-	var identifier sql.NullString
-	err = db.QueryRow("SELECT name, identifier FROM flows WHERE status = 'ACTIVE' ORDER BY created_at DESC LIMIT 1").Scan(&flowName, &identifier)
-	if err != nil {
-		// No active flow — check if the flow hit its execution limit (zero overhead path)
-		flowName = "Order Processing"
-		ctx := context.Background()
-		f, getErr := client.GetFlow(ctx, flowName)
-		if getErr != nil {
-			log.Fatalf("No active flow found to process. Run Service A first!")
-		}
-		// GetFlow returned a SKIPPED_LIMIT instance — nothing to do
-		info := f.GetFlowInfo()
-		fmt.Printf("⚠ Flow '%s' reached execution limit (status: %s). Nothing to process.\n", flowName, info.Status)
-		return
-	}
-
 	ctx := context.Background()
 
-	fmt.Printf("Retrieving flow '%s' (ID: %s)...\n", flowName, identifier.String)
-	f, err := client.GetFlow(ctx, flowName, identifier.String)
-	if err != nil {
-		log.Fatalf("Failed to get flow: %v", err)
+	var f flow.FlowExecutor
+	if len(os.Args) > 1 {
+		// Flow identity propagated by Service A (simulates an HTTP header or message attribute)
+		inst, err := client.Resume(ctx, flow.MapCarrier{flow.BaggageKey: os.Args[1]})
+		if err != nil {
+			log.Fatalf("Failed to resume propagated flow: %v", err)
+		}
+		f = inst
+	} else {
+		inst, ok := discoverFlow(ctx, db, client)
+		if !ok {
+			return
+		}
+		f = inst
 	}
+	flowName := f.GetFlowInfo().Name
 
 	// Check if flow was skipped due to limit
 	info := f.GetFlowInfo()
@@ -123,3 +117,30 @@ func main() {
 		}
 	}
 }
+
+// discoverFlow falls back to the most recent active flow when no flow identity
+// was propagated. It is only reliable when a single flow runs at a time.
+func discoverFlow(ctx context.Context, db *sql.DB, client *flow.FlowClient) (flow.FlowExecutor, bool) {
+	var flowName string
+	var identifier sql.NullString
+	err := db.QueryRow("SELECT name, identifier FROM flows WHERE status = 'ACTIVE' ORDER BY created_at DESC LIMIT 1").Scan(&flowName, &identifier)
+	if err != nil {
+		// No active flow — check if the flow hit its execution limit (zero overhead path)
+		flowName = "Order Processing"
+		f, getErr := client.GetFlow(ctx, flowName)
+		if getErr != nil {
+			log.Fatalf("No active flow found to process. Run Service A first!")
+		}
+		// GetFlow returned a SKIPPED_LIMIT instance — nothing to do
+		info := f.GetFlowInfo()
+		fmt.Printf("⚠ Flow '%s' reached execution limit (status: %s). Nothing to process.\n", flowName, info.Status)
+		return nil, false
+	}
+
+	fmt.Printf("Retrieving flow '%s' (ID: %s)...\n", flowName, identifier.String)
+	f, err := client.GetFlow(ctx, flowName, identifier.String)
+	if err != nil {
+		log.Fatalf("Failed to get flow: %v", err)
+	}
+	return f, true
+}
@@ -64,14 +64,14 @@ func main() {
 	checkErr(err)
 
 	// Create point with schema validation
-	orderSchema := []byte(`{
+	riskSchema := []byte(`{
 		"type": "object",
 		"properties": {
-			"status": {"type": "string"},
-			"total": {"type": "number"},
-			"customer_id": {"type": "string"}
+			"risk_score": {"type": "number", "minimum": 0, "maximum": 1},
+			"approved": {"type": "boolean"},
+			"source": {"type": "string"}
 		},
-		"required": ["status", "total", "customer_id"]
+		"required": ["risk_score", "approved", "source"]
 	}`)
 	
 	fmt.Println("-> [2] Risk Check Passed")
@@ -79,7 +79,7 @@ func main() {
 		"risk_score": 0.05,
 		"approved":   true,
 		"source":     "internal-ai",
-	}, flow.WithSchema(orderSchema))
+	}, flow.WithSchema(riskSchema))
 	checkErr(err)
 
 	// Add more points
@@ -110,6 +110,7 @@ func main() {
 		WithServiceName("Enhanced Logistics Service").
 		WithProductionMode(false).
 		WithMaxExecutions(100).
+		WithSchemaValidation(true).
 		Build()
 	if err != nil {
 		log.Fatalf("Failed to create Service B client: %v", err)
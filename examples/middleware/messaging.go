@@ -5,52 +5,48 @@ import (
 	"fmt"
 
 	"flow-tool/pkg/flow"
+	"flow-tool/pkg/flow/flowmsg"
 )
 
-type Message struct {
-	ID      string
-	Payload map[string]interface{}
-}
-
-type Handler func(ctx context.Context, msg Message) error
-
-func FlowMiddleware(flowClient *flow.FlowClient, next Handler) Handler {
-	return func(ctx context.Context, msg Message) error {
-		flowID := msg.ID
-
-		fmt.Printf("[Middleware] Creating assertion for Flow: %s\n", flowID)
-
-		f, err := flowClient.GetFlow(ctx, flowID)
-		if err == nil {
-			f.AddAssertion(ctx, msg.Payload)
-		} else {
-			fmt.Printf("[Middleware] Warning: Flow %s not found\n", flowID)
-		}
-
-		return next(ctx, msg)
-	}
-}
-
 func main() {
 	var flowClient *flow.FlowClient = nil
 
-	myBusinessHandler := func(ctx context.Context, msg Message) error {
-		fmt.Printf(">> Processing Business Logic for: %v\n", msg.Payload)
+	myBusinessHandler := func(ctx context.Context, msg *flowmsg.Message) error {
+		fmt.Printf(">> Processing Business Logic for: %s\n", msg.Payload)
 		return nil
 	}
 
-	decoratedHandler := FlowMiddleware(flowClient, myBusinessHandler)
-
-	msg := Message{
-		ID: "ORD-123",
-		Payload: map[string]interface{}{
-			"amount": 100,
-			"status": "paid",
-		},
+	// The consumer resumes the flow propagated in the message headers and
+	// records the payload as an assertion before running the business logic.
+	decoratedHandler := flowmsg.WrapHandler(flowClient, myBusinessHandler,
+		flowmsg.WithErrorHandler(func(_ context.Context, msg *flowmsg.Message, err error) error {
+			fmt.Printf("[Middleware] Warning: message %s not recorded: %v\n", msg.ID, err)
+			return nil
+		}),
+	)
+
+	// The producer injects the flow into the headers and records the payload as a point.
+	publisher := flowmsg.WrapPublisher(flowClient, flowmsg.PublisherFunc(func(ctx context.Context, msg *flowmsg.Message) error {
+		// Stand-in for a broker: deliver straight to the consumer.
+		return decoratedHandler(context.Background(), msg)
+	}))
+
+	msg := &flowmsg.Message{
+		ID:      "MSG-1",
+		Topic:   "orders.paid",
+		Payload: []byte(`{"amount":100,"status":"paid"}`),
 	}
 
 	if flowClient != nil {
-		decoratedHandler(context.Background(), msg)
+		ctx := context.Background()
+		f, err := flowClient.Start(ctx, "Order Processing", "ORD-123")
+		if err != nil {
+			fmt.Printf("Error starting flow: %v\n", err)
+			return
+		}
+		if err := publisher.Publish(f.Context(ctx), msg); err != nil {
+			fmt.Printf("Error publishing: %v\n", err)
+		}
 	} else {
 		fmt.Println("Mock setup complete. Connect DB to run.")
 	}
@@ -4,4 +4,4 @@ go 1.24.2
 
 require github.com/lib/pq v1.11.1
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
@@ -1,3 +1,4 @@
+DROP TABLE IF EXISTS flow_identifiers;
 DROP TABLE IF EXISTS assertions;
 DROP TABLE IF EXISTS points;
 DROP TABLE IF EXISTS flows;
@@ -22,6 +23,11 @@ CREATE TABLE points (
     service_name VARCHAR(255),
     schema JSONB,
     timeout BIGINT,
+    compare JSONB,
+    validator VARCHAR(100),
+    expressions JSONB,
+    content_type VARCHAR(100),
+    raw BYTEA,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -31,10 +37,22 @@ CREATE TABLE assertions (
     actual JSONB,
     service_name VARCHAR(255),
     processed_at TIMESTAMP,
+    content_type VARCHAR(100),
+    raw BYTEA,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE flow_identifiers (
+    id BIGSERIAL PRIMARY KEY,
+    flow_id BIGINT REFERENCES flows(id) ON DELETE CASCADE,
+    kind VARCHAR(100) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (flow_id, kind, value)
+);
+
 CREATE INDEX idx_points_flow_id ON points(flow_id);
 CREATE INDEX idx_assertions_flow_id ON assertions(flow_id);
 CREATE INDEX idx_flows_name_status ON flows(name, status);
 CREATE INDEX idx_flows_identifier ON flows(identifier);
+CREATE INDEX idx_flow_identifiers_value ON flow_identifiers(value);
@@ -8,8 +8,9 @@ import (
 )
 
 type Config struct {
-	DB     DBConfig     `yaml:"db"`
-	Server ServerConfig `yaml:"server"`
+	DB         DBConfig         `yaml:"db"`
+	Server     ServerConfig     `yaml:"server"`
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
 
 type DBConfig struct {
@@ -22,6 +23,12 @@ type DBConfig struct {
 
 type ServerConfig struct {
 	Port int `yaml:"port"`
+	// APIToken authorizes dashboard requests to decrypt payloads.
+	APIToken string `yaml:"api_token"`
+}
+
+type EncryptionConfig struct {
+	KeyFile string `yaml:"key_file"`
 }
 
 func LoadConfig(path string) (*Config, error) {
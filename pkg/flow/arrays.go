@@ -0,0 +1,336 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type compiledArrayRule struct {
+	pattern pathPattern
+	mode    string
+	key     string
+}
+
+func compileArrayRules(rules []ArrayRule) []compiledArrayRule {
+	out := make([]compiledArrayRule, 0, len(rules))
+	for _, r := range rules {
+		if segs, err := parsePath(r.Path); err == nil {
+			out = append(out, compiledArrayRule{pattern: segs, mode: r.Mode, key: r.Key})
+		}
+	}
+	return out
+}
+
+// arrayRule returns the last rule matching segs; ordered when none does.
+func (c *comparer) arrayRule(segs []pathSegment) compiledArrayRule {
+	for i := len(c.arrays) - 1; i >= 0; i-- {
+		if c.arrays[i].pattern.matches(segs) {
+			return c.arrays[i]
+		}
+	}
+	return compiledArrayRule{mode: ArrayOrdered}
+}
+
+// equalAt reports whether expected and actual compare equal at path (warnings
+// allowed) without recording their diffs.
+func (c *comparer) equalAt(expected, actual interface{}, path string, segs []pathSegment) bool {
+	saved := c.diffs
+	c.diffs = nil
+	c.collectDiffs(expected, actual, path, segs)
+	errs, _ := SplitDiffs(c.diffs)
+	c.diffs = saved
+	equal := len(errs) == 0
+	return equal
+}
+
+func elemPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func elemSegs(segs []pathSegment, i int) []pathSegment {
+	return childPath(segs, pathSegment{kind: segIndex, index: i})
+}
+
+func (c *comparer) missingElem(path string, segs []pathSegment, i int, v interface{}, detail string) {
+	c.add(elemSegs(segs, i), DiffEntry{
+		Path:     elemPath(path, i),
+		Kind:     DiffMissingElement,
+		Expected: v,
+		Message:  fmt.Sprintf("path %s: %selement missing in actual", elemPath(path, i), detail),
+	})
+}
+
+func (c *comparer) extraElem(path string, segs []pathSegment, j int, v interface{}, detail string) {
+	c.add(elemSegs(segs, j), DiffEntry{
+		Path:    elemPath(path, j),
+		Kind:    DiffExtraElement,
+		Actual:  v,
+		Message: fmt.Sprintf("path %s: %sunexpected element in actual", elemPath(path, j), detail),
+	})
+}
+
+// equalMatrix records which expected elements equal which actual elements,
+// row by row in one slice.
+type equalMatrix struct {
+	cols  int
+	cells []bool
+}
+
+func (m equalMatrix) at(i, j int) bool {
+	return m.cells[i*m.cols+j]
+}
+
+// tooLargeToPair reports arrays whose element pairs exceed maxDiffCells as
+// invalid, so that unordered and aligned modes, which compare every pair,
+// cannot exhaust memory or time.
+func (c *comparer) tooLargeToPair(s1, s2 []interface{}, path string, segs []pathSegment, mode string) bool {
+	if int64(len(s1)+1)*int64(len(s2)+1) <= maxDiffCells {
+		return false
+	}
+	c.add(segs, DiffEntry{
+		Path:    path,
+		Kind:    DiffInvalid,
+		Message: fmt.Sprintf("path %s: %d expected and %d actual elements are too many to compare in %s mode", path, len(s1), len(s2), mode),
+	})
+	return true
+}
+
+// equalities compares every expected element with every actual element.
+func (c *comparer) equalities(s1, s2 []interface{}, path string, segs []pathSegment) equalMatrix {
+	eq := equalMatrix{cols: len(s2), cells: make([]bool, len(s1)*len(s2))}
+	for i := range s1 {
+		for j := range s2 {
+			eq.cells[i*eq.cols+j] = c.equalAt(s1[i], s2[j], elemPath(path, i), elemSegs(segs, i))
+		}
+	}
+	return eq
+}
+
+// compareUnordered ignores element order. As a set, any number of equal
+// elements satisfy each other; as a multiset, each actual element is used once.
+func (c *comparer) compareUnordered(s1, s2 []interface{}, path string, segs []pathSegment, multiset bool) {
+	mode := ArraySet
+	if multiset {
+		mode = ArrayMultiset
+	}
+	if c.tooLargeToPair(s1, s2, path, segs, mode) {
+		return
+	}
+	eq := c.equalities(s1, s2, path, segs)
+
+	if multiset {
+		owner := maxMatching(eq, len(s1), len(s2))
+		matched := make([]bool, len(s1))
+		for _, i := range owner {
+			if i >= 0 {
+				matched[i] = true
+			}
+		}
+		for i := range s1 {
+			if !matched[i] {
+				c.missingElem(path, segs, i, s1[i], "")
+			}
+		}
+		for j := range s2 {
+			if owner[j] < 0 {
+				c.extraElem(path, segs, j, s2[j], "")
+			}
+		}
+		return
+	}
+
+	for i := range s1 {
+		found := false
+		for j := range s2 {
+			if eq.at(i, j) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.missingElem(path, segs, i, s1[i], "")
+		}
+	}
+	for j := range s2 {
+		if !anyRow(eq, len(s1), j) {
+			c.extraElem(path, segs, j, s2[j], "")
+		}
+	}
+}
+
+// maxMatching pairs expected and actual elements, each used once, matching as
+// many as possible. Matchers and tolerances make equality non-transitive, so
+// pairing greedily can leave elements unmatched that had a partner; augmenting
+// paths re-pair earlier choices instead. It returns the expected index paired
+// with each actual element, or -1.
+func maxMatching(eq equalMatrix, rows, n int) []int {
+	owner := make([]int, n)
+	for j := range owner {
+		owner[j] = -1
+	}
+	var augment func(i int, visited []bool) bool
+	augment = func(i int, visited []bool) bool {
+		for j := 0; j < n; j++ {
+			if !eq.at(i, j) || visited[j] {
+				continue
+			}
+			visited[j] = true
+			if owner[j] < 0 || augment(owner[j], visited) {
+				owner[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < rows; i++ {
+		augment(i, make([]bool, n))
+	}
+	return owner
+}
+
+func anyRow(eq equalMatrix, rows, j int) bool {
+	for i := 0; i < rows; i++ {
+		if eq.at(i, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareByKey matches elements by the key field and compares the pairs.
+func (c *comparer) compareByKey(s1, s2 []interface{}, path string, segs []pathSegment, key string) {
+	byKey := map[string][]int{}
+	for j, v := range s2 {
+		if k, _, ok := elemKey(v, key); ok {
+			byKey[k] = append(byKey[k], j)
+		}
+	}
+
+	used := make([]bool, len(s2))
+	for i, v := range s1 {
+		k, label, ok := elemKey(v, key)
+		if !ok {
+			c.add(elemSegs(segs, i), DiffEntry{
+				Path:     elemPath(path, i),
+				Kind:     DiffInvalid,
+				Expected: v,
+				Message:  fmt.Sprintf("path %s: expected element has no key %q", elemPath(path, i), key),
+			})
+			continue
+		}
+		candidates := byKey[k]
+		if len(candidates) == 0 {
+			c.missingElem(path, segs, i, v, fmt.Sprintf("%s=%s ", key, label))
+			continue
+		}
+		j := candidates[0]
+		byKey[k] = candidates[1:]
+		used[j] = true
+		c.collectDiffs(v, s2[j], elemPath(path, i), elemSegs(segs, i))
+	}
+
+	for j, v := range s2 {
+		if used[j] {
+			continue
+		}
+		detail := ""
+		if _, label, ok := elemKey(v, key); ok {
+			detail = fmt.Sprintf("%s=%s ", key, label)
+		}
+		c.extraElem(path, segs, j, v, detail)
+	}
+}
+
+// elemKey returns the key field of an object element as an identity that
+// keeps values of different types apart (the string "1" is not the number 1,
+// while 1 and 1.0 are the same number), and as a label for messages. Only
+// elements without the field have no key; "" and null are keys like any other.
+func elemKey(v interface{}, key string) (id, label string, ok bool) {
+	obj, isObj := v.(map[string]interface{})
+	if !isObj {
+		return "", "", false
+	}
+	kv, ok := obj[key]
+	if !ok {
+		return "", "", false
+	}
+	b, _ := json.Marshal(kv)
+	label = string(b)
+	if s, isString := kv.(string); isString {
+		label = s
+	}
+	if n, isNumber := kv.(json.Number); isNumber {
+		if r, valid := parseNumber(n.String()); valid {
+			return "number:" + r.RatString(), label, true
+		}
+	}
+	return string(b), label, true
+}
+
+// compareAligned aligns the arrays by longest common subsequence. Within each
+// gap between aligned elements, removed and inserted elements are paired and
+// compared field by field; the rest are reported as missing or unexpected.
+func (c *comparer) compareAligned(s1, s2 []interface{}, path string, segs []pathSegment) {
+	if c.tooLargeToPair(s1, s2, path, segs, ArrayLCS) {
+		return
+	}
+	eq := c.equalities(s1, s2, path, segs)
+	n, m := len(s1), len(s2)
+
+	// lcs[i*w+j] is the LCS length of s1[i:] and s2[j:].
+	w := m + 1
+	lcs := make([]int32, (n+1)*w)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if eq.at(i, j) {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else if lcs[(i+1)*w+j] >= lcs[i*w+j+1] {
+				lcs[i*w+j] = lcs[(i+1)*w+j]
+			} else {
+				lcs[i*w+j] = lcs[i*w+j+1]
+			}
+		}
+	}
+
+	var removed, inserted []int
+	flush := func() {
+		paired := len(removed)
+		if len(inserted) < paired {
+			paired = len(inserted)
+		}
+		for k := 0; k < paired; k++ {
+			i, j := removed[k], inserted[k]
+			c.collectDiffs(s1[i], s2[j], elemPath(path, i), elemSegs(segs, i))
+		}
+		for _, i := range removed[paired:] {
+			c.missingElem(path, segs, i, s1[i], "")
+		}
+		for _, j := range inserted[paired:] {
+			c.extraElem(path, segs, j, s2[j], "")
+		}
+		removed, inserted = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case eq.at(i, j):
+			flush()
+			i++
+			j++
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			inserted = append(inserted, j)
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		removed = append(removed, i)
+	}
+	for ; j < m; j++ {
+		inserted = append(inserted, j)
+	}
+	flush()
+}
@@ -0,0 +1,178 @@
+package flow
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDeepCompareArrayModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  string
+		actual    string
+		opts      []CompareOption
+		wantDiffs []string
+	}{
+		{
+			name:      "Ordered reports length mismatch",
+			expected:  `{"tags": ["a", "b"]}`,
+			actual:    `{"tags": ["b", "a", "a"]}`,
+			wantDiffs: []string{"array length mismatch"},
+		},
+		{
+			name:     "Set ignores order and duplicates",
+			expected: `{"tags": ["a", "b"]}`,
+			actual:   `{"tags": ["b", "a", "a"]}`,
+			opts:     []CompareOption{UnorderedArrays(false, "$.tags")},
+		},
+		{
+			name:      "Multiset counts duplicates",
+			expected:  `{"tags": ["a", "b"]}`,
+			actual:    `{"tags": ["b", "a", "a"]}`,
+			opts:      []CompareOption{UnorderedArrays(true, "$.tags")},
+			wantDiffs: []string{"$.tags[2]: unexpected element"},
+		},
+		{
+			name:      "Multiset reports missing element",
+			expected:  `{"tags": ["a", "c"]}`,
+			actual:    `{"tags": ["a", "b"]}`,
+			opts:      []CompareOption{UnorderedArrays(true, "$.tags")},
+			wantDiffs: []string{"$.tags[1]: element missing", "$.tags[1]: unexpected element"},
+		},
+		{
+			name:     "Multiset re-pairs elements claimed by a matcher",
+			expected: `{"tags": [{"$flow_matcher": "string"}, "a"]}`,
+			actual:   `{"tags": ["a", "b"]}`,
+			opts:     []CompareOption{UnorderedArrays(true, "$.tags")},
+		},
+		{
+			name:     "Multiset re-pairs elements within tolerance",
+			expected: `{"totals": [10.0, 10.45]}`,
+			actual:   `{"totals": [10.3, 9.9]}`,
+			opts:     []CompareOption{UnorderedArrays(true, "$.totals"), PathTolerance("$.totals[*]", 0.5, 0)},
+		},
+		{
+			name:     "Unordered elements honour ignore paths",
+			expected: `{"items": [{"id": 1, "at": "x"}, {"id": 2, "at": "y"}]}`,
+			actual:   `{"items": [{"id": 2, "at": "q"}, {"id": 1, "at": "r"}]}`,
+			opts:     []CompareOption{UnorderedArrays(true, "$.items"), IgnorePaths("$.items[*].at")},
+		},
+		{
+			name:      "Key matching compares fields",
+			expected:  `{"items": [{"id": "A", "qty": 1}, {"id": "B", "qty": 2}]}`,
+			actual:    `{"items": [{"id": "B", "qty": 3}, {"id": "A", "qty": 1}]}`,
+			opts:      []CompareOption{ArraysByKey("id", "$.items")},
+			wantDiffs: []string{"$.items[1].qty: value mismatch"},
+		},
+		{
+			name:      "Key matching reports missing and extra keys",
+			expected:  `{"items": [{"id": "A"}, {"id": "B"}]}`,
+			actual:    `{"items": [{"id": "A"}, {"id": "C"}]}`,
+			opts:      []CompareOption{ArraysByKey("id", "$.items")},
+			wantDiffs: []string{"$.items[1]: id=B element missing", "$.items[1]: id=C unexpected element"},
+		},
+		{
+			name:      "Nested key rule with wildcard",
+			expected:  `{"orders": [{"lines": [{"sku": 1}, {"sku": 2}]}]}`,
+			actual:    `{"orders": [{"lines": [{"sku": 2}, {"sku": 1}]}]}`,
+			opts:      []CompareOption{ArraysByKey("sku", "$.orders[*].lines")},
+			wantDiffs: nil,
+		},
+		{
+			name:      "Key matching keeps key types apart",
+			expected:  `{"items": [{"id": "1", "qty": 1}, {"id": 1, "qty": 2}, {"id": "", "qty": 3}]}`,
+			actual:    `{"items": [{"id": 1.0, "qty": 2}, {"id": "", "qty": 3}, {"id": "1", "qty": 1}]}`,
+			opts:      []CompareOption{ArraysByKey("id", "$.items")},
+			wantDiffs: nil,
+		},
+		{
+			name:      "Key matching reports a string key against a number key",
+			expected:  `{"items": [{"id": "1"}]}`,
+			actual:    `{"items": [{"id": 1}]}`,
+			opts:      []CompareOption{ArraysByKey("id", "$.items")},
+			wantDiffs: []string{"$.items[0]: id=1 element missing", "$.items[0]: id=1 unexpected element"},
+		},
+		{
+			name:      "LCS reports insertion",
+			expected:  `{"steps": ["a", "b", "c"]}`,
+			actual:    `{"steps": ["a", "x", "b", "c"]}`,
+			opts:      []CompareOption{AlignedArrays("$.steps")},
+			wantDiffs: []string{"$.steps[1]: unexpected element"},
+		},
+		{
+			name:      "LCS reports removal",
+			expected:  `{"steps": ["a", "b", "c"]}`,
+			actual:    `{"steps": ["a", "c"]}`,
+			opts:      []CompareOption{AlignedArrays("$.steps")},
+			wantDiffs: []string{"$.steps[1]: element missing"},
+		},
+		{
+			name:      "LCS pairs replaced elements",
+			expected:  `{"steps": [{"n": "a"}, {"n": "b", "v": 1}, {"n": "c"}]}`,
+			actual:    `{"steps": [{"n": "a"}, {"n": "b", "v": 2}, {"n": "c"}]}`,
+			opts:      []CompareOption{AlignedArrays("$.steps")},
+			wantDiffs: []string{"$.steps[1].v: value mismatch"},
+		},
+		{
+			name:      "Ordered overrides broader rule",
+			expected:  `{"a": [1, 2], "b": [1, 2]}`,
+			actual:    `{"a": [2, 1], "b": [2, 1]}`,
+			opts:      []CompareOption{UnorderedArrays(false, "$..*"), OrderedArrays("$.b")},
+			wantDiffs: []string{"$.b[0]", "$.b[1]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare([]byte(tt.expected), []byte(tt.actual), tt.opts...)
+			if equal != (len(tt.wantDiffs) == 0) || len(diffs) != len(tt.wantDiffs) {
+				t.Fatalf("DeepCompare() = %v, want %d diffs %v", diffs, len(tt.wantDiffs), tt.wantDiffs)
+			}
+			for _, want := range tt.wantDiffs {
+				if !strings.Contains(FormatDiffs(diffs), want) {
+					t.Errorf("diffs %q should contain %q", FormatDiffs(diffs), want)
+				}
+			}
+		})
+	}
+}
+
+func TestArrayRuleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CompareOptions
+	}{
+		{"Missing key", CompareOptions{Arrays: []ArrayRule{{Path: "$.items", Mode: ArrayKey}}}},
+		{"Unknown mode", CompareOptions{Arrays: []ArrayRule{{Path: "$.items", Mode: "sorted"}}}},
+		{"Invalid path", NewCompareOptions(AlignedArrays("items"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err == nil {
+				t.Error("Validate() should fail")
+			}
+		})
+	}
+}
+
+func TestDeepCompareArraysTooLargeToPair(t *testing.T) {
+	items := func(n int) string {
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = strconv.Itoa(i)
+		}
+		return `{"items": [` + strings.Join(parts, ",") + `]}`
+	}
+	big := json.RawMessage(items(2100))
+
+	for _, opt := range []CompareOption{UnorderedArrays(true, "$.items"), AlignedArrays("$.items")} {
+		diffs, equal := DeepCompare(big, big, opt)
+		if equal || len(diffs) != 1 || diffs[0].Kind != DiffInvalid || !strings.Contains(diffs[0].Message, "too many to compare") {
+			t.Errorf("DeepCompare() = %v, %v; want one invalid diff", diffs, equal)
+		}
+	}
+	if diffs, equal := DeepCompare(big, big); !equal {
+		t.Errorf("DeepCompare() by index = %v", diffs)
+	}
+}
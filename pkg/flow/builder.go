@@ -74,6 +74,73 @@ func (b *ClientBuilder) WithConnectionPool(maxIdle, maxOpen int, maxLifetime tim
 	return b
 }
 
+// WithCorrelation registers JSONPaths that extract the identifier of flowName
+// from payloads. Several paths act as alias identifiers, tried in order.
+func (b *ClientBuilder) WithCorrelation(flowName string, paths ...string) *ClientBuilder {
+	if b.config.Correlation == nil {
+		b.config.Correlation = map[string][]string{}
+	}
+	b.config.Correlation[flowName] = append(b.config.Correlation[flowName], paths...)
+	return b
+}
+
+// WithCompareOptions sets comparison rules for every flow of this client.
+func (b *ClientBuilder) WithCompareOptions(opts ...CompareOption) *ClientBuilder {
+	b.config.CompareOptions = b.config.CompareOptions.Merge(NewCompareOptions(opts...))
+	return b
+}
+
+// WithFlowCompareOptions sets comparison rules for flows named flowName.
+func (b *ClientBuilder) WithFlowCompareOptions(flowName string, opts ...CompareOption) *ClientBuilder {
+	if b.config.FlowCompareOptions == nil {
+		b.config.FlowCompareOptions = map[string]CompareOptions{}
+	}
+	b.config.FlowCompareOptions[flowName] = b.config.FlowCompareOptions[flowName].Merge(NewCompareOptions(opts...))
+	return b
+}
+
+// WithValidator registers a validator for points created WithValidator(name).
+func (b *ClientBuilder) WithValidator(name string, v Validator) *ClientBuilder {
+	if b.config.Validators == nil {
+		b.config.Validators = map[string]Validator{}
+	}
+	b.config.Validators[name] = v
+	return b
+}
+
+// WithRedaction drops, masks or hashes personal data in payloads before
+// they are stored.
+func (b *ClientBuilder) WithRedaction(rules ...RedactionRule) *ClientBuilder {
+	b.config.Redaction = append(b.config.Redaction, rules...)
+	return b
+}
+
+// WithRedactionSalt sets the salt of hashed values.
+func (b *ClientBuilder) WithRedactionSalt(salt string) *ClientBuilder {
+	b.config.RedactionSalt = salt
+	return b
+}
+
+// WithPayloadLimit caps stored payloads at maxBytes. Larger payloads are
+// rejected, truncated or replaced by their digest, depending on policy.
+func (b *ClientBuilder) WithPayloadLimit(maxBytes int, policy string) *ClientBuilder {
+	b.config.MaxPayloadBytes = maxBytes
+	b.config.OversizePolicy = policy
+	return b
+}
+
+// WithCompression gzips payloads larger than aboveBytes before they are stored.
+func (b *ClientBuilder) WithCompression(aboveBytes int) *ClientBuilder {
+	b.config.CompressAbove = aboveBytes
+	return b
+}
+
+// WithEncryption encrypts stored payloads with the keys of provider.
+func (b *ClientBuilder) WithEncryption(provider KeyProvider) *ClientBuilder {
+	b.config.Encryption = provider
+	return b
+}
+
 func (b *ClientBuilder) WithLogger(logger Logger) *ClientBuilder {
 	b.logger = logger
 	return b
@@ -0,0 +1,303 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Content types of the built-in codecs.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeYAML = "application/yaml"
+	ContentTypeXML  = "application/xml"
+	ContentTypeRaw  = "application/octet-stream"
+)
+
+// Codec converts payloads of one content type to the JSON document model that
+// comparison, schemas and expressions work on. Points and assertions keep the
+// decoded document and, for content types other than JSON, the original bytes.
+type Codec interface {
+	ContentType() string
+	// Marshal encodes a Go value. Codecs other than JSON take []byte and
+	// string values as already encoded.
+	Marshal(v interface{}) ([]byte, error)
+	// Decode returns JSON-compatible values: maps, slices, json.Number,
+	// string, bool or nil.
+	Decode(data []byte) (interface{}, error)
+}
+
+// Built-in codecs.
+var (
+	JSONCodec Codec = jsonCodec{}
+	// YAMLCodec decodes YAML documents; timestamps become RFC 3339 strings.
+	YAMLCodec Codec = yamlCodec{}
+	// XMLCodec maps elements to objects keyed by child name, attributes to
+	// "@name" members and mixed text to "#text". Elements with text only
+	// become strings (so numbers compare as strings, see NumbersFromStrings)
+	// and repeated children become arrays.
+	XMLCodec Codec = xmlCodec{}
+	// RawCodec carries opaque bytes, compared as a base64 string.
+	RawCodec Codec = rawCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON:      JSONCodec,
+		ContentTypeYAML:      YAMLCodec,
+		"application/x-yaml": YAMLCodec,
+		"text/yaml":          YAMLCodec,
+		ContentTypeXML:       XMLCodec,
+		"text/xml":           XMLCodec,
+		ContentTypeRaw:       RawCodec,
+	}
+)
+
+// RegisterCodec makes c available under its content type, replacing any
+// codec registered for it.
+func RegisterCodec(c Codec) error {
+	if c == nil || c.ContentType() == "" {
+		return &ConfigError{msg: "codec and content type are required"}
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[mediaType(c.ContentType())] = c
+	return nil
+}
+
+// CodecFor returns the codec registered for contentType, ignoring parameters
+// such as charset. An empty content type is JSON.
+func CodecFor(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return JSONCodec, true
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[mediaType(contentType)]
+	return c, ok
+}
+
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// WithCodec encodes the expected value of this point with c instead of JSON.
+func WithCodec(c Codec) PointOption {
+	return func(p *Point) {
+		p.codec = c
+	}
+}
+
+// AssertionOption configures an assertion.
+type AssertionOption func(*Assertion)
+
+// WithAssertionCodec encodes the actual value of this assertion with c
+// instead of JSON.
+func WithAssertionCodec(c Codec) AssertionOption {
+	return func(a *Assertion) {
+		a.codec = c
+	}
+}
+
+// encodePayload returns the JSON document of v and, for codecs other than
+// JSON, its content type and encoded bytes.
+func encodePayload(c Codec, v interface{}) (doc json.RawMessage, contentType string, raw []byte, err error) {
+	if c == nil || mediaType(c.ContentType()) == ContentTypeJSON {
+		doc, err = json.Marshal(v)
+		return doc, "", nil, err
+	}
+	raw, err = c.Marshal(v)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to encode %s payload: %w", c.ContentType(), err)
+	}
+	decoded, err := c.Decode(raw)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to decode %s payload: %w", c.ContentType(), err)
+	}
+	doc, err = json.Marshal(decoded)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to convert %s payload: %w", c.ContentType(), err)
+	}
+	return doc, c.ContentType(), raw, nil
+}
+
+// encodedBytes returns v when it is already encoded.
+func encodedBytes(v interface{}) ([]byte, bool) {
+	switch val := v.(type) {
+	case []byte:
+		return val, true
+	case string:
+		return []byte(val), true
+	}
+	return nil, false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) { return decodeJSON(data) }
+
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string { return ContentTypeYAML }
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := encodedBytes(v); ok {
+		return b, nil
+	}
+	return yaml.Marshal(v)
+}
+
+func (yamlCodec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return yamlToJSON(v), nil
+}
+
+// yamlToJSON converts decoded YAML into the JSON document model.
+func yamlToJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = yamlToJSON(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = yamlToJSON(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = yamlToJSON(item)
+		}
+		return out
+	case int:
+		return json.Number(strconv.Itoa(val))
+	case int64:
+		return json.Number(strconv.FormatInt(val, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(val, 10))
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return strconv.FormatFloat(val, 'g', -1, 64)
+		}
+		return json.Number(strconv.FormatFloat(val, 'g', -1, 64))
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string { return ContentTypeXML }
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := encodedBytes(v); ok {
+		return b, nil
+	}
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Decode(data []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("no root element: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := decodeXMLElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: v}, nil
+		}
+	}
+}
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	node := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		node["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	repeated := map[string]bool{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			existing, seen := node[name]
+			switch {
+			case !seen:
+				node[name] = child
+			case repeated[name]:
+				node[name] = append(existing.([]interface{}), child)
+			default:
+				repeated[name] = true
+				node[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(node) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				node["#text"] = s
+			}
+			return node, nil
+		}
+	}
+}
+
+type rawCodec struct{}
+
+func (rawCodec) ContentType() string { return ContentTypeRaw }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := encodedBytes(v); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("raw payloads must be []byte or string, got %T", v)
+}
+
+func (rawCodec) Decode(data []byte) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString(data), nil
+}
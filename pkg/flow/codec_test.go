@@ -0,0 +1,106 @@
+package flow
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+func TestXMLCodecDecode(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<order id="ORD-1" xmlns="urn:orders">
+  <total currency="EUR">150.50</total>
+  <item><sku>A</sku></item>
+  <item><sku>B</sku></item>
+  <note/>
+</order>`
+	v, err := XMLCodec.Decode([]byte(doc))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	got, _ := json.Marshal(v)
+	want := `{"order":{"@id":"ORD-1","item":[{"sku":"A"},{"sku":"B"}],"note":"","total":{"#text":"150.50","@currency":"EUR"}}}`
+	if string(got) != want {
+		t.Errorf("Decode() = %s, want %s", got, want)
+	}
+
+	if _, err := XMLCodec.Decode([]byte("not xml")); err == nil {
+		t.Error("Decode() should fail without a root element")
+	}
+}
+
+func TestYAMLCodecDecode(t *testing.T) {
+	v, err := YAMLCodec.Decode([]byte("id: 12345678901234567\ntotal: 150.5\npaid: true\nat: 2024-05-01T10:00:00Z\ntags: [a, b]\n1: one\n"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	got, _ := json.Marshal(v)
+	want := `{"1":"one","at":"2024-05-01T10:00:00Z","id":12345678901234567,"paid":true,"tags":["a","b"],"total":150.5}`
+	if string(got) != want {
+		t.Errorf("Decode() = %s, want %s", got, want)
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	type total struct {
+		Currency string `xml:"currency,attr"`
+		Amount   string `xml:",chardata"`
+	}
+	type order struct {
+		XMLName xml.Name `xml:"order"`
+		ID      string   `xml:"id"`
+		Total   total    `xml:"total"`
+	}
+
+	expected, ct, raw, err := encodePayload(XMLCodec, order{ID: "ORD-1", Total: total{"EUR", "150.50"}})
+	if err != nil || ct != ContentTypeXML || len(raw) == 0 {
+		t.Fatalf("encodePayload(XML) = %s, %q, %q, %v", expected, ct, raw, err)
+	}
+	actual, ct, raw, err := encodePayload(YAMLCodec, "order:\n  id: ORD-1\n  total: {'@currency': EUR, '#text': 150.5}\n")
+	if err != nil || ct != ContentTypeYAML || string(raw) == "" {
+		t.Fatalf("encodePayload(YAML) = %s, %q, %v", actual, ct, err)
+	}
+	if diffs, equal := DeepCompare(expected, actual, NumbersFromStrings()); !equal {
+		t.Errorf("XML and YAML payloads should compare equal: %v", diffs)
+	}
+
+	doc, ct, raw, err := encodePayload(nil, map[string]int{"a": 1})
+	if err != nil || ct != "" || raw != nil || string(doc) != `{"a":1}` {
+		t.Errorf("encodePayload(JSON) = %s, %q, %q, %v", doc, ct, raw, err)
+	}
+
+	doc, ct, _, err = encodePayload(RawCodec, []byte{0xff, 0x00})
+	if err != nil || ct != ContentTypeRaw || string(doc) != `"/wA="` {
+		t.Errorf("encodePayload(Raw) = %s, %q, %v", doc, ct, err)
+	}
+	if _, _, _, err := encodePayload(RawCodec, 42); err == nil {
+		t.Error("encodePayload(Raw) should reject values that are not bytes")
+	}
+}
+
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string                     { return "text/csv" }
+func (csvCodec) Marshal(v interface{}) ([]byte, error)   { return []byte(v.(string)), nil }
+func (csvCodec) Decode(data []byte) (interface{}, error) { return string(data), nil }
+
+func TestCodecRegistry(t *testing.T) {
+	if c, ok := CodecFor("text/xml; charset=utf-8"); !ok || c != XMLCodec {
+		t.Errorf("CodecFor(text/xml) = %v, %v", c, ok)
+	}
+	if c, ok := CodecFor(""); !ok || c != JSONCodec {
+		t.Errorf("CodecFor(\"\") = %v, %v", c, ok)
+	}
+	if _, ok := CodecFor("text/csv"); ok {
+		t.Error("CodecFor(text/csv) should not be registered yet")
+	}
+	if err := RegisterCodec(nil); err == nil {
+		t.Error("RegisterCodec(nil) should fail")
+	}
+	if err := RegisterCodec(csvCodec{}); err != nil {
+		t.Fatalf("RegisterCodec() error = %v", err)
+	}
+	if _, ok := CodecFor("Text/CSV"); !ok {
+		t.Error("CodecFor(Text/CSV) should find the registered codec")
+	}
+}
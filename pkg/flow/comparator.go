@@ -3,30 +3,133 @@ package flow
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// DiffKind classifies a DiffEntry for tooling.
+type DiffKind string
+
+const (
+	DiffMissingKey       DiffKind = "missing_key"
+	DiffExtraKey         DiffKind = "extra_key"
+	DiffTypeMismatch     DiffKind = "type_mismatch"
+	DiffValueMismatch    DiffKind = "value_mismatch"
+	DiffLengthMismatch   DiffKind = "length_mismatch"
+	DiffMissingElement   DiffKind = "missing_element"
+	DiffExtraElement     DiffKind = "extra_element"
+	DiffMatcherMismatch  DiffKind = "matcher_mismatch"
+	DiffValidatorFailed  DiffKind = "validator_failed"
+	DiffSchemaViolation  DiffKind = "schema_violation"
+	DiffExpressionFailed DiffKind = "expression_failed"
+	DiffInvalid          DiffKind = "invalid"
+	DiffTruncated        DiffKind = "truncated"
 )
 
 type DiffEntry struct {
 	Path     string      `json:"path"`
+	Kind     DiffKind    `json:"kind,omitempty"`
 	Expected interface{} `json:"expected"`
 	Actual   interface{} `json:"actual"`
 	Message  string      `json:"message"`
+	Severity Severity    `json:"severity,omitempty"`
+
+	segs []pathSegment // parsed Path, used to build JSON Patch pointers
 }
 
-func DeepCompare(expectedJSON, actualJSON json.RawMessage) ([]DiffEntry, bool) {
-	var expected, actual interface{}
+// Severity is how a diff is reported. An empty Severity is an error no rule
+// classified, SeverityError one a severity rule set explicitly; warnings and
+// infos are reported without failing the comparison.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// IsWarning reports whether the diff is reported without failing the comparison.
+func (d DiffEntry) IsWarning() bool {
+	return d.Severity == SeverityWarning || d.Severity == SeverityInfo
+}
 
-	if err := json.Unmarshal(expectedJSON, &expected); err != nil {
-		return []DiffEntry{{Path: "$", Message: fmt.Sprintf("failed to unmarshal expected: %v", err)}}, false
+// SplitDiffs separates failing diffs from warnings and infos.
+func SplitDiffs(diffs []DiffEntry) (errs, warnings []DiffEntry) {
+	for _, d := range diffs {
+		if d.IsWarning() {
+			warnings = append(warnings, d)
+		} else {
+			errs = append(errs, d)
+		}
 	}
-	if err := json.Unmarshal(actualJSON, &actual); err != nil {
-		return []DiffEntry{{Path: "$", Message: fmt.Sprintf("failed to unmarshal actual: %v", err)}}, false
+	return errs, warnings
+}
+
+// splitInfos separates infos from warnings.
+func splitInfos(diffs []DiffEntry) (warnings, infos []DiffEntry) {
+	for _, d := range diffs {
+		if d.Severity == SeverityInfo {
+			infos = append(infos, d)
+		} else {
+			warnings = append(warnings, d)
+		}
 	}
+	return warnings, infos
+}
 
-	var diffs []DiffEntry
-	collectDiffs(expected, actual, "$", &diffs)
-	return diffs, len(diffs) == 0
+func DeepCompare(expectedJSON, actualJSON json.RawMessage, opts ...CompareOption) ([]DiffEntry, bool) {
+	return DeepCompareWithOptions(expectedJSON, actualJSON, NewCompareOptions(opts...))
+}
+
+// DeepCompareWithOptions is DeepCompare for options loaded from storage.
+func DeepCompareWithOptions(expectedJSON, actualJSON json.RawMessage, opts CompareOptions) ([]DiffEntry, bool) {
+	expected, err := decodeJSON(expectedJSON)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("failed to unmarshal expected: %v", err)}}, false
+	}
+	actual, err := decodeJSON(actualJSON)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("failed to unmarshal actual: %v", err)}}, false
+	}
+
+	if diffs, ok := compareReduced(expected, actual, opts); ok {
+		diffs = ClassifyDiffs(opts, diffs)
+		errs, _ := SplitDiffs(diffs)
+		return truncateDiffs(diffs, opts.MaxDiffs), len(errs) == 0
+	}
+
+	c, err := newComparer(opts)
+	if err != nil {
+		return []DiffEntry{invalidOptionsDiff(err)}, false
+	}
+	c.collectDiffs(c.normalizeDoc(expected, nil), c.normalizeDoc(actual, nil), "$", nil)
+	errs, _ := SplitDiffs(c.diffs)
+	return truncateDiffs(c.diffs, opts.MaxDiffs), len(errs) == 0
+}
+
+// truncateDiffs keeps the first max diffs and summarises the rest in a final
+// DiffTruncated entry, which is an error if any omitted diff was.
+func truncateDiffs(diffs []DiffEntry, max int) []DiffEntry {
+	if max <= 0 || len(diffs) <= max {
+		return diffs
+	}
+	omitted := diffs[max:]
+	errs, _ := SplitDiffs(omitted)
+	d := DiffEntry{
+		Path:    "$",
+		Kind:    DiffTruncated,
+		Message: fmt.Sprintf("%d more differences omitted", len(omitted)),
+	}
+	if len(errs) == 0 {
+		d.Severity = SeverityWarning
+	}
+	return append(diffs[:max:max], d)
 }
 
 func FormatDiffs(diffs []DiffEntry) string {
@@ -35,23 +138,174 @@ func FormatDiffs(diffs []DiffEntry) string {
 	}
 	var parts []string
 	for _, d := range diffs {
+		if d.IsWarning() {
+			parts = append(parts, string(d.Severity)+": "+d.Message)
+			continue
+		}
 		parts = append(parts, d.Message)
 	}
 	return strings.Join(parts, "; ")
 }
 
-func DeepCompareString(expectedJSON, actualJSON json.RawMessage) (string, bool) {
-	diffs, equal := DeepCompare(expectedJSON, actualJSON)
+func DeepCompareString(expectedJSON, actualJSON json.RawMessage, opts ...CompareOption) (string, bool) {
+	diffs, equal := DeepCompare(expectedJSON, actualJSON, opts...)
 	return FormatDiffs(diffs), equal
 }
 
-func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry) {
+// comparer walks two decoded documents collecting diffs under CompareOptions.
+type comparer struct {
+	opts        CompareOptions
+	ignore      []pathPattern
+	tols        []compiledTolerance
+	arrays      []compiledArrayRule
+	subsets     []compiledSubsetRule
+	normalize   []compiledNormalizeRule
+	comparators []compiledComparator
+	severities  []compiledSeverityRule
+	known       []compiledKnownDifference
+	now         time.Time
+	regexes     map[string]*regexp.Regexp
+	diffs       []DiffEntry
+}
+
+type compiledTolerance struct {
+	pattern pathPattern // nil matches every path
+	abs     float64
+	rel     float64
+}
+
+// newComparer compiles opts. Severity rules and known differences that do
+// not compile are errors, since dropping them would fail diffs they were
+// meant to downgrade (or pass diffs an error rule was meant to restore).
+func newComparer(opts CompareOptions) (*comparer, error) {
+	severities, err := compileSeverityRules(opts.Severities)
+	if err != nil {
+		return nil, err
+	}
+	known, err := compileKnownDifferences(opts.Known)
+	if err != nil {
+		return nil, err
+	}
+	c := &comparer{
+		opts:        opts,
+		ignore:      compilePatterns(opts.IgnorePaths),
+		arrays:      compileArrayRules(opts.Arrays),
+		subsets:     compileSubsetRules(opts.Subsets),
+		normalize:   compileNormalizeRules(opts.Normalize),
+		comparators: compileComparators(opts.comparators),
+		severities:  severities,
+		known:       known,
+		now:         time.Now(),
+		regexes:     map[string]*regexp.Regexp{},
+	}
+	for _, t := range opts.Tolerances {
+		ct := compiledTolerance{abs: t.Abs, rel: t.Rel}
+		if t.Path != "" {
+			segs, err := parsePath(t.Path)
+			if err != nil {
+				continue
+			}
+			ct.pattern = segs
+		}
+		c.tols = append(c.tols, ct)
+	}
+	return c, nil
+}
+
+// invalidOptionsDiff reports compare options that cannot be applied.
+func invalidOptionsDiff(err error) DiffEntry {
+	return DiffEntry{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("invalid compare options: %v", err)}
+}
+
+// tolerance returns the last rule matching segs.
+func (c *comparer) tolerance(segs []pathSegment) (compiledTolerance, bool) {
+	for i := len(c.tols) - 1; i >= 0; i-- {
+		t := c.tols[i]
+		if t.pattern == nil || t.pattern.matches(segs) {
+			return t, true
+		}
+	}
+	return compiledTolerance{}, false
+}
+
+// maxNumberExponent bounds the decimal exponent of numbers parsed exactly, so
+// a literal such as 1e999999 cannot expand into megabytes of digits.
+const maxNumberExponent = 1000
+
+// parseNumber parses a JSON or expression number as an exact rational. It
+// fails for malformed numbers and for exponents beyond maxNumberExponent.
+func parseNumber(s string) (*big.Rat, bool) {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(s[i+1:])
+		if err != nil || exp > maxNumberExponent || exp < -maxNumberExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// numbersEqual compares two JSON numbers exactly, falling back to the
+// tolerance configured for segs.
+func (c *comparer) numbersEqual(expected, actual json.Number, segs []pathSegment) bool {
+	r1, ok1 := parseNumber(expected.String())
+	r2, ok2 := parseNumber(actual.String())
+	if !ok1 || !ok2 {
+		return expected == actual
+	}
+	if r1.Cmp(r2) == 0 {
+		return true
+	}
+
+	t, ok := c.tolerance(segs)
+	if !ok {
+		return false
+	}
+	delta, _ := new(big.Rat).Sub(r1, r2).Float64()
+	delta = math.Abs(delta)
+	if delta <= t.abs {
+		return true
+	}
+	f1, _ := r1.Float64()
+	f2, _ := r2.Float64()
+	return delta <= t.rel*math.Max(math.Abs(f1), math.Abs(f2))
+}
+
+// childPath returns a copy of segs extended with seg, so sibling paths never
+// share a backing array.
+func childPath(segs []pathSegment, seg pathSegment) []pathSegment {
+	return append(segs[:len(segs):len(segs)], seg)
+}
+
+func (c *comparer) add(segs []pathSegment, d DiffEntry) {
+	if matchAny(c.ignore, segs) {
+		return
+	}
+	d.segs = segs
+	c.classify(&d, segs)
+	c.diffs = append(c.diffs, d)
+}
+
+// collectDiffs compares expected and actual at path; segs is the parsed form
+// of path used to match option patterns.
+func (c *comparer) collectDiffs(expected, actual interface{}, path string, segs []pathSegment) {
+	if matchAny(c.ignore, segs) {
+		return
+	}
+	if fn := c.comparator(segs); fn != nil {
+		c.runComparator(fn, expected, actual, path, segs)
+		return
+	}
+	if m, ok := matcherFrom(expected); ok {
+		c.matchDiff(m, actual, path, segs)
+		return
+	}
 	if expected == nil && actual == nil {
 		return
 	}
 	if expected == nil || actual == nil {
-		*diffs = append(*diffs, DiffEntry{
+		c.add(segs, DiffEntry{
 			Path:     path,
+			Kind:     DiffValueMismatch,
 			Expected: expected,
 			Actual:   actual,
 			Message:  fmt.Sprintf("path %s: expected %v, got %v", path, expected, actual),
@@ -59,12 +313,28 @@ func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry)
 		return
 	}
 
+	if n1, ok := expected.(json.Number); ok {
+		if n2, ok := actual.(json.Number); ok {
+			if !c.numbersEqual(n1, n2, segs) {
+				c.add(segs, DiffEntry{
+					Path:     path,
+					Kind:     DiffValueMismatch,
+					Expected: n1,
+					Actual:   n2,
+					Message:  fmt.Sprintf("path %s: value mismatch expected %v, got %v", path, n1, n2),
+				})
+			}
+			return
+		}
+	}
+
 	v1 := reflect.ValueOf(expected)
 	v2 := reflect.ValueOf(actual)
 
 	if v1.Type() != v2.Type() {
-		*diffs = append(*diffs, DiffEntry{
+		c.add(segs, DiffEntry{
 			Path:     path,
+			Kind:     DiffTypeMismatch,
 			Expected: expected,
 			Actual:   actual,
 			Message:  fmt.Sprintf("path %s: type mismatch expected %T, got %T", path, expected, actual),
@@ -77,35 +347,46 @@ func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry)
 		m1, ok1 := expected.(map[string]interface{})
 		m2, ok2 := actual.(map[string]interface{})
 		if !ok1 || !ok2 {
-			*diffs = append(*diffs, DiffEntry{
+			c.add(segs, DiffEntry{
 				Path:    path,
+				Kind:    DiffTypeMismatch,
 				Message: fmt.Sprintf("path %s: expected map, got %T", path, actual),
 			})
 			return
 		}
 
-		for k, val1 := range m1 {
-			val2, ok := m2[k]
-			if !ok {
-				*diffs = append(*diffs, DiffEntry{
+		// Keys are visited in sorted order so diffs are deterministic.
+		for _, k := range unionKeys(m1, m2) {
+			childSegs := childPath(segs, pathSegment{kind: segKey, key: k})
+			val1, inExpected := m1[k]
+			val2, inActual := m2[k]
+			switch {
+			case !inActual:
+				c.add(childSegs, DiffEntry{
 					Path:     path + "." + k,
+					Kind:     DiffMissingKey,
 					Expected: val1,
 					Actual:   nil,
 					Message:  fmt.Sprintf("path %s.%s: key missing in actual", path, k),
 				})
-				continue
-			}
-			collectDiffs(val1, val2, path+"."+k, diffs)
-		}
-
-		for k, val2 := range m2 {
-			if _, ok := m1[k]; !ok {
-				*diffs = append(*diffs, DiffEntry{
+			case !inExpected:
+				policy := c.extraKeys(childSegs)
+				if policy == ExtraKeysIgnore {
+					continue
+				}
+				d := DiffEntry{
 					Path:     path + "." + k,
+					Kind:     DiffExtraKey,
 					Expected: nil,
 					Actual:   val2,
 					Message:  fmt.Sprintf("path %s.%s: unexpected extra key in actual", path, k),
-				})
+				}
+				if policy == ExtraKeysWarn {
+					d.Severity = SeverityWarning
+				}
+				c.add(childSegs, d)
+			default:
+				c.collectDiffs(val1, val2, path+"."+k, childSegs)
 			}
 		}
 
@@ -113,16 +394,30 @@ func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry)
 		s1, ok1 := expected.([]interface{})
 		s2, ok2 := actual.([]interface{})
 		if !ok1 || !ok2 {
-			*diffs = append(*diffs, DiffEntry{
+			c.add(segs, DiffEntry{
 				Path:    path,
+				Kind:    DiffTypeMismatch,
 				Message: fmt.Sprintf("path %s: expected array, got %T", path, actual),
 			})
 			return
 		}
 
+		switch rule := c.arrayRule(segs); rule.mode {
+		case ArraySet, ArrayMultiset:
+			c.compareUnordered(s1, s2, path, segs, rule.mode == ArrayMultiset)
+			return
+		case ArrayKey:
+			c.compareByKey(s1, s2, path, segs, rule.key)
+			return
+		case ArrayLCS:
+			c.compareAligned(s1, s2, path, segs)
+			return
+		}
+
 		if len(s1) != len(s2) {
-			*diffs = append(*diffs, DiffEntry{
+			c.add(segs, DiffEntry{
 				Path:     path,
+				Kind:     DiffLengthMismatch,
 				Expected: len(s1),
 				Actual:   len(s2),
 				Message:  fmt.Sprintf("path %s: array length mismatch %d != %d", path, len(s1), len(s2)),
@@ -131,13 +426,14 @@ func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry)
 		}
 
 		for i := 0; i < len(s1); i++ {
-			collectDiffs(s1[i], s2[i], fmt.Sprintf("%s[%d]", path, i), diffs)
+			c.collectDiffs(s1[i], s2[i], fmt.Sprintf("%s[%d]", path, i), childPath(segs, pathSegment{kind: segIndex, index: i}))
 		}
 
 	default:
 		if !reflect.DeepEqual(expected, actual) {
-			*diffs = append(*diffs, DiffEntry{
+			c.add(segs, DiffEntry{
 				Path:     path,
+				Kind:     DiffValueMismatch,
 				Expected: expected,
 				Actual:   actual,
 				Message:  fmt.Sprintf("path %s: value mismatch expected %v, got %v", path, expected, actual),
@@ -145,3 +441,63 @@ func collectDiffs(expected, actual interface{}, path string, diffs *[]DiffEntry)
 		}
 	}
 }
+
+func (c *comparer) matchDiff(m Matcher, actual interface{}, path string, segs []pathSegment) {
+	ok, err := m.match(actual, c.regexes)
+	if err != nil {
+		c.add(segs, DiffEntry{
+			Path:     path,
+			Kind:     DiffInvalid,
+			Expected: m.String(),
+			Actual:   actual,
+			Message:  fmt.Sprintf("path %s: %v", path, err),
+		})
+		return
+	}
+	if !ok {
+		c.add(segs, DiffEntry{
+			Path:     path,
+			Kind:     DiffMatcherMismatch,
+			Expected: m.String(),
+			Actual:   actual,
+			Message:  fmt.Sprintf("path %s: value %v does not match %s", path, actual, m),
+		})
+	}
+}
+
+type compiledSubsetRule struct {
+	pattern pathPattern
+	policy  string
+}
+
+func compileSubsetRules(rules []SubsetRule) []compiledSubsetRule {
+	out := make([]compiledSubsetRule, 0, len(rules))
+	for _, r := range rules {
+		if segs, err := parsePath(r.Path); err == nil {
+			out = append(out, compiledSubsetRule{pattern: segs, policy: r.ExtraKeys})
+		}
+	}
+	return out
+}
+
+// extraKeys returns the policy for an extra key at segs: the last rule whose
+// path matches the key or one of its ancestors.
+func (c *comparer) extraKeys(segs []pathSegment) string {
+	for i := len(c.subsets) - 1; i >= 0; i-- {
+		if c.subsets[i].pattern.matchesWithin(segs) {
+			return c.subsets[i].policy
+		}
+	}
+	return ExtraKeysError
+}
+
+func unionKeys(m1, m2 map[string]interface{}) []string {
+	keys := sortedKeys(m1)
+	for _, k := range sortedKeys(m2) {
+		if _, ok := m1[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
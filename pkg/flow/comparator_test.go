@@ -2,6 +2,7 @@ package flow
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -161,3 +162,196 @@ func TestFormatDiffs(t *testing.T) {
 		t.Errorf("FormatDiffs(nil) = %q, want empty", empty)
 	}
 }
+
+func TestDeepCompareIgnorePaths(t *testing.T) {
+	expected := []byte(`{
+		"id": "ORD-1",
+		"created_at": "2026-01-01T00:00:00Z",
+		"items": [{"sku": "A", "created_at": "t1"}, {"sku": "B", "created_at": "t2"}],
+		"meta": {"trace_id": "abc", "source": "api"}
+	}`)
+	actual := []byte(`{
+		"id": "ORD-1",
+		"created_at": "2026-02-02T00:00:00Z",
+		"items": [{"sku": "A", "created_at": "t9"}, {"sku": "B", "created_at": "t8"}],
+		"meta": {"trace_id": "xyz", "source": "api", "host": "pod-1"}
+	}`)
+
+	tests := []struct {
+		name      string
+		ignore    []string
+		wantDiffs int
+	}{
+		{"No rules", nil, 5},
+		{"Exact path", []string{"$.created_at"}, 4},
+		{"Wildcard index", []string{"$.created_at", "$.items[*].created_at"}, 2},
+		{"Recursive descent", []string{"$..created_at"}, 2},
+		{"Whole subtree", []string{"$..created_at", "$.meta"}, 0},
+		{"Key wildcard", []string{"$..created_at", "$.meta.*"}, 0},
+		{"Extra key by path", []string{"$..created_at", "$.meta.trace_id", "$.meta.host"}, 0},
+		{"Specific index only", []string{"$.created_at", "$.items[0].created_at", "$.meta"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare(expected, actual, IgnorePaths(tt.ignore...))
+			if len(diffs) != tt.wantDiffs {
+				t.Errorf("DeepCompare() returned %d diffs, want %d. Diffs: %v", len(diffs), tt.wantDiffs, diffs)
+			}
+			if equal != (tt.wantDiffs == 0) {
+				t.Errorf("DeepCompare() equal = %v", equal)
+			}
+		})
+	}
+}
+
+func TestCompareOptionsMerge(t *testing.T) {
+	client := NewCompareOptions(IgnorePaths("$.a", "$.b"))
+	point := NewCompareOptions(IgnorePaths("$.b", "$.c"))
+
+	merged := client.Merge(point)
+	want := []string{"$.a", "$.b", "$.c"}
+	if len(merged.IgnorePaths) != len(want) {
+		t.Fatalf("Merge() = %v, want %v", merged.IgnorePaths, want)
+	}
+	for i := range want {
+		if merged.IgnorePaths[i] != want[i] {
+			t.Errorf("Merge()[%d] = %q, want %q", i, merged.IgnorePaths[i], want[i])
+		}
+	}
+
+	if !(CompareOptions{}).IsZero() || merged.IsZero() {
+		t.Error("IsZero() mismatch")
+	}
+	if err := NewCompareOptions(IgnorePaths("created_at")).Validate(); err == nil {
+		t.Error("Validate() should reject patterns without $")
+	}
+}
+
+func TestDeepCompareNumbers(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		opts     []CompareOption
+		want     bool
+	}{
+		{"Large int64 IDs differ", `{"id": 9007199254740993}`, `{"id": 9007199254740992}`, nil, false},
+		{"Large int64 IDs equal", `{"id": 9007199254740993}`, `{"id": 9007199254740993}`, nil, true},
+		{"Same decimal, different notation", `{"v": 1.50}`, `{"v": 1.5e0}`, nil, true},
+		{"Huge exponents compared as text", `{"v": 1e999999}`, `{"v": 1e999998}`, []CompareOption{Tolerance(1, 0)}, false},
+		{"Drift without tolerance", `{"total": 150.5}`, `{"total": 150.50000001}`, nil, false},
+		{"Global absolute tolerance", `{"total": 150.5}`, `{"total": 150.50000001}`, []CompareOption{Tolerance(0.01, 0)}, true},
+		{"Global relative tolerance", `{"total": 1000000}`, `{"total": 1000001}`, []CompareOption{Tolerance(0, 1e-5)}, true},
+		{"Relative tolerance too tight", `{"total": 1000000}`, `{"total": 1000100}`, []CompareOption{Tolerance(0, 1e-5)}, false},
+		{"Path tolerance", `{"items": [{"price": 9.99}]}`, `{"items": [{"price": 9.991}]}`, []CompareOption{PathTolerance("$.items[*].price", 0.005, 0)}, true},
+		{"Path tolerance elsewhere", `{"qty": 9.99}`, `{"qty": 9.991}`, []CompareOption{PathTolerance("$.price", 0.005, 0)}, false},
+		{"Last rule wins", `{"total": 10}`, `{"total": 10.5}`, []CompareOption{Tolerance(1, 0), PathTolerance("$.total", 0.1, 0)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare([]byte(tt.expected), []byte(tt.actual), tt.opts...)
+			if equal != tt.want {
+				t.Errorf("DeepCompare() equal = %v, want %v. Diffs: %v", equal, tt.want, diffs)
+			}
+		})
+	}
+}
+
+func TestToleranceValidation(t *testing.T) {
+	if err := NewCompareOptions(Tolerance(-1, 0)).Validate(); err == nil {
+		t.Error("Validate() should reject negative tolerances")
+	}
+	if err := NewCompareOptions(PathTolerance("total", 0.01, 0)).Validate(); err == nil {
+		t.Error("Validate() should reject invalid tolerance paths")
+	}
+	if NewCompareOptions(Tolerance(0.01, 0)).IsZero() {
+		t.Error("IsZero() should be false with tolerances")
+	}
+}
+
+func TestDeepCompareSubset(t *testing.T) {
+	expected := []byte(`{"id": "ORD-1", "customer": {"name": "Ana"}}`)
+	actual := []byte(`{"id": "ORD-1", "enriched_at": "t1", "customer": {"name": "Ana", "tier": "gold"}}`)
+
+	tests := []struct {
+		name         string
+		opts         []CompareOption
+		wantEqual    bool
+		wantErrors   int
+		wantWarnings int
+	}{
+		{"Strict by default", nil, false, 2, 0},
+		{"Whole document subset", []CompareOption{Subset()}, true, 0, 0},
+		{"Subtree subset", []CompareOption{Subset("$.customer")}, false, 1, 0},
+		{"Subset with warnings", []CompareOption{SubsetWithWarnings()}, true, 0, 2},
+		{"Strict overrides subset", []CompareOption{Subset(), Strict("$.customer")}, false, 1, 0},
+		{"Single extra key", []CompareOption{Subset("$.enriched_at")}, false, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare(expected, actual, tt.opts...)
+			errs, warns := SplitDiffs(diffs)
+			if equal != tt.wantEqual || len(errs) != tt.wantErrors || len(warns) != tt.wantWarnings {
+				t.Errorf("DeepCompare() equal = %v, %d errors, %d warnings; want %v, %d, %d. Diffs: %v",
+					equal, len(errs), len(warns), tt.wantEqual, tt.wantErrors, tt.wantWarnings, diffs)
+			}
+		})
+	}
+}
+
+func TestSubsetStillReportsMissingKeys(t *testing.T) {
+	diffs, equal := DeepCompare([]byte(`{"id": 1, "total": 10}`), []byte(`{"id": 1, "extra": true}`), Subset())
+	if equal || len(diffs) != 1 || !strings.Contains(diffs[0].Message, "key missing") {
+		t.Errorf("DeepCompare() = %v, %v; want a single missing-key diff", diffs, equal)
+	}
+}
+
+func TestDeepCompareKindsAndOrder(t *testing.T) {
+	expected := []byte(`{"z": 1, "b": {"y": "s", "x": [1, 2]}, "a": true, "m": 1}`)
+	actual := []byte(`{"z": 2, "b": {"y": 1, "x": [1]}, "n": 1, "m": 1}`)
+
+	want := []struct {
+		path string
+		kind DiffKind
+	}{
+		{"$.a", DiffMissingKey},
+		{"$.b.x", DiffLengthMismatch},
+		{"$.b.y", DiffTypeMismatch},
+		{"$.n", DiffExtraKey},
+		{"$.z", DiffValueMismatch},
+	}
+
+	for run := 0; run < 20; run++ {
+		diffs, _ := DeepCompare(expected, actual)
+		if len(diffs) != len(want) {
+			t.Fatalf("DeepCompare() returned %d diffs, want %d: %v", len(diffs), len(want), diffs)
+		}
+		for i, w := range want {
+			if diffs[i].Path != w.path || diffs[i].Kind != w.kind {
+				t.Fatalf("run %d: diff[%d] = %s %s, want %s %s", run, i, diffs[i].Path, diffs[i].Kind, w.path, w.kind)
+			}
+		}
+	}
+}
+
+func TestDeepCompareMaxDiffs(t *testing.T) {
+	expected := []byte(`{"a": 1, "b": 2, "c": 3, "d": 4}`)
+	actual := []byte(`{"a": 0, "b": 0, "c": 0, "d": 0}`)
+
+	diffs, equal := DeepCompare(expected, actual, MaxDiffs(2))
+	if equal {
+		t.Error("DeepCompare() should not be equal")
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("DeepCompare() returned %d diffs, want 2 plus truncation: %v", len(diffs), diffs)
+	}
+	last := diffs[2]
+	if last.Kind != DiffTruncated || last.IsWarning() || !strings.Contains(last.Message, "2 more") {
+		t.Errorf("truncation entry = %+v", last)
+	}
+
+	warnOnly, equal := DeepCompare([]byte(`{}`), []byte(`{"a": 1, "b": 2, "c": 3}`), SubsetWithWarnings(), MaxDiffs(1))
+	if !equal || len(warnOnly) != 2 || !warnOnly[1].IsWarning() {
+		t.Errorf("truncated warnings = %v, equal %v", warnOnly, equal)
+	}
+}
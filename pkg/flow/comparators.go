@@ -0,0 +1,118 @@
+package flow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ComparatorFunc compares the subtree at a path in place of the built-in
+// comparison. It receives the decoded (and normalized) values: maps, slices,
+// json.Number, string, bool or nil. Paths of the returned diffs are relative
+// to the subtree, "$" being its root; an empty Kind means DiffValueMismatch.
+type ComparatorFunc func(expected, actual interface{}) []DiffEntry
+
+// PathComparator binds a ComparatorFunc to a path pattern.
+type PathComparator struct {
+	Path string
+	Func ComparatorFunc
+}
+
+// CompareWith compares values matching the path pattern with fn. The last
+// matching comparator wins. Comparators are Go code and are not stored with
+// points: use them with DeepCompare or the client and flow-name options, or
+// register them with FlowClient.RegisterComparator.
+func CompareWith(path string, fn ComparatorFunc) CompareOption {
+	return func(o *CompareOptions) {
+		o.comparators = append(o.comparators, PathComparator{Path: path, Func: fn})
+	}
+}
+
+// RegisterComparator compares values matching path with fn in every flow
+// finished by this client.
+func (c *FlowClient) RegisterComparator(path string, fn ComparatorFunc) error {
+	return c.registerComparator("", path, fn)
+}
+
+// RegisterFlowComparator compares values matching path with fn in flows
+// named flowName. It takes precedence over RegisterComparator.
+func (c *FlowClient) RegisterFlowComparator(flowName, path string, fn ComparatorFunc) error {
+	if flowName == "" {
+		return &ConfigError{msg: "flow name is required"}
+	}
+	return c.registerComparator(flowName, path, fn)
+}
+
+func (c *FlowClient) registerComparator(flowName, path string, fn ComparatorFunc) error {
+	if fn == nil {
+		return &ConfigError{msg: "comparator function is required"}
+	}
+	if _, err := parsePath(path); err != nil {
+		return &ConfigError{msg: fmt.Sprintf("invalid comparator path: %v", err)}
+	}
+	c.comparatorsMu.Lock()
+	defer c.comparatorsMu.Unlock()
+	if c.comparators == nil {
+		c.comparators = map[string][]PathComparator{}
+	}
+	c.comparators[flowName] = append(c.comparators[flowName], PathComparator{Path: path, Func: fn})
+	return nil
+}
+
+// registeredComparators returns the client-wide comparators followed by those
+// of flowName.
+func (c *FlowClient) registeredComparators(flowName string) []PathComparator {
+	c.comparatorsMu.RLock()
+	defer c.comparatorsMu.RUnlock()
+	out := append([]PathComparator{}, c.comparators[""]...)
+	if flowName != "" {
+		out = append(out, c.comparators[flowName]...)
+	}
+	return out
+}
+
+type compiledComparator struct {
+	pattern pathPattern
+	fn      ComparatorFunc
+}
+
+func compileComparators(comparators []PathComparator) []compiledComparator {
+	out := make([]compiledComparator, 0, len(comparators))
+	for _, pc := range comparators {
+		if segs, err := parsePath(pc.Path); err == nil && pc.Func != nil {
+			out = append(out, compiledComparator{pattern: segs, fn: pc.Func})
+		}
+	}
+	return out
+}
+
+// comparator returns the last comparator matching segs.
+func (c *comparer) comparator(segs []pathSegment) ComparatorFunc {
+	for i := len(c.comparators) - 1; i >= 0; i-- {
+		if c.comparators[i].pattern.matches(segs) {
+			return c.comparators[i].fn
+		}
+	}
+	return nil
+}
+
+// runComparator records the diffs of fn, rebased from the subtree root onto path.
+func (c *comparer) runComparator(fn ComparatorFunc, expected, actual interface{}, path string, segs []pathSegment) {
+	for _, d := range fn(expected, actual) {
+		rel := strings.TrimPrefix(d.Path, "$")
+		if rel != "" && rel[0] != '.' && rel[0] != '[' {
+			rel = "." + rel
+		}
+		d.Path = path + rel
+		if d.Kind == "" {
+			d.Kind = DiffValueMismatch
+		}
+		if d.Message == "" {
+			d.Message = fmt.Sprintf("path %s: comparator rejected value", d.Path)
+		}
+		dsegs, err := parsePath(d.Path)
+		if err != nil {
+			dsegs = segs
+		}
+		c.add(dsegs, d)
+	}
+}
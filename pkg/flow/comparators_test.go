@@ -0,0 +1,141 @@
+package flow
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// moneyComparator compares {"amount", "currency"} objects to the cent.
+func moneyComparator(expected, actual interface{}) []DiffEntry {
+	e, _ := expected.(map[string]interface{})
+	a, _ := actual.(map[string]interface{})
+	if e == nil || a == nil {
+		return []DiffEntry{{Path: "$", Kind: DiffTypeMismatch, Message: "not a money object"}}
+	}
+	var diffs []DiffEntry
+	if e["currency"] != a["currency"] {
+		diffs = append(diffs, DiffEntry{Path: "$.currency", Expected: e["currency"], Actual: a["currency"]})
+	}
+	er, _ := new(big.Rat).SetString(e["amount"].(json.Number).String())
+	ar, _ := new(big.Rat).SetString(a["amount"].(json.Number).String())
+	if er.FloatString(2) != ar.FloatString(2) {
+		diffs = append(diffs, DiffEntry{Path: "amount", Expected: e["amount"], Actual: a["amount"]})
+	}
+	return diffs
+}
+
+func TestDeepCompareWithComparator(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  string
+		actual    string
+		wantPaths []string
+	}{
+		{"Equal to the cent", `{"total": {"amount": 10.001, "currency": "EUR"}}`, `{"total": {"amount": 10.004, "currency": "EUR"}}`, nil},
+		{"Amount differs", `{"total": {"amount": 10, "currency": "EUR"}}`, `{"total": {"amount": 10.5, "currency": "EUR"}}`, []string{"$.total.amount"}},
+		{"Both differ", `{"total": {"amount": 10, "currency": "EUR"}}`, `{"total": {"amount": 11, "currency": "USD"}}`, []string{"$.total.currency", "$.total.amount"}},
+		{"Not an object", `{"total": {"amount": 10, "currency": "EUR"}}`, `{"total": 10}`, []string{"$.total"}},
+		{"Other paths compared as usual", `{"total": {"amount": 10, "currency": "EUR"}, "id": 1}`, `{"total": {"amount": 10, "currency": "EUR"}, "id": 2}`, []string{"$.id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare(json.RawMessage(tt.expected), json.RawMessage(tt.actual), CompareWith("$.total", moneyComparator))
+			if equal != (len(tt.wantPaths) == 0) {
+				t.Errorf("DeepCompare() equal = %v, diffs %v", equal, diffs)
+			}
+			if len(diffs) != len(tt.wantPaths) {
+				t.Fatalf("DeepCompare() = %v, want paths %v", diffs, tt.wantPaths)
+			}
+			for i, d := range diffs {
+				if d.Path != tt.wantPaths[i] || d.Kind == "" || d.Message == "" {
+					t.Errorf("diff %d = %+v, want path %s", i, d, tt.wantPaths[i])
+				}
+			}
+		})
+	}
+}
+
+func TestComparatorPrecedence(t *testing.T) {
+	reject := func(expected, actual interface{}) []DiffEntry {
+		return []DiffEntry{{Message: "rejected"}}
+	}
+	accept := func(expected, actual interface{}) []DiffEntry { return nil }
+
+	_, equal := DeepCompare(json.RawMessage(`{"a": [1, 2]}`), json.RawMessage(`{"a": [3, 4]}`),
+		CompareWith("$.a[*]", reject), CompareWith("$.a[*]", accept))
+	if !equal {
+		t.Error("the last matching comparator should win")
+	}
+
+	_, equal = DeepCompare(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a": 1}`),
+		CompareWith("$.a", reject), IgnorePaths("$.a"))
+	if !equal {
+		t.Error("ignored paths should not reach comparators")
+	}
+}
+
+func TestRegisterComparator(t *testing.T) {
+	client, _ := NewClient(nil, FlowConfig{IsProduction: true})
+	if err := client.RegisterComparator("total", moneyComparator); err == nil {
+		t.Error("RegisterComparator() should reject an invalid path")
+	}
+	if err := client.RegisterComparator("$.total", nil); err == nil {
+		t.Error("RegisterComparator() should reject a nil function")
+	}
+	if err := client.RegisterFlowComparator("", "$.total", moneyComparator); err == nil {
+		t.Error("RegisterFlowComparator() should reject an empty flow name")
+	}
+	if err := client.RegisterFlowComparator("Billing", "$.total", moneyComparator); err != nil {
+		t.Fatalf("RegisterFlowComparator() error = %v", err)
+	}
+
+	p := Point{Expected: json.RawMessage(`{"total": {"amount": 10.001, "currency": "EUR"}}`)}
+	a := Assertion{Actual: json.RawMessage(`{"total": {"amount": 10.004, "currency": "EUR"}}`)}
+	if diffs := client.comparePoint("Billing", p, a); len(diffs) != 0 {
+		t.Errorf("comparePoint(Billing) = %v, want no diffs", diffs)
+	}
+	if diffs := client.comparePoint("Shipping", p, a); len(diffs) != 1 {
+		t.Errorf("comparePoint(Shipping) = %v, want the built-in comparison", diffs)
+	}
+
+	if err := client.RegisterComparator("$.total", func(expected, actual interface{}) []DiffEntry {
+		return []DiffEntry{{Message: "rejected"}}
+	}); err != nil {
+		t.Fatalf("RegisterComparator() error = %v", err)
+	}
+	if diffs := client.comparePoint("Shipping", p, a); len(diffs) != 1 || diffs[0].Message != "rejected" {
+		t.Errorf("comparePoint(Shipping) = %v, want the client comparator", diffs)
+	}
+	if diffs := client.comparePoint("Billing", p, a); len(diffs) != 0 {
+		t.Errorf("comparePoint(Billing) = %v, flow comparators should take precedence", diffs)
+	}
+}
+
+func TestComparePointUsesStoredOptions(t *testing.T) {
+	client, _ := NewClient(nil, FlowConfig{IsProduction: true, CompareOptions: CompareOptions{
+		IgnorePaths: []string{"$.id"},
+		Tolerances:  []NumericTolerance{{Abs: 1}},
+	}})
+	if err := client.RegisterComparator("$.total", moneyComparator); err != nil {
+		t.Fatal(err)
+	}
+
+	// The producer stored a client tolerance followed by a tighter point rule.
+	stored := NewCompareOptions(Tolerance(1, 0), PathTolerance("$.qty", 0.1, 0))
+	p := Point{
+		Expected: json.RawMessage(`{"id": "A", "qty": 2, "total": {"amount": 10, "currency": "EUR"}}`),
+		Compare:  &stored,
+	}
+	a := Assertion{Actual: json.RawMessage(`{"id": "B", "qty": 2.5, "total": {"amount": 10.5, "currency": "EUR"}}`)}
+
+	diffs := client.comparePoint("Billing", p, a)
+	var paths []string
+	for _, d := range diffs {
+		paths = append(paths, d.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"$.id", "$.qty", "$.total.amount"}) {
+		t.Errorf("comparePoint() = %v; want the stored rules only, plus the client comparator", diffs)
+	}
+}
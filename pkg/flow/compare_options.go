@@ -0,0 +1,373 @@
+package flow
+
+import "fmt"
+
+// CompareOptions tunes how a point is compared with its assertion. Options set
+// on a point are stored with it, so Finish in any service and the dashboard
+// apply the same rules.
+type CompareOptions struct {
+	// IgnorePaths are path patterns in the syntax DiffEntry.Path uses
+	// ($.a.b[0]), plus wildcards ($.items[*].created_at, $.meta.*) and
+	// recursive descent ($..trace_id). Matching subtrees are not compared.
+	IgnorePaths []string `json:"ignore_paths,omitempty"`
+	// Tolerances accept numeric drift. A tolerance without Path applies to
+	// every number; the last matching rule wins, so point rules override
+	// flow-name and client rules.
+	Tolerances []NumericTolerance `json:"tolerances,omitempty"`
+	// Arrays select how arrays at a path are compared; the last matching rule
+	// wins. Arrays without a rule are compared by index.
+	Arrays []ArrayRule `json:"arrays,omitempty"`
+	// Subsets treat expected as a subset of actual below a path: keys only
+	// present in actual are ignored or reported as warnings. A rule applies to
+	// its path and everything below it; the last matching rule wins.
+	Subsets []SubsetRule `json:"subsets,omitempty"`
+	// Normalize rewrites values of both documents before they are compared
+	// (trimming, case folding, numeric strings, timestamps, null members).
+	Normalize []NormalizeRule `json:"normalize,omitempty"`
+	// Severities downgrade (or restore) the severity of diffs by path and
+	// kind; the last matching rule wins.
+	Severities []SeverityRule `json:"severities,omitempty"`
+	// Known acknowledges failing diffs until an expiry date, reporting them
+	// as warnings.
+	Known []KnownDifference `json:"known,omitempty"`
+	// MaxDiffs caps the diffs returned; the rest are summarised in a final
+	// DiffTruncated entry. Zero means no cap.
+	MaxDiffs int `json:"max_diffs,omitempty"`
+
+	// comparators take over the comparison of matching subtrees. They are
+	// Go functions, so they are never stored; see CompareWith.
+	comparators []PathComparator
+}
+
+// Policies for keys present in actual but not in expected.
+const (
+	ExtraKeysError  = "error"   // strict (default)
+	ExtraKeysWarn   = "warning" // reported with SeverityWarning
+	ExtraKeysIgnore = "ignore"
+)
+
+// SubsetRule sets the extra-key policy below Path.
+type SubsetRule struct {
+	Path      string `json:"path"`
+	ExtraKeys string `json:"extra_keys"`
+}
+
+// Array comparison modes.
+const (
+	ArrayOrdered  = "ordered"  // by index (default)
+	ArraySet      = "set"      // order and duplicates ignored
+	ArrayMultiset = "multiset" // order ignored, duplicates counted
+	ArrayKey      = "key"      // elements matched by a key field
+	ArrayLCS      = "lcs"      // aligned by longest common subsequence
+)
+
+// ArrayRule selects the comparison mode for arrays matching Path.
+type ArrayRule struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Key  string `json:"key,omitempty"`
+}
+
+// NumericTolerance accepts |expected-actual| <= Abs or
+// |expected-actual| <= Rel * max(|expected|, |actual|).
+type NumericTolerance struct {
+	Path string  `json:"path,omitempty"`
+	Abs  float64 `json:"abs,omitempty"`
+	Rel  float64 `json:"rel,omitempty"`
+}
+
+// CompareOption configures CompareOptions.
+type CompareOption func(*CompareOptions)
+
+// NewCompareOptions builds CompareOptions from functional options.
+func NewCompareOptions(opts ...CompareOption) CompareOptions {
+	var o CompareOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// IgnorePaths skips volatile fields such as timestamps or generated IDs.
+func IgnorePaths(patterns ...string) CompareOption {
+	return func(o *CompareOptions) {
+		o.IgnorePaths = append(o.IgnorePaths, patterns...)
+	}
+}
+
+// Tolerance accepts numeric drift on every number (e.g. Tolerance(0.01, 0)).
+func Tolerance(abs, rel float64) CompareOption {
+	return func(o *CompareOptions) {
+		o.Tolerances = append(o.Tolerances, NumericTolerance{Abs: abs, Rel: rel})
+	}
+}
+
+// PathTolerance accepts numeric drift on numbers matching the path pattern.
+func PathTolerance(path string, abs, rel float64) CompareOption {
+	return func(o *CompareOptions) {
+		o.Tolerances = append(o.Tolerances, NumericTolerance{Path: path, Abs: abs, Rel: rel})
+	}
+}
+
+// UnorderedArrays compares arrays at the paths as sets, or as multisets when
+// duplicates matter.
+func UnorderedArrays(multiset bool, paths ...string) CompareOption {
+	mode := ArraySet
+	if multiset {
+		mode = ArrayMultiset
+	}
+	return arrayRules(mode, "", paths)
+}
+
+// ArraysByKey matches array elements at the paths by the key field (e.g. "id").
+func ArraysByKey(key string, paths ...string) CompareOption {
+	return arrayRules(ArrayKey, key, paths)
+}
+
+// AlignedArrays aligns arrays at the paths by longest common subsequence and
+// reports inserted and removed elements.
+func AlignedArrays(paths ...string) CompareOption {
+	return arrayRules(ArrayLCS, "", paths)
+}
+
+// OrderedArrays restores index comparison at the paths, overriding broader rules.
+func OrderedArrays(paths ...string) CompareOption {
+	return arrayRules(ArrayOrdered, "", paths)
+}
+
+func arrayRules(mode, key string, paths []string) CompareOption {
+	return func(o *CompareOptions) {
+		for _, p := range paths {
+			o.Arrays = append(o.Arrays, ArrayRule{Path: p, Mode: mode, Key: key})
+		}
+	}
+}
+
+// Subset ignores keys only present in actual below the paths (the whole
+// document when none are given).
+func Subset(paths ...string) CompareOption {
+	return subsetRules(ExtraKeysIgnore, paths)
+}
+
+// SubsetWithWarnings is Subset, reporting extra keys as warnings.
+func SubsetWithWarnings(paths ...string) CompareOption {
+	return subsetRules(ExtraKeysWarn, paths)
+}
+
+// Strict reports extra keys below the paths as errors, overriding broader
+// subset rules.
+func Strict(paths ...string) CompareOption {
+	return subsetRules(ExtraKeysError, paths)
+}
+
+func subsetRules(policy string, paths []string) CompareOption {
+	if len(paths) == 0 {
+		paths = []string{"$"}
+	}
+	return func(o *CompareOptions) {
+		for _, p := range paths {
+			o.Subsets = append(o.Subsets, SubsetRule{Path: p, ExtraKeys: policy})
+		}
+	}
+}
+
+// MaxDiffs caps the number of diffs reported per comparison.
+func MaxDiffs(n int) CompareOption {
+	return func(o *CompareOptions) {
+		o.MaxDiffs = n
+	}
+}
+
+// Merge returns the union of o and other. Rules of other are appended after
+// o's; a non-zero MaxDiffs of other replaces o's.
+func (o CompareOptions) Merge(other CompareOptions) CompareOptions {
+	merged := o
+	merged.IgnorePaths = appendUnique(o.IgnorePaths, other.IgnorePaths)
+	merged.Tolerances = append(append([]NumericTolerance{}, o.Tolerances...), other.Tolerances...)
+	merged.Arrays = append(append([]ArrayRule{}, o.Arrays...), other.Arrays...)
+	merged.Subsets = append(append([]SubsetRule{}, o.Subsets...), other.Subsets...)
+	merged.Normalize = append(append([]NormalizeRule{}, o.Normalize...), other.Normalize...)
+	merged.Severities = append(append([]SeverityRule{}, o.Severities...), other.Severities...)
+	merged.Known = append(append([]KnownDifference{}, o.Known...), other.Known...)
+	merged.comparators = append(append([]PathComparator{}, o.comparators...), other.comparators...)
+	if other.MaxDiffs != 0 {
+		merged.MaxDiffs = other.MaxDiffs
+	}
+	return merged
+}
+
+// IsZero reports whether no option is set.
+func (o CompareOptions) IsZero() bool {
+	return len(o.IgnorePaths) == 0 && len(o.Tolerances) == 0 && len(o.Arrays) == 0 &&
+		len(o.Subsets) == 0 && len(o.Normalize) == 0 &&
+		len(o.Severities) == 0 && len(o.Known) == 0 && len(o.comparators) == 0 && o.MaxDiffs == 0
+}
+
+// Validate checks that every path pattern parses and every rule is well-formed.
+func (o CompareOptions) Validate() error {
+	if o.MaxDiffs < 0 {
+		return fmt.Errorf("invalid max diffs %d: must not be negative", o.MaxDiffs)
+	}
+	for _, p := range o.IgnorePaths {
+		if _, err := parsePath(p); err != nil {
+			return fmt.Errorf("invalid ignore path: %w", err)
+		}
+	}
+	for _, t := range o.Tolerances {
+		if t.Abs < 0 || t.Rel < 0 {
+			return fmt.Errorf("invalid tolerance for %q: must not be negative", t.Path)
+		}
+		if t.Path != "" {
+			if _, err := parsePath(t.Path); err != nil {
+				return fmt.Errorf("invalid tolerance path: %w", err)
+			}
+		}
+	}
+	for _, a := range o.Arrays {
+		if _, err := parsePath(a.Path); err != nil {
+			return fmt.Errorf("invalid array path: %w", err)
+		}
+		switch a.Mode {
+		case ArrayOrdered, ArraySet, ArrayMultiset, ArrayLCS:
+		case ArrayKey:
+			if a.Key == "" {
+				return fmt.Errorf("array rule for %q: key mode requires a key", a.Path)
+			}
+		default:
+			return fmt.Errorf("array rule for %q: unknown mode %q", a.Path, a.Mode)
+		}
+	}
+	for _, r := range o.Subsets {
+		if _, err := parsePath(r.Path); err != nil {
+			return fmt.Errorf("invalid subset path: %w", err)
+		}
+		switch r.ExtraKeys {
+		case ExtraKeysError, ExtraKeysWarn, ExtraKeysIgnore:
+		default:
+			return fmt.Errorf("subset rule for %q: unknown extra key policy %q", r.Path, r.ExtraKeys)
+		}
+	}
+	for _, r := range o.Normalize {
+		if _, err := parsePath(r.Path); err != nil {
+			return fmt.Errorf("invalid normalize path: %w", err)
+		}
+		if len(r.Transforms) == 0 {
+			return fmt.Errorf("normalize rule for %q: no transforms", r.Path)
+		}
+		for _, t := range r.Transforms {
+			if !validNormalizeTransform(t) {
+				return fmt.Errorf("normalize rule for %q: unknown transform %q", r.Path, t)
+			}
+		}
+	}
+	for _, r := range o.Severities {
+		if r.Path != "" {
+			if _, err := parsePath(r.Path); err != nil {
+				return fmt.Errorf("invalid severity path: %w", err)
+			}
+		}
+		if !validSeverity(r.Severity) {
+			return fmt.Errorf("severity rule for %q: unknown severity %q", r.Path, r.Severity)
+		}
+	}
+	for _, k := range o.Known {
+		if _, err := parsePath(k.Path); err != nil {
+			return fmt.Errorf("invalid known difference path: %w", err)
+		}
+		if k.Owner == "" || k.Expires.IsZero() {
+			return fmt.Errorf("known difference for %q: owner and expiry are required", k.Path)
+		}
+	}
+	for _, pc := range o.comparators {
+		if _, err := parsePath(pc.Path); err != nil {
+			return fmt.Errorf("invalid comparator path: %w", err)
+		}
+		if pc.Func == nil {
+			return fmt.Errorf("comparator for %q: no function", pc.Path)
+		}
+	}
+	return nil
+}
+
+func appendUnique(base, extra []string) []string {
+	if len(extra) == 0 {
+		return base
+	}
+	out := make([]string, 0, len(base)+len(extra))
+	seen := map[string]bool{}
+	for _, s := range append(append([]string{}, base...), extra...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// pathPattern is a compiled path pattern matched against concrete diff paths.
+type pathPattern []pathSegment
+
+func compilePatterns(patterns []string) []pathPattern {
+	out := make([]pathPattern, 0, len(patterns))
+	for _, p := range patterns {
+		if segs, err := parsePath(p); err == nil {
+			out = append(out, segs)
+		}
+	}
+	return out
+}
+
+// matches reports whether the concrete path (keys and indexes only) matches the pattern.
+func (p pathPattern) matches(path []pathSegment) bool {
+	return matchSegments(p, path)
+}
+
+func matchSegments(pattern, path []pathSegment) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	seg := pattern[0]
+	if seg.kind == segRecursive {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+	switch seg.kind {
+	case segKey:
+		if path[0].kind != segKey || path[0].key != seg.key {
+			return false
+		}
+	case segIndex:
+		if path[0].kind != segIndex || path[0].index != seg.index {
+			return false
+		}
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
+
+// matchesWithin reports whether the pattern matches path or one of its ancestors.
+func (p pathPattern) matchesWithin(path []pathSegment) bool {
+	for i := len(path); i >= 0; i-- {
+		if p.matches(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []pathPattern, path []pathSegment) bool {
+	for _, p := range patterns {
+		if p.matches(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// correlationRule holds the parsed identifier paths of one flow name.
+type correlationRule struct {
+	flowName string
+	paths    [][]pathSegment
+}
+
+func compileCorrelation(rules map[string][]string) ([]correlationRule, error) {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiled := make([]correlationRule, 0, len(names))
+	for _, name := range names {
+		rule := correlationRule{flowName: name}
+		for _, p := range rules[name] {
+			segs, err := parsePath(p)
+			if err != nil {
+				return nil, &ConfigError{msg: fmt.Sprintf("invalid correlation rule for flow '%s': %v", name, err)}
+			}
+			rule.paths = append(rule.paths, segs)
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// candidates returns the identifiers found in doc, in rule order and without duplicates.
+func (r correlationRule) candidates(doc interface{}) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, segs := range r.paths {
+		for _, v := range evalPath(doc, segs) {
+			if s, ok := scalarString(v); ok && !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// Correlate finds the active flow a payload belongs to using the configured
+// correlation rules (FlowConfig.Correlation). Every identifier extracted by a
+// flow name's paths is tried in order, so alias identifiers such as
+// payment_id and order_id can point to the same flow. When flowNames is
+// given, only those flow names are considered. Flows that do not record
+// (skipped or over MaxExecutions) are passed over for later candidates, and
+// returned only when no recording flow matches.
+func (c *FlowClient) Correlate(ctx context.Context, payload interface{}, flowNames ...string) (*flowInstance, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	return c.correlate(doc, flowNames, func(flowName, ident string) (*flowInstance, error) {
+		return c.GetFlow(ctx, flowName, ident)
+	})
+}
+
+// correlate tries the candidates of each rule with lookup.
+func (c *FlowClient) correlate(doc interface{}, flowNames []string, lookup func(flowName, ident string) (*flowInstance, error)) (*flowInstance, error) {
+	only := map[string]bool{}
+	for _, n := range flowNames {
+		only[n] = true
+	}
+
+	var skipped *flowInstance
+	for _, rule := range c.correlation {
+		if len(only) > 0 && !only[rule.flowName] {
+			continue
+		}
+		for _, ident := range rule.candidates(doc) {
+			f, err := lookup(rule.flowName, ident)
+			if err != nil {
+				if !IsNotFound(err) {
+					return nil, err
+				}
+				continue
+			}
+			if isSkipped(f.Flow.Status) {
+				if skipped == nil {
+					skipped = f
+				}
+				continue
+			}
+			c.logger.Debug("Correlated payload to flow '%s' via identifier '%s'", rule.flowName, ident)
+			return f, nil
+		}
+	}
+
+	if skipped != nil {
+		return skipped, nil
+	}
+	return nil, &FlowError{Op: "Correlate", Err: ErrFlowNotFound}
+}
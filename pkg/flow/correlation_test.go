@@ -0,0 +1,68 @@
+package flow
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCorrelate(t *testing.T) {
+	rules, err := compileCorrelation(map[string][]string{
+		"Checkout": {"$.order_id", "$.payment.id"},
+		"Refund":   {"$.refund_id"},
+	})
+	if err != nil {
+		t.Fatalf("compileCorrelation() error = %v", err)
+	}
+	c := &FlowClient{correlation: rules, logger: noopLogger{}}
+
+	active := map[string]*flowInstance{
+		"Checkout/P1": {Flow: &Flow{ID: 1, Name: "Checkout", Status: "ACTIVE"}},
+		"Checkout/O2": {Flow: &Flow{ID: 2, Name: "Checkout", Status: "SKIPPED_LIMIT"}},
+		"Refund/R1":   {Flow: &Flow{ID: 3, Name: "Refund", Status: "ACTIVE"}},
+	}
+	lookup := func(flowName, ident string) (*flowInstance, error) {
+		if f, ok := active[flowName+"/"+ident]; ok {
+			return f, nil
+		}
+		return nil, &FlowError{Op: "GetFlow", FlowName: flowName, Err: ErrFlowNotFound}
+	}
+	doc := func(s string) interface{} {
+		v, err := decodeJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name      string
+		payload   string
+		flowNames []string
+		wantID    int64
+	}{
+		{"alias identifier", `{"order_id": "O1", "payment": {"id": "P1"}}`, nil, 1},
+		{"skipped flow passed over", `{"order_id": "O2", "payment": {"id": "P1"}}`, nil, 1},
+		{"only a skipped flow", `{"order_id": "O2"}`, nil, 2},
+		{"flow names filter", `{"order_id": "O9", "payment": {"id": "P1"}, "refund_id": "R1"}`, []string{"Refund"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := c.correlate(doc(tt.payload), tt.flowNames, lookup)
+			if err != nil || f.Flow.ID != tt.wantID {
+				t.Fatalf("correlate() = %+v, %v; want flow %d", f, err, tt.wantID)
+			}
+		})
+	}
+
+	if _, err := c.correlate(doc(`{"order_id": "O9"}`), nil, lookup); !IsNotFound(err) {
+		t.Errorf("unknown identifier: err = %v, want ErrFlowNotFound", err)
+	}
+	if _, err := c.correlate(doc(`{"refund_id": "R1"}`), []string{"Checkout"}, lookup); !IsNotFound(err) {
+		t.Errorf("filtered out: err = %v, want ErrFlowNotFound", err)
+	}
+	dbErr := errors.New("connection refused")
+	failing := func(string, string) (*flowInstance, error) { return nil, dbErr }
+	if _, err := c.correlate(doc(`{"order_id": "O1"}`), nil, failing); !errors.Is(err, dbErr) {
+		t.Errorf("lookup failure: err = %v, want it returned", err)
+	}
+}
@@ -0,0 +1,367 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is an RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON keeps "value" (even null) on add and replace, and drops it on remove.
+func (p PatchOp) MarshalJSON() ([]byte, error) {
+	if p.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{p.Op, p.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{p.Op, p.Path, p.Value})
+}
+
+// JSONPatch returns the RFC 6902 patch that turns expected into actual for
+// every difference DeepCompare reports under opts. Ignored paths and values
+// within tolerance, matched by a matcher or equal once normalized are left
+// untouched. Arrays compared by a non-index mode, or whose length differs, are
+// replaced as a whole.
+func JSONPatch(expectedJSON, actualJSON json.RawMessage, opts ...CompareOption) ([]PatchOp, error) {
+	return JSONPatchWithOptions(expectedJSON, actualJSON, NewCompareOptions(opts...))
+}
+
+// JSONPatchWithOptions is JSONPatch for options loaded from storage.
+func JSONPatchWithOptions(expectedJSON, actualJSON json.RawMessage, opts CompareOptions) ([]PatchOp, error) {
+	expected, err := decodeJSON(expectedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal expected: %w", err)
+	}
+	actual, err := decodeJSON(actualJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal actual: %w", err)
+	}
+
+	opts.MaxDiffs = 0
+	c, err := newComparer(opts)
+	if err != nil {
+		return nil, err
+	}
+	c.collectDiffs(c.normalizeDoc(expected, nil), c.normalizeDoc(actual, nil), "$", nil)
+
+	var ops []PatchOp
+	emitted := map[string]bool{}
+	for _, d := range c.diffs {
+		if arr, ok := c.replacedArray(d); ok {
+			ptr := jsonPointer(arr)
+			if !emitted[ptr] {
+				emitted[ptr] = true
+				v, _ := valueAt(actual, arr)
+				ops = append(ops, PatchOp{Op: "replace", Path: ptr, Value: v})
+			}
+			continue
+		}
+
+		ptr := jsonPointer(d.segs)
+		switch d.Kind {
+		case DiffMissingKey:
+			ops = append(ops, PatchOp{Op: "remove", Path: ptr})
+		case DiffExtraKey:
+			v, _ := valueAt(actual, d.segs)
+			ops = append(ops, PatchOp{Op: "add", Path: ptr, Value: v})
+		case DiffValueMismatch, DiffTypeMismatch, DiffMatcherMismatch, DiffInvalid:
+			if v, ok := valueAt(actual, d.segs); ok {
+				ops = append(ops, PatchOp{Op: "replace", Path: ptr, Value: v})
+			}
+		}
+	}
+	return ops, nil
+}
+
+// replacedArray returns the outermost array containing d that the patch
+// replaces as a whole: arrays compared by a non-index mode, where element
+// indexes differ between expected and actual, and arrays whose length differs.
+func (c *comparer) replacedArray(d DiffEntry) ([]pathSegment, bool) {
+	for k, seg := range d.segs {
+		if seg.kind == segIndex && c.arrayRule(d.segs[:k]).mode != ArrayOrdered {
+			return d.segs[:k], true
+		}
+	}
+	if d.Kind == DiffLengthMismatch {
+		return d.segs, true
+	}
+	return nil, false
+}
+
+// valueAt resolves a concrete path (keys and indexes only) in a decoded document.
+func valueAt(doc interface{}, segs []pathSegment) (interface{}, bool) {
+	cur := doc
+	for _, seg := range segs {
+		switch seg.kind {
+		case segKey:
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = obj[seg.key]; !ok {
+				return nil, false
+			}
+		case segIndex:
+			arr, ok := cur.([]interface{})
+			if !ok || seg.index < 0 || seg.index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[seg.index]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// jsonPointer renders a concrete path as an RFC 6901 pointer.
+func jsonPointer(segs []pathSegment) string {
+	var b strings.Builder
+	for _, seg := range segs {
+		b.WriteByte('/')
+		if seg.kind == segIndex {
+			b.WriteString(strconv.Itoa(seg.index))
+			continue
+		}
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(seg.key))
+	}
+	return b.String()
+}
+
+// ANSI colors used by UnifiedDiff.
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// unifiedContext is the number of unchanged lines shown around each change.
+const unifiedContext = 3
+
+// UnifiedDiff renders a unified, line-based diff of the pretty-printed
+// documents (keys sorted, matchers shown as ‹regex(^ORD-)›). With color set,
+// removed and added lines are wrapped in ANSI colors for terminals and CI logs.
+// Equal documents yield an empty string. Documents whose differing lines would
+// need more than maxDiffCells of alignment fail with ErrDiffTooLarge.
+func UnifiedDiff(expectedJSON, actualJSON json.RawMessage, color bool) (string, error) {
+	expectedLines, err := prettyLines(expectedJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal expected: %w", err)
+	}
+	actualLines, err := prettyLines(actualJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal actual: %w", err)
+	}
+
+	edits, ok := lineEdits(expectedLines, actualLines)
+	if !ok {
+		return "", fmt.Errorf("%d and %d lines: %w", len(expectedLines), len(actualLines), ErrDiffTooLarge)
+	}
+	hunks := groupHunks(edits, unifiedContext)
+	if len(hunks) == 0 {
+		return "", nil
+	}
+
+	paint := func(code, line string) string {
+		if !color {
+			return line
+		}
+		return code + line + ansiReset
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(ansiRed, "--- expected") + "\n")
+	b.WriteString(paint(ansiGreen, "+++ actual") + "\n")
+	for _, h := range hunks {
+		b.WriteString(paint(ansiCyan, h.header()) + "\n")
+		for _, e := range h.edits {
+			switch e.op {
+			case '-':
+				b.WriteString(paint(ansiRed, "-"+e.line) + "\n")
+			case '+':
+				b.WriteString(paint(ansiGreen, "+"+e.line) + "\n")
+			default:
+				b.WriteString(" " + e.line + "\n")
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func prettyLines(data json.RawMessage) ([]string, error) {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	pretty, err := json.MarshalIndent(displayMatchers(doc), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(pretty), "\n"), nil
+}
+
+// displayMatchers replaces matcher objects with their description.
+func displayMatchers(v interface{}) interface{} {
+	if m, ok := matcherFrom(v); ok {
+		return "‹" + m.String() + "›"
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = displayMatchers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = displayMatchers(item)
+		}
+		return out
+	}
+	return v
+}
+
+type lineEdit struct {
+	op    byte // ' ', '-' or '+'
+	line  string
+	aLine int // 1-based line in expected (for ' ' and '-')
+	bLine int // 1-based line in actual (for ' ' and '+')
+}
+
+// maxDiffCells bounds the LCS table of lineEdits (16 MB of int32), so
+// diffing two large documents cannot exhaust memory.
+const maxDiffCells = 1 << 22
+
+// lineEdits aligns the lines by longest common subsequence. Common leading
+// and trailing lines are matched first; it reports false when the lines left
+// in between are too many to align.
+func lineEdits(a, b []string) ([]lineEdit, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	n, m := len(a)-prefix-suffix, len(b)-prefix-suffix
+	if int64(n+1)*int64(m+1) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i*w+j] is the LCS length of a[prefix+i:] and b[prefix+j:] within the middle.
+	w := m + 1
+	lcs := make([]int32, (n+1)*w)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[prefix+i] == b[prefix+j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else if lcs[(i+1)*w+j] >= lcs[i*w+j+1] {
+				lcs[i*w+j] = lcs[(i+1)*w+j]
+			} else {
+				lcs[i*w+j] = lcs[i*w+j+1]
+			}
+		}
+	}
+
+	edits := make([]lineEdit, 0, len(a)+m)
+	for k := 0; k < prefix; k++ {
+		edits = append(edits, lineEdit{op: ' ', line: a[k], aLine: k + 1, bLine: k + 1})
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		ai, bj := prefix+i, prefix+j
+		switch {
+		case i < n && j < m && a[ai] == b[bj]:
+			edits = append(edits, lineEdit{op: ' ', line: a[ai], aLine: ai + 1, bLine: bj + 1})
+			i++
+			j++
+		case j >= m || (i < n && lcs[(i+1)*w+j] >= lcs[i*w+j+1]):
+			edits = append(edits, lineEdit{op: '-', line: a[ai], aLine: ai + 1, bLine: bj})
+			i++
+		default:
+			edits = append(edits, lineEdit{op: '+', line: b[bj], aLine: ai, bLine: bj + 1})
+			j++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		ai, bj := len(a)-suffix+k, len(b)-suffix+k
+		edits = append(edits, lineEdit{op: ' ', line: a[ai], aLine: ai + 1, bLine: bj + 1})
+	}
+	return edits, true
+}
+
+type hunk struct {
+	edits []lineEdit
+}
+
+// header renders "@@ -aStart,aCount +bStart,bCount @@".
+func (h hunk) header() string {
+	aStart, bStart, aCount, bCount := 0, 0, 0, 0
+	for _, e := range h.edits {
+		if e.op != '+' {
+			if aCount == 0 {
+				aStart = e.aLine
+			}
+			aCount++
+		}
+		if e.op != '-' {
+			if bCount == 0 {
+				bStart = e.bLine
+			}
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aStart = h.edits[0].aLine
+	}
+	if bCount == 0 {
+		bStart = h.edits[0].bLine
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", aStart, aCount, bStart, bCount)
+}
+
+// groupHunks splits edits into hunks of changes with up to context unchanged
+// lines around them.
+func groupHunks(edits []lineEdit, context int) []hunk {
+	var hunks []hunk
+	start, end := -1, -1
+	for i, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+		lo, hi := i-context, i+context+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(edits) {
+			hi = len(edits)
+		}
+		if start >= 0 && lo <= end {
+			end = hi
+			continue
+		}
+		if start >= 0 {
+			hunks = append(hunks, hunk{edits: edits[start:end]})
+		}
+		start, end = lo, hi
+	}
+	if start >= 0 {
+		hunks = append(hunks, hunk{edits: edits[start:end]})
+	}
+	return hunks
+}
@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestJSONPatch(t *testing.T) {
+	expected := []byte(`{"id": "ORD-1", "total": 10, "status": "new", "items": [{"sku": "A"}, {"sku": "B"}], "a/b": 1}`)
+	actual := []byte(`{"id": "ORD-1", "total": 12.5, "note": null, "items": [{"sku": "A"}, {"sku": "B"}, {"sku": "C"}], "a/b": 2}`)
+
+	ops, err := JSONPatch(expected, actual)
+	if err != nil {
+		t.Fatalf("JSONPatch() error = %v", err)
+	}
+
+	raw, _ := json.Marshal(ops)
+	want := `[{"op":"replace","path":"/a~1b","value":2},` +
+		`{"op":"replace","path":"/items","value":[{"sku":"A"},{"sku":"B"},{"sku":"C"}]},` +
+		`{"op":"add","path":"/note","value":null},` +
+		`{"op":"remove","path":"/status"},` +
+		`{"op":"replace","path":"/total","value":12.5}]`
+	if string(raw) != want {
+		t.Errorf("JSONPatch() =\n%s\nwant\n%s", raw, want)
+	}
+
+	if got := applyPatch(t, expected, ops); !reflect.DeepEqual(got, mustDecode(t, actual)) {
+		t.Errorf("applying the patch gave %v", got)
+	}
+}
+
+func TestJSONPatchKeyedArrays(t *testing.T) {
+	expected := []byte(`{"items": [{"id": "A", "qty": 1}, {"id": "B", "qty": 2}]}`)
+	actual := []byte(`{"items": [{"id": "B", "qty": 3}, {"id": "A", "qty": 1}]}`)
+
+	ops, err := JSONPatch(expected, actual, ArraysByKey("id", "$.items"))
+	if err != nil {
+		t.Fatalf("JSONPatch() error = %v", err)
+	}
+	if len(ops) != 1 || ops[0].Op != "replace" || ops[0].Path != "/items" {
+		t.Fatalf("JSONPatch() = %+v, want a single replace of /items", ops)
+	}
+	if got := applyPatch(t, expected, ops); !reflect.DeepEqual(got, mustDecode(t, actual)) {
+		t.Errorf("applying the patch gave %v", got)
+	}
+}
+
+func TestJSONPatchHonoursOptions(t *testing.T) {
+	ops, err := JSONPatch([]byte(`{"at": "t1", "v": 1}`), []byte(`{"at": "t2", "v": 1.001}`),
+		IgnorePaths("$.at"), Tolerance(0.01, 0))
+	if err != nil {
+		t.Fatalf("JSONPatch() error = %v", err)
+	}
+	if len(ops) != 0 {
+		t.Errorf("JSONPatch() = %+v, want no ops", ops)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	expected := []byte(`{"id": "ORD-1", "total": 10, "status": "new"}`)
+	actual := []byte(`{"status": "paid", "id": "ORD-1", "total": 10}`)
+
+	got, err := UnifiedDiff(expected, actual, false)
+	if err != nil {
+		t.Fatalf("UnifiedDiff() error = %v", err)
+	}
+	want := strings.Join([]string{
+		"--- expected",
+		"+++ actual",
+		"@@ -1,5 +1,5 @@",
+		" {",
+		`   "id": "ORD-1",`,
+		`-  "status": "new",`,
+		`+  "status": "paid",`,
+		`   "total": 10`,
+		" }",
+		"",
+	}, "\n")
+	if got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	colored, _ := UnifiedDiff(expected, actual, true)
+	if !strings.Contains(colored, ansiRed+`-  "status": "new",`+ansiReset) {
+		t.Errorf("UnifiedDiff(color) should paint removed lines red:\n%q", colored)
+	}
+
+	if same, _ := UnifiedDiff(expected, expected, false); same != "" {
+		t.Errorf("UnifiedDiff() of equal documents = %q, want empty", same)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, strconv.Itoa(i))
+		b = append(b, strconv.Itoa(i))
+	}
+	b[2], b[17] = "x", "y"
+
+	edits, ok := lineEdits(a, b)
+	if !ok {
+		t.Fatal("lineEdits() should align 20 lines")
+	}
+	hunks := groupHunks(edits, 3)
+	if len(hunks) != 2 {
+		t.Fatalf("groupHunks() returned %d hunks, want 2", len(hunks))
+	}
+	if h := hunks[0].header(); h != "@@ -1,6 +1,6 @@" {
+		t.Errorf("first hunk header = %s", h)
+	}
+	if h := hunks[1].header(); h != "@@ -15,6 +15,6 @@" {
+		t.Errorf("second hunk header = %s", h)
+	}
+}
+
+func mustDecode(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	v, err := decodeJSON(data)
+	if err != nil {
+		t.Fatalf("decodeJSON() error = %v", err)
+	}
+	return v
+}
+
+// applyPatch applies add, remove and replace operations on object members
+// and whole values, enough to check JSONPatch round trips.
+func applyPatch(t *testing.T, doc []byte, ops []PatchOp) interface{} {
+	t.Helper()
+	root := mustDecode(t, doc)
+	for _, op := range ops {
+		raw, _ := json.Marshal(op.Value)
+		value := mustDecode(t, raw)
+
+		tokens := strings.Split(op.Path, "/")[1:]
+		parent := root
+		for _, tok := range tokens[:len(tokens)-1] {
+			parent = parent.(map[string]interface{})[unescapePointer(tok)]
+		}
+		key := unescapePointer(tokens[len(tokens)-1])
+		obj := parent.(map[string]interface{})
+		if op.Op == "remove" {
+			delete(obj, key)
+		} else {
+			obj[key] = value
+		}
+	}
+	return root
+}
+
+func unescapePointer(tok string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	catalog := func(n, offset int) json.RawMessage {
+		items := make([]int, n)
+		for i := range items {
+			items[i] = i + offset
+		}
+		b, _ := json.Marshal(map[string]interface{}{"items": items})
+		return b
+	}
+
+	// Shared leading and trailing lines are matched without the LCS table.
+	big := catalog(50000, 0)
+	changed := append(json.RawMessage{}, big...)
+	changed = json.RawMessage(strings.Replace(string(changed), "[0,", "[-1,", 1))
+	out, err := UnifiedDiff(big, changed, false)
+	if err != nil || !strings.Contains(out, "-    0,") || !strings.Contains(out, "+    -1,") {
+		t.Errorf("UnifiedDiff() = %.200q, %v", out, err)
+	}
+
+	if _, err := UnifiedDiff(catalog(5000, 0), catalog(5000, 1000000), false); !IsDiffTooLarge(err) {
+		t.Errorf("err = %v, want ErrDiffTooLarge", err)
+	}
+}
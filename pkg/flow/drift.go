@@ -0,0 +1,457 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DriftKind classifies a drift finding.
+type DriftKind string
+
+const (
+	DriftMissingPoint DriftKind = "missing_point"
+	DriftNewPoint     DriftKind = "new_point"
+	DriftMissingField DriftKind = "missing_field"
+	DriftNewField     DriftKind = "new_field"
+	DriftTypeChanged  DriftKind = "type_changed"
+	DriftCountChanged DriftKind = "count_changed"
+)
+
+// DriftFinding is a change in the shape of a run compared to its baseline.
+// Side is "expected" for point payloads and "actual" for the assertions
+// paired with them. New points and fields are warnings and everything else
+// is an error.
+type DriftFinding struct {
+	Kind     DriftKind `json:"kind"`
+	Point    string    `json:"point,omitempty"`
+	Side     string    `json:"side,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Baseline string    `json:"baseline,omitempty"`
+	Current  string    `json:"current,omitempty"`
+	Message  string    `json:"message"`
+	Severity Severity  `json:"severity"`
+}
+
+// FieldProfile records the types a field had and in how many runs it appeared.
+type FieldProfile struct {
+	Types []string `json:"types"`
+	Seen  int      `json:"seen"`
+}
+
+// PointProfile is the shape of one point across runs. Seen counts the runs
+// that created the point and ActualSeen those where an assertion was paired
+// with it.
+type PointProfile struct {
+	Description string                   `json:"description"`
+	Seen        int                      `json:"seen"`
+	ActualSeen  int                      `json:"actual_seen"`
+	Expected    map[string]*FieldProfile `json:"expected"`
+	Actual      map[string]*FieldProfile `json:"actual"`
+}
+
+// ShapeProfile is the shape of the points and assertions of one or more runs
+// of a flow name: keys, types, point descriptions and counts. Assertions are
+// paired with points by position, as Finish does. A description repeated in
+// a run is keyed "description #2", "#3", ...
+type ShapeProfile struct {
+	FlowName        string                   `json:"flow_name"`
+	Runs            int                      `json:"runs"`
+	PointCounts     []int                    `json:"point_counts"`
+	AssertionCounts []int                    `json:"assertion_counts"`
+	Points          map[string]*PointProfile `json:"points"`
+}
+
+// NewShapeProfile returns an empty profile for flowName.
+func NewShapeProfile(flowName string) *ShapeProfile {
+	return &ShapeProfile{FlowName: flowName, Points: map[string]*PointProfile{}}
+}
+
+// AddRun adds the points and assertions of one run to the profile.
+func (p *ShapeProfile) AddRun(points []Point, assertions []Assertion) error {
+	keys, expected, actual, err := runShapes(points, assertions)
+	if err != nil {
+		return err
+	}
+
+	p.Runs++
+	p.PointCounts = addCount(p.PointCounts, len(points))
+	p.AssertionCounts = addCount(p.AssertionCounts, len(assertions))
+	for i, key := range keys {
+		pp := p.Points[key]
+		if pp == nil {
+			pp = &PointProfile{Description: points[i].Description, Expected: map[string]*FieldProfile{}, Actual: map[string]*FieldProfile{}}
+			p.Points[key] = pp
+		}
+		pp.Seen++
+		mergeFields(pp.Expected, expected[i])
+		if actual[i] != nil {
+			pp.ActualSeen++
+			mergeFields(pp.Actual, actual[i])
+		}
+	}
+	return nil
+}
+
+// Drift compares a run against the profile. Fields are reported missing only
+// if they appeared in every profiled run of their point; changes below a
+// reported path are folded into it. Assertion counts are not checked for runs
+// without assertions yet.
+func (p *ShapeProfile) Drift(points []Point, assertions []Assertion) ([]DriftFinding, error) {
+	keys, expected, actual, err := runShapes(points, assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []DriftFinding
+	if !containsInt(p.PointCounts, len(points)) {
+		findings = append(findings, DriftFinding{
+			Kind: DriftCountChanged, Side: "expected", Severity: SeverityError,
+			Baseline: formatCounts(p.PointCounts), Current: fmt.Sprint(len(points)),
+			Message: fmt.Sprintf("%d points, baseline had %s", len(points), formatCounts(p.PointCounts)),
+		})
+	}
+	if len(assertions) > 0 && !containsInt(p.AssertionCounts, len(assertions)) {
+		findings = append(findings, DriftFinding{
+			Kind: DriftCountChanged, Side: "actual", Severity: SeverityError,
+			Baseline: formatCounts(p.AssertionCounts), Current: fmt.Sprint(len(assertions)),
+			Message: fmt.Sprintf("%d assertions, baseline had %s", len(assertions), formatCounts(p.AssertionCounts)),
+		})
+	}
+
+	current := map[string]bool{}
+	for i, key := range keys {
+		current[key] = true
+		pp := p.Points[key]
+		if pp == nil {
+			findings = append(findings, DriftFinding{
+				Kind: DriftNewPoint, Point: key, Severity: SeverityWarning,
+				Message: fmt.Sprintf("point %q is not in the baseline", key),
+			})
+			continue
+		}
+		findings = append(findings, fieldDrift(key, "expected", pp.Expected, pp.Seen, expected[i])...)
+		if actual[i] != nil && pp.ActualSeen > 0 {
+			findings = append(findings, fieldDrift(key, "actual", pp.Actual, pp.ActualSeen, actual[i])...)
+		}
+	}
+
+	for _, key := range sortedProfileKeys(p.Points) {
+		if !current[key] && p.Points[key].Seen == p.Runs {
+			findings = append(findings, DriftFinding{
+				Kind: DriftMissingPoint, Point: key, Severity: SeverityError,
+				Message: fmt.Sprintf("point %q is missing", key),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// DriftReport is the result of FlowClient.DetectDrift.
+type DriftReport struct {
+	FlowID       int64          `json:"flow_id"`
+	FlowName     string         `json:"flow_name"`
+	BaselineRuns []int64        `json:"baseline_runs"`
+	Findings     []DriftFinding `json:"findings"`
+}
+
+// DriftOption selects the baseline of DetectDrift.
+type DriftOption func(*driftConfig)
+
+type driftConfig struct {
+	baselineID int64
+	window     int
+}
+
+// defaultDriftWindow is the number of previous runs profiled by default.
+const defaultDriftWindow = 20
+
+// AgainstRun compares with a single baseline run, which must be a run of the
+// same flow name.
+func AgainstRun(flowID int64) DriftOption {
+	return func(c *driftConfig) { c.baselineID = flowID }
+}
+
+// AgainstRecent compares with a profile of the last n finished runs of the
+// same flow name that started before the compared run (20 by default).
+func AgainstRecent(n int) DriftOption {
+	return func(c *driftConfig) { c.window = n }
+}
+
+// DetectDrift compares the shape of a run with a baseline run or with the
+// profile of recent runs of the same flow name.
+func (c *FlowClient) DetectDrift(ctx context.Context, flowID int64, opts ...DriftOption) (*DriftReport, error) {
+	cfg := driftConfig{window: defaultDriftWindow}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	f, err := c.storage.FindFlowByID(ctx, flowID)
+	if err != nil {
+		return nil, err
+	}
+	wrap := func(err error) error {
+		return &FlowError{Op: "DetectDrift", FlowName: f.Name, Err: err}
+	}
+
+	baseline := []int64{cfg.baselineID}
+	if cfg.baselineID != 0 {
+		b, err := c.storage.FindFlowByID(ctx, cfg.baselineID)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		if b.Name != f.Name {
+			return nil, wrap(&ConfigError{msg: fmt.Sprintf("baseline run %d belongs to flow %q, not %q", b.ID, b.Name, f.Name)})
+		}
+	} else {
+		if cfg.window <= 0 {
+			return nil, wrap(&ConfigError{msg: "drift window must be positive"})
+		}
+		if baseline, err = c.storage.RecentFlowIDs(ctx, f.Name, flowID, cfg.window); err != nil {
+			return nil, wrap(err)
+		}
+	}
+	if len(baseline) == 0 {
+		return nil, wrap(ErrNoBaseline)
+	}
+
+	profile := NewShapeProfile(f.Name)
+	for _, id := range baseline {
+		points, assertions, err := c.storage.FetchPointsAndAssertions(ctx, id)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		if err := c.decryptRun(ctx, points, assertions); err != nil {
+			return nil, wrap(fmt.Errorf("baseline run %d: %w", id, err))
+		}
+		if err := profile.AddRun(points, assertions); err != nil {
+			return nil, wrap(fmt.Errorf("baseline run %d: %w", id, err))
+		}
+	}
+
+	points, assertions, err := c.storage.FetchPointsAndAssertions(ctx, flowID)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if err := c.decryptRun(ctx, points, assertions); err != nil {
+		return nil, wrap(err)
+	}
+	findings, err := profile.Drift(points, assertions)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &DriftReport{FlowID: flowID, FlowName: f.Name, BaselineRuns: baseline, Findings: findings}, nil
+}
+
+// runShapes keys the points of a run and flattens the expected payloads and
+// the paired actual payloads (nil when unpaired) into path -> type.
+func runShapes(points []Point, assertions []Assertion) ([]string, []map[string]string, []map[string]string, error) {
+	keys := make([]string, len(points))
+	expected := make([]map[string]string, len(points))
+	actual := make([]map[string]string, len(points))
+	occurrences := map[string]int{}
+	for i, p := range points {
+		occurrences[p.Description]++
+		keys[i] = p.Description
+		if n := occurrences[p.Description]; n > 1 {
+			keys[i] = fmt.Sprintf("%s #%d", p.Description, n)
+		}
+
+		v, err := decodeJSON(p.Expected)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("point %d (%s): failed to unmarshal expected: %w", p.ID, p.Description, err)
+		}
+		expected[i] = map[string]string{}
+		flattenShape(v, "$", expected[i])
+
+		if i < len(assertions) {
+			v, err := decodeJSON(assertions[i].Actual)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("assertion %d: failed to unmarshal actual: %w", assertions[i].ID, err)
+			}
+			actual[i] = map[string]string{}
+			flattenShape(v, "$", actual[i])
+		}
+	}
+	return keys, expected, actual, nil
+}
+
+// flattenShape records the type of every path in v; array elements share the
+// path "[*]", whose types are joined into a sorted union such as
+// "number|string". Integers count as numbers and matchers as the type they
+// accept.
+func flattenShape(v interface{}, path string, out map[string]string) {
+	if m, ok := matcherFrom(v); ok {
+		switch m.Kind {
+		case MatchAny:
+			addShapeType(out, path, "any")
+		case MatchNumber, MatchBetween:
+			addShapeType(out, path, "number")
+		default:
+			addShapeType(out, path, "string")
+		}
+		return
+	}
+
+	t := getTypeName(v)
+	if t == "integer" {
+		t = "number"
+	}
+	addShapeType(out, path, t)
+
+	switch val := v.(type) {
+	case []interface{}:
+		for _, item := range val {
+			flattenShape(item, path+"[*]", out)
+		}
+	case map[string]interface{}:
+		for k, item := range val {
+			flattenShape(item, path+"."+k, out)
+		}
+	}
+}
+
+// addShapeType adds t to the type union recorded for path.
+func addShapeType(out map[string]string, path, t string) {
+	prev, ok := out[path]
+	if !ok {
+		out[path] = t
+		return
+	}
+	types := strings.Split(prev, "|")
+	if containsString(types, t) {
+		return
+	}
+	types = append(types, t)
+	sort.Strings(types)
+	out[path] = strings.Join(types, "|")
+}
+
+func mergeFields(fields map[string]*FieldProfile, shape map[string]string) {
+	for path, t := range shape {
+		f := fields[path]
+		if f == nil {
+			f = &FieldProfile{}
+			fields[path] = f
+		}
+		f.Seen++
+		for _, part := range strings.Split(t, "|") {
+			if !containsString(f.Types, part) {
+				f.Types = append(f.Types, part)
+			}
+		}
+		sort.Strings(f.Types)
+	}
+}
+
+func fieldDrift(point, side string, baseline map[string]*FieldProfile, runs int, current map[string]string) []DriftFinding {
+	var findings []DriftFinding
+	var reported []string
+	folded := func(path string) bool {
+		for _, r := range reported {
+			if strings.HasPrefix(path, r+".") || strings.HasPrefix(path, r+"[") {
+				return true
+			}
+		}
+		return false
+	}
+
+	paths := make([]string, 0, len(baseline)+len(current))
+	for path := range baseline {
+		paths = append(paths, path)
+	}
+	for path := range current {
+		if baseline[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if folded(path) {
+			continue
+		}
+		f, t := baseline[path], current[path]
+		var d DriftFinding
+		switch {
+		case f == nil:
+			d = DriftFinding{Kind: DriftNewField, Current: t, Severity: SeverityWarning,
+				Message: fmt.Sprintf("new field %s (%s)", path, t)}
+		case t == "":
+			if f.Seen < runs {
+				continue
+			}
+			d = DriftFinding{Kind: DriftMissingField, Baseline: strings.Join(f.Types, "|"), Severity: SeverityError,
+				Message: fmt.Sprintf("field %s is missing", path)}
+		case !typesCovered(f.Types, t):
+			d = DriftFinding{Kind: DriftTypeChanged, Baseline: strings.Join(f.Types, "|"), Current: t, Severity: SeverityError,
+				Message: fmt.Sprintf("field %s changed type from %s to %s", path, strings.Join(f.Types, "|"), t)}
+		default:
+			continue
+		}
+		d.Point, d.Side, d.Path = point, side, path
+		d.Message = fmt.Sprintf("%s %s: %s", point, side, d.Message)
+		findings = append(findings, d)
+		reported = append(reported, path)
+	}
+	return findings
+}
+
+// typesCovered reports whether every type in t was seen in the baseline. An
+// "any" matcher on either side accepts every type.
+func typesCovered(baseline []string, t string) bool {
+	if containsString(baseline, "any") {
+		return true
+	}
+	for _, part := range strings.Split(t, "|") {
+		if part != "any" && !containsString(baseline, part) {
+			return false
+		}
+	}
+	return true
+}
+
+func addCount(counts []int, n int) []int {
+	if containsInt(counts, n) {
+		return counts
+	}
+	counts = append(counts, n)
+	sort.Ints(counts)
+	return counts
+}
+
+func formatCounts(counts []int) string {
+	parts := make([]string, len(counts))
+	for i, n := range counts {
+		parts[i] = fmt.Sprint(n)
+	}
+	return strings.Join(parts, " or ")
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedProfileKeys(m map[string]*PointProfile) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
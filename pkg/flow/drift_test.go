@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func driftRun(pairs ...string) ([]Point, []Assertion) {
+	var points []Point
+	var assertions []Assertion
+	for i := 0; i+2 < len(pairs); i += 3 {
+		points = append(points, Point{ID: int64(i), Description: pairs[i], Expected: json.RawMessage(pairs[i+1])})
+		if pairs[i+2] != "" {
+			assertions = append(assertions, Assertion{ID: int64(i), Actual: json.RawMessage(pairs[i+2])})
+		}
+	}
+	return points, assertions
+}
+
+func TestShapeProfileDrift(t *testing.T) {
+	profile := NewShapeProfile("Order Processing")
+	for _, run := range [][]string{
+		{"Created", `{"id": "A", "total": 10, "customer": {"id": 1}}`, `{"id": "A", "total": 10, "customer": {"id": 1}}`,
+			"Paid", `{"paid": true}`, `{"paid": true}`},
+		{"Created", `{"id": "B", "total": 10.5, "customer": {"id": 2}, "note": "x"}`, `{"id": "B", "total": 10.5, "customer": {"id": 2}}`,
+			"Paid", `{"paid": true}`, `{"paid": true}`},
+	} {
+		points, assertions := driftRun(run...)
+		if err := profile.AddRun(points, assertions); err != nil {
+			t.Fatalf("AddRun() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		run  []string
+		want []DriftKind
+	}{
+		{"Same shape", []string{
+			"Created", `{"id": "C", "total": 3, "customer": {"id": 3}}`, `{"id": "C", "total": 3, "customer": {"id": 3}}`,
+			"Paid", `{"paid": false}`, `{"paid": false}`}, nil},
+		{"Missing and retyped fields", []string{
+			"Created", `{"id": 7, "total": 3}`, `{"id": "C", "total": "3", "customer": {"id": 3}}`,
+			"Paid", `{"paid": true}`, `{"paid": true}`},
+			[]DriftKind{DriftMissingField, DriftTypeChanged, DriftTypeChanged}},
+		{"New field", []string{
+			"Created", `{"id": "C", "total": 3, "customer": {"id": 3, "vip": true}}`, `{"id": "C", "total": 3, "customer": {"id": 3}}`,
+			"Paid", `{"paid": true}`, `{"paid": true}`},
+			[]DriftKind{DriftNewField}},
+		{"Missing and new points", []string{
+			"Created", `{"id": "C", "total": 3, "customer": {"id": 3}}`, `{"id": "C", "total": 3, "customer": {"id": 3}}`,
+			"Refunded", `{"paid": false}`, ""},
+			[]DriftKind{DriftCountChanged, DriftNewPoint, DriftMissingPoint}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, assertions := driftRun(tt.run...)
+			findings, err := profile.Drift(points, assertions)
+			if err != nil {
+				t.Fatalf("Drift() error = %v", err)
+			}
+			var kinds []DriftKind
+			for _, f := range findings {
+				kinds = append(kinds, f.Kind)
+				want := SeverityError
+				if f.Kind == DriftNewField || f.Kind == DriftNewPoint {
+					want = SeverityWarning
+				}
+				if f.Severity != want {
+					t.Errorf("%s finding severity = %q, want %q", f.Kind, f.Severity, want)
+				}
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("Drift() = %+v, want kinds %v", findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeProfileDriftDetails(t *testing.T) {
+	profile := NewShapeProfile("Order Processing")
+	points, assertions := driftRun("Created", `{"customer": {"id": 1, "name": "a"}}`, `{"customer": {"id": 1}}`)
+	profile.AddRun(points, assertions)
+
+	points, assertions = driftRun("Created", `{"customer": "C-1"}`, `{"customer": {"id": 1}}`)
+	findings, _ := profile.Drift(points, assertions)
+	want := DriftFinding{
+		Kind: DriftTypeChanged, Point: "Created", Side: "expected", Path: "$.customer",
+		Baseline: "object", Current: "string", Severity: SeverityError,
+		Message: "Created expected: field $.customer changed type from object to string",
+	}
+	if len(findings) != 1 || !reflect.DeepEqual(findings[0], want) {
+		t.Errorf("Drift() = %+v, want only %+v (children folded into the parent)", findings, want)
+	}
+}
+
+func TestFlattenShapeUnions(t *testing.T) {
+	v, _ := decodeJSON([]byte(`{"items": ["a", 1, "b", 2.5, null, {"$flow_matcher": "any"}], "ids": [1, 2, 3]}`))
+	got := map[string]string{}
+	flattenShape(v, "$", got)
+	want := map[string]string{
+		"$":          "object",
+		"$.items":    "array",
+		"$.items[*]": "any|null|number|string",
+		"$.ids":      "array",
+		"$.ids[*]":   "number",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenShape() = %v, want %v", got, want)
+	}
+}
+
+func TestShapeProfileOptionalFields(t *testing.T) {
+	profile := NewShapeProfile("Order Processing")
+	for _, expected := range []string{`{"id": 1, "note": "x"}`, `{"id": 2}`} {
+		points, _ := driftRun("Created", expected, "")
+		profile.AddRun(points, nil)
+	}
+	points, _ := driftRun("Created", `{"id": 3}`, "")
+	if findings, _ := profile.Drift(points, nil); len(findings) != 0 {
+		t.Errorf("Drift() = %+v, optional fields should not drift", findings)
+	}
+
+	points, _ = driftRun("Created", `{"note": "y"}`, "")
+	if findings, _ := profile.Drift(points, nil); len(findings) != 1 || findings[0].Path != "$.id" {
+		t.Errorf("Drift() = %+v, want $.id missing", findings)
+	}
+}
+
+func TestShapeProfileRepeatedDescriptions(t *testing.T) {
+	profile := NewShapeProfile("Batch")
+	points, _ := driftRun("Item", `{"n": 1}`, "", "Item", `{"n": 2}`, "")
+	profile.AddRun(points, nil)
+	if _, ok := profile.Points["Item #2"]; !ok {
+		t.Errorf("Points = %v, want a key for the second occurrence", profile.Points)
+	}
+}
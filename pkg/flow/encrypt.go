@@ -0,0 +1,324 @@
+package flow
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// payloadEncrypted marks payloads encrypted at rest:
+// {"$flow_payload": "encrypted", "key": "<id>", "nonce": "<base64>", "data": "<base64>"}.
+const payloadEncrypted = "encrypted"
+
+// KeyProvider supplies the AES-256 keys payloads are encrypted with. Keys are
+// identified so payloads written before a rotation can still be decrypted.
+type KeyProvider interface {
+	// CurrentKey returns the key new payloads are encrypted with.
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns the key with the given id.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// KeyFile is a KeyProvider reading a JSON file of base64 keys:
+//
+//	{"current": "2026-10", "keys": {"2026-04": "…", "2026-10": "…"}}
+//
+// To rotate, add a key, make it current and call Reload (or restart); keep
+// the old key until FlowClient.RotateKeys has re-encrypted its payloads.
+type KeyFile struct {
+	path string
+
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyFile loads the keys at path.
+func NewKeyFile(path string) (*KeyFile, error) {
+	kf := &KeyFile{path: path}
+	if err := kf.Reload(); err != nil {
+		return nil, err
+	}
+	return kf, nil
+}
+
+// Reload reads the key file again.
+func (kf *KeyFile) Reload() error {
+	data, err := os.ReadFile(kf.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse key file %s: %w", kf.path, err)
+	}
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("key file %s: key %q must be 32 bytes of base64", kf.path, id)
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("key file %s: current key %q is not defined", kf.path, file.Current)
+	}
+
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	kf.current, kf.keys = file.Current, keys
+	return nil
+}
+
+func (kf *KeyFile) CurrentKey(ctx context.Context) (string, []byte, error) {
+	kf.mu.RLock()
+	defer kf.mu.RUnlock()
+	return kf.current, kf.keys[kf.current], nil
+}
+
+func (kf *KeyFile) Key(ctx context.Context, id string) ([]byte, error) {
+	kf.mu.RLock()
+	defer kf.mu.RUnlock()
+	key, ok := kf.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q: %w", id, ErrPayloadEncrypted)
+	}
+	return key, nil
+}
+
+// encryptPayload seals data with the current key of keys. A nil provider
+// leaves it unchanged.
+func encryptPayload(ctx context.Context, keys KeyProvider, data []byte) ([]byte, error) {
+	if keys == nil || data == nil {
+		return data, nil
+	}
+	id, key, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %q: %w", id, err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return json.Marshal(payloadMarker{
+		Kind:  payloadEncrypted,
+		Key:   id,
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		Data:  base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, data, []byte(id))),
+	})
+}
+
+// decryptPayload opens data if it is encrypted, reporting the id of its key.
+func decryptPayload(ctx context.Context, keys KeyProvider, data []byte) ([]byte, string, error) {
+	m, ok := parsePayloadMarker(data)
+	if !ok || m.Kind != payloadEncrypted {
+		return data, "", nil
+	}
+	if keys == nil {
+		return nil, m.Key, fmt.Errorf("no key provider configured: %w", ErrPayloadEncrypted)
+	}
+	key, err := keys.Key(ctx, m.Key)
+	if err != nil {
+		return nil, m.Key, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, m.Key, fmt.Errorf("encryption key %q: %w", m.Key, err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(m.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, m.Key, fmt.Errorf("invalid nonce of encrypted payload")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(m.Data)
+	if err != nil {
+		return nil, m.Key, fmt.Errorf("invalid encrypted payload: %w", err)
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(m.Key))
+	if err != nil {
+		return nil, m.Key, fmt.Errorf("failed to decrypt payload with key %q: %w", m.Key, err)
+	}
+	return plain, m.Key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AES-256 keys are 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// DecryptPayload returns the document of a stored payload, decrypting it with
+// keys and decompressing it as needed.
+func DecryptPayload(ctx context.Context, keys KeyProvider, stored json.RawMessage) (json.RawMessage, error) {
+	plain, _, err := decryptPayload(ctx, keys, stored)
+	if err != nil {
+		return nil, err
+	}
+	return OpenPayload(plain)
+}
+
+// decryptRun decrypts the payloads of a run in memory. Storage keeps them
+// encrypted; only the client holding the keys sees them.
+func (c *FlowClient) decryptRun(ctx context.Context, points []Point, assertions []Assertion) error {
+	for i := range points {
+		p := &points[i]
+		if err := c.decryptInto(ctx, &p.Expected, &p.Raw); err != nil {
+			return fmt.Errorf("point %d: %w", p.ID, err)
+		}
+	}
+	for i := range assertions {
+		a := &assertions[i]
+		if err := c.decryptInto(ctx, &a.Actual, &a.Raw); err != nil {
+			return fmt.Errorf("assertion %d: %w", a.ID, err)
+		}
+	}
+	return nil
+}
+
+func (c *FlowClient) decryptInto(ctx context.Context, doc *json.RawMessage, raw *[]byte) error {
+	if len(*doc) > 0 {
+		opened, err := DecryptPayload(ctx, c.Config.Encryption, *doc)
+		if err != nil {
+			return err
+		}
+		*doc = opened
+	}
+	if len(*raw) > 0 {
+		plain, _, err := decryptPayload(ctx, c.Config.Encryption, *raw)
+		if err != nil {
+			return err
+		}
+		*raw = plain
+	}
+	return nil
+}
+
+// rotateBatch bounds the rows RotateKeys re-encrypts per query.
+const rotateBatch = 500
+
+// RotationFailure is a stored payload RotateKeys could not re-encrypt.
+type RotationFailure struct {
+	Table string
+	ID    int64
+	Err   error
+}
+
+// RotationError lists the payloads RotateKeys skipped; every other stale
+// payload was re-encrypted.
+type RotationError struct {
+	Failures []RotationFailure
+}
+
+// maxListedFailures bounds the rows named by RotationError.Error.
+const maxListedFailures = 10
+
+func (e *RotationError) Error() string {
+	rows := make([]string, 0, maxListedFailures)
+	for i, f := range e.Failures {
+		if i == maxListedFailures {
+			rows = append(rows, "...")
+			break
+		}
+		rows = append(rows, fmt.Sprintf("%s %d", f.Table, f.ID))
+	}
+	return fmt.Sprintf("%d payloads could not be re-encrypted (%s): %v",
+		len(e.Failures), strings.Join(rows, ", "), e.Failures[0].Err)
+}
+
+func (e *RotationError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// RotateKeys re-encrypts stored payloads whose key is not the current key of
+// the provider, so old keys can be retired. It returns the number of rows
+// rewritten. Rows that cannot be decrypted are skipped and reported together
+// in a *RotationError once every other row is rotated. Each row is rewritten
+// on its own, so a rotation interrupted by a storage error can be run again.
+func (c *FlowClient) RotateKeys(ctx context.Context) (int, error) {
+	keys := c.Config.Encryption
+	if keys == nil {
+		return 0, &FlowError{Op: "RotateKeys", Err: &ConfigError{msg: "no key provider configured"}}
+	}
+	current, _, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return 0, &FlowError{Op: "RotateKeys", Err: err}
+	}
+
+	total := 0
+	var failed []RotationFailure
+	for _, table := range []string{"points", "assertions"} {
+		var after int64
+		for {
+			rows, err := c.storage.FetchStaleEncrypted(ctx, table, current, after, rotateBatch)
+			if err != nil {
+				return total, &FlowError{Op: "RotateKeys", Err: err}
+			}
+			for _, row := range rows {
+				after = row.id
+				if err := rotateRow(ctx, keys, current, &row); err != nil {
+					failed = append(failed, RotationFailure{Table: table, ID: row.id, Err: err})
+					continue
+				}
+				if err := c.storage.UpdateEncrypted(ctx, table, row); err != nil {
+					return total, &FlowError{Op: "RotateKeys", Err: err}
+				}
+				total++
+			}
+			if len(rows) < rotateBatch {
+				break
+			}
+		}
+	}
+	c.logger.Info("Re-encrypted %d payloads with key '%s'", total, current)
+	if len(failed) > 0 {
+		return total, &FlowError{Op: "RotateKeys", Err: &RotationError{Failures: failed}}
+	}
+	return total, nil
+}
+
+// rotateRow re-encrypts the payload and raw bytes of row with the current
+// key, leaving row unchanged on error.
+func rotateRow(ctx context.Context, keys KeyProvider, current string, row *encryptedRow) error {
+	reencrypt := func(data []byte) ([]byte, error) {
+		if len(data) == 0 {
+			return data, nil
+		}
+		plain, id, err := decryptPayload(ctx, keys, data)
+		if err != nil || id == current {
+			return data, err
+		}
+		return encryptPayload(ctx, keys, plain)
+	}
+	payload, err := reencrypt(row.payload)
+	if err != nil {
+		return err
+	}
+	raw, err := reencrypt(row.raw)
+	if err != nil {
+		return err
+	}
+	row.payload, row.raw = payload, raw
+	return nil
+}
@@ -0,0 +1,220 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, path, current string, ids ...string) {
+	t.Helper()
+	keys := map[string]string{}
+	for _, id := range ids {
+		keys[id] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[:1]), 32))
+	}
+	data, _ := json.Marshal(map[string]interface{}{"current": current, "keys": keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyFileRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "a1", "a1")
+	kf, err := NewKeyFile(path)
+	if err != nil {
+		t.Fatalf("NewKeyFile() error = %v", err)
+	}
+
+	doc := json.RawMessage(`{"customer": "ada", "total": 10}`)
+	old, err := encryptPayload(ctx, kf, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(old, []byte("ada")) {
+		t.Fatalf("encrypted payload leaks plaintext: %s", old)
+	}
+
+	writeKeyFile(t, path, "b2", "a1", "b2")
+	if err := kf.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	current, err := encryptPayload(ctx, kf, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, sealed := range map[string][]byte{"old key": old, "current key": current} {
+		plain, err := DecryptPayload(ctx, kf, sealed)
+		if err != nil || string(plain) != string(doc) {
+			t.Errorf("%s: DecryptPayload() = %s, %v", name, plain, err)
+		}
+	}
+	if _, id, _ := decryptPayload(ctx, kf, current); id != "b2" {
+		t.Errorf("new payloads use key %q, want b2", id)
+	}
+
+	// Once the old key is retired, its payloads can no longer be read.
+	writeKeyFile(t, path, "b2", "b2")
+	kf.Reload()
+	if _, err := DecryptPayload(ctx, kf, old); !IsPayloadEncrypted(err) {
+		t.Errorf("retired key: err = %v, want ErrPayloadEncrypted", err)
+	}
+	if _, err := DecryptPayload(ctx, nil, current); !IsPayloadEncrypted(err) {
+		t.Errorf("no provider: err = %v, want ErrPayloadEncrypted", err)
+	}
+}
+
+func TestKeyFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"missing current": `{"current": "k2", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(make([]byte, 32)) + `"}}`,
+		"short key":       `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(make([]byte, 16)) + `"}}`,
+		"not json":        `current: k1`,
+	}
+	for name, content := range cases {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_"))
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := NewKeyFile(path); err == nil {
+			t.Errorf("%s: NewKeyFile() should fail", name)
+		}
+	}
+}
+
+func TestEncryptedPayloadTampering(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1", "x9")
+	kf, _ := NewKeyFile(path)
+
+	sealed, _ := encryptPayload(ctx, kf, []byte(`{"id": 1}`))
+	var m map[string]string
+	json.Unmarshal(sealed, &m)
+	m["key"] = "x9" // the key id is authenticated
+	swapped, _ := json.Marshal(m)
+	if _, err := DecryptPayload(ctx, kf, swapped); err == nil {
+		t.Error("DecryptPayload() should reject a payload whose key id was changed")
+	}
+}
+
+func TestDecryptRun(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1")
+	kf, _ := NewKeyFile(path)
+	c := &FlowClient{Config: FlowConfig{Encryption: kf}}
+
+	// Compression runs before encryption, so payloads are opened after it.
+	doc := json.RawMessage(`{"text": "` + strings.Repeat("abc", 200) + `"}`)
+	compressed, _, _ := payloadPolicy{compressAbove: 100}.seal(doc)
+	expected, _ := encryptPayload(ctx, kf, compressed)
+	actual, _ := encryptPayload(ctx, kf, doc)
+	raw, _ := encryptPayload(ctx, kf, []byte("<order/>"))
+
+	points := []Point{{ID: 1, Expected: expected, Raw: raw}}
+	assertions := []Assertion{{ID: 2, Actual: actual}}
+	if err := c.decryptRun(ctx, points, assertions); err != nil {
+		t.Fatalf("decryptRun() error = %v", err)
+	}
+	if string(points[0].Raw) != "<order/>" {
+		t.Errorf("raw = %s", points[0].Raw)
+	}
+	if diffs, equal := DeepCompare(points[0].Expected, assertions[0].Actual); !equal {
+		t.Errorf("decrypted payloads should compare equal: %v", diffs)
+	}
+
+	c.Config.Encryption = nil
+	points[0].Expected = expected
+	if err := c.decryptRun(ctx, points, nil); !IsPayloadEncrypted(err) {
+		t.Errorf("decryptRun() without keys: err = %v, want ErrPayloadEncrypted", err)
+	}
+}
+
+func TestInferSchemasFromEncryptedPoints(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1")
+	kf, _ := NewKeyFile(path)
+
+	var points []Point
+	for i, doc := range []string{`{"id": "A", "total": 10}`, `{"id": "B", "total": 12.5}`} {
+		sealed, _ := encryptPayload(ctx, kf, []byte(doc))
+		points = append(points, Point{ID: int64(i + 1), Description: "Created", Expected: sealed})
+	}
+	stored := func() []Point { return append([]Point(nil), points...) }
+
+	c := &FlowClient{Config: FlowConfig{Encryption: kf}}
+	schemas, err := c.inferSchemas(ctx, "Order Processing", stored())
+	if err != nil || len(schemas) != 1 || schemas[0].Samples != 2 {
+		t.Fatalf("inferSchemas() = %+v, %v", schemas, err)
+	}
+	var schema map[string]interface{}
+	json.Unmarshal(schemas[0].Schema, &schema)
+	if props, _ := schema["properties"].(map[string]interface{}); props["total"] == nil || props[payloadKey] != nil {
+		t.Errorf("schema = %s, want the decrypted document's fields", schemas[0].Schema)
+	}
+
+	c.Config.Encryption = nil
+	if _, err := c.inferSchemas(ctx, "Order Processing", stored()); !IsPayloadEncrypted(err) {
+		t.Errorf("inferSchemas() without keys: err = %v, want ErrPayloadEncrypted", err)
+	}
+}
+
+func TestRotateRow(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "a1", "a1")
+	kf, _ := NewKeyFile(path)
+	doc := []byte(`{"customer": "ada"}`)
+	old, _ := encryptPayload(ctx, kf, doc)
+	oldRaw, _ := encryptPayload(ctx, kf, []byte("<order/>"))
+
+	writeKeyFile(t, path, "b2", "a1", "b2")
+	kf.Reload()
+	row := encryptedRow{id: 1, payload: old, raw: oldRaw}
+	if err := rotateRow(ctx, kf, "b2", &row); err != nil {
+		t.Fatalf("rotateRow() error = %v", err)
+	}
+	for name, data := range map[string][]byte{"payload": row.payload, "raw": row.raw} {
+		if _, id, err := decryptPayload(ctx, kf, data); err != nil || id != "b2" {
+			t.Errorf("%s: key = %q, %v, want b2", name, id, err)
+		}
+	}
+
+	// A payload under an unknown key leaves the row as it was.
+	writeKeyFile(t, path, "b2", "b2")
+	kf.Reload()
+	row = encryptedRow{id: 2, payload: old}
+	if err := rotateRow(ctx, kf, "b2", &row); !IsPayloadEncrypted(err) {
+		t.Errorf("rotateRow() error = %v, want ErrPayloadEncrypted", err)
+	}
+	if !bytes.Equal(row.payload, old) {
+		t.Error("rotateRow() should not change a row it failed to rotate")
+	}
+}
+
+func TestRotationError(t *testing.T) {
+	var failures []RotationFailure
+	for id := int64(1); id <= 12; id++ {
+		failures = append(failures, RotationFailure{Table: "points", ID: id, Err: ErrPayloadEncrypted})
+	}
+	err := error(&FlowError{Op: "RotateKeys", Err: &RotationError{Failures: failures}})
+
+	var rotation *RotationError
+	if !errors.As(err, &rotation) || len(rotation.Failures) != 12 {
+		t.Fatalf("errors.As() = %v, want the failures", rotation)
+	}
+	if !IsPayloadEncrypted(err) {
+		t.Error("RotationError should unwrap to the row errors")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "12 payloads") || !strings.Contains(msg, "points 10, ...") || strings.Contains(msg, "points 11") {
+		t.Errorf("Error() = %q", msg)
+	}
+}
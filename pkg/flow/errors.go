@@ -9,6 +9,13 @@ var (
 	ErrFlowNotFound = errors.New("flow: not found")
 	ErrFlowSkipped  = errors.New("flow: skipped (production mode)")
 	ErrLimitReached = errors.New("flow: execution limit reached")
+
+	ErrNoFlowContext = errors.New("flow: no propagated flow context")
+	ErrNoBaseline    = errors.New("flow: no baseline runs to compare with")
+
+	ErrDiffTooLarge     = errors.New("flow: documents too large to diff line by line")
+	ErrPayloadTooLarge  = errors.New("flow: payload exceeds the size limit")
+	ErrPayloadEncrypted = errors.New("flow: payload is encrypted with an unavailable key")
 )
 
 type FlowError struct {
@@ -39,3 +46,23 @@ func IsSkipped(err error) bool {
 func IsLimitReached(err error) bool {
 	return errors.Is(err, ErrLimitReached)
 }
+
+func IsNoFlowContext(err error) bool {
+	return errors.Is(err, ErrNoFlowContext)
+}
+
+func IsNoBaseline(err error) bool {
+	return errors.Is(err, ErrNoBaseline)
+}
+
+func IsDiffTooLarge(err error) bool {
+	return errors.Is(err, ErrDiffTooLarge)
+}
+
+func IsPayloadTooLarge(err error) bool {
+	return errors.Is(err, ErrPayloadTooLarge)
+}
+
+func IsPayloadEncrypted(err error) bool {
+	return errors.Is(err, ErrPayloadEncrypted)
+}
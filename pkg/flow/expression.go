@@ -0,0 +1,977 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expressions are small boolean checks evaluated against the actual payload
+// of a point, e.g. "amount > 0", "status in ['PAID', 'CAPTURED']" or
+// "len(items) == expected.count".
+//
+// Bare names read fields of the actual payload; "actual" and "expected" name
+// the whole payloads. Missing fields (and fields of null) are null. Numbers
+// are exact decimals. Supported: literals (numbers, 'strings', true, false,
+// null, [lists]), field access (a.b, a[0], a['b-c']), arithmetic (+ - * / %),
+// comparisons (== != < <= > >=), membership (in, not in: list elements,
+// substrings, object keys), logic (&& || ! or and, or, not) and the functions
+// len, lower, upper, abs and matches(s, regex). Expressions have no side
+// effects and no loops; their length and nesting are bounded.
+
+// Expression limits.
+const (
+	maxExpressionLength = 1024
+	maxExpressionDepth  = 32
+)
+
+// CheckExpression reports whether expr parses.
+func CheckExpression(expr string) error {
+	_, err := parseExpression(expr)
+	return err
+}
+
+// EvaluateExpression evaluates expr against the payloads and reports whether
+// it holds. An error means expr does not parse or could not be evaluated
+// (e.g. comparing a string with a number).
+func EvaluateExpression(expr string, expectedJSON, actualJSON json.RawMessage) (bool, error) {
+	e, err := parseExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	expected, actual, err := decodeExpressionDocs(expectedJSON, actualJSON)
+	if err != nil {
+		return false, err
+	}
+	return e.eval(expected, actual)
+}
+
+// EvaluateExpressions checks every expression and returns an
+// expression_failed diff for each one that is false or fails to evaluate.
+func EvaluateExpressions(exprs []string, expectedJSON, actualJSON json.RawMessage) []DiffEntry {
+	expected, actual, err := decodeExpressionDocs(expectedJSON, actualJSON)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: err.Error()}}
+	}
+	if _, ok := reducedDigest(expected); ok {
+		return []DiffEntry{unverifiable("expressions")}
+	}
+	if _, ok := reducedDigest(actual); ok {
+		return []DiffEntry{unverifiable("expressions")}
+	}
+
+	var diffs []DiffEntry
+	for _, src := range exprs {
+		e, err := parseExpression(src)
+		if err != nil {
+			diffs = append(diffs, DiffEntry{Path: "$", Kind: DiffInvalid, Expected: src, Message: err.Error()})
+			continue
+		}
+		ok, err := e.eval(expected, actual)
+		switch {
+		case err != nil:
+			diffs = append(diffs, DiffEntry{Path: "$", Kind: DiffExpressionFailed, Expected: src, Message: err.Error()})
+		case !ok:
+			msg := fmt.Sprintf("expression %s is false", src)
+			if refs := e.describeRefs(expected, actual); refs != "" {
+				msg += " (" + refs + ")"
+			}
+			diffs = append(diffs, DiffEntry{Path: "$", Kind: DiffExpressionFailed, Expected: src, Actual: false, Message: msg})
+		}
+	}
+	return diffs
+}
+
+func decodeExpressionDocs(expectedJSON, actualJSON json.RawMessage) (interface{}, interface{}, error) {
+	var expected interface{}
+	if len(expectedJSON) > 0 {
+		var err error
+		if expected, err = decodeJSON(expectedJSON); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal expected: %w", err)
+		}
+	}
+	actual, err := decodeJSON(actualJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal actual: %w", err)
+	}
+	return expected, actual, nil
+}
+
+// expression is a parsed expression.
+type expression struct {
+	src  string
+	root exprNode
+	refs []exprRef
+}
+
+// exprRef is a field reference, reported when the expression is false.
+type exprRef struct {
+	text string
+	node exprNode
+}
+
+func (e *expression) eval(expected, actual interface{}) (bool, error) {
+	v, err := e.root.eval(&exprEnv{expected: expected, actual: actual})
+	if err != nil {
+		return false, fmt.Errorf("expression %s: %w", e.src, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %s: result is %s, not a boolean", e.src, exprTypeName(v))
+	}
+	return b, nil
+}
+
+func (e *expression) describeRefs(expected, actual interface{}) string {
+	env := &exprEnv{expected: expected, actual: actual}
+	var parts []string
+	for _, r := range e.refs {
+		v, err := r.node.eval(env)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, r.text+" = "+formatExprValue(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type exprEnv struct {
+	expected interface{}
+	actual   interface{}
+}
+
+// ───── Lexer ─────
+
+type exprTokenKind int
+
+const (
+	tokEOF exprTokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+func lexExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, exprToken{tokNumber, src[start:i], start})
+		case r == '\'' || r == '"':
+			start := i
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				c := src[i]
+				if c == byte(r) {
+					i++
+					closed = true
+					break
+				}
+				if c == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string at column %d", start+1)
+			}
+			tokens = append(tokens, exprToken{tokString, b.String(), start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, exprToken{tokIdent, src[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at column %d", r, i+1)
+			}
+			tokens = append(tokens, exprToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{tokEOF, "", len(src)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// ───── Parser ─────
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+	depth  int
+	refs   []exprRef
+}
+
+func parseExpression(src string) (*expression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	if len(src) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	tokens, err := lexExpression(src)
+	if err != nil {
+		return nil, fmt.Errorf("expression %s: %w", src, err)
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %s: %w", src, err)
+	}
+	return &expression{src: src, root: root, refs: p.refs}, nil
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.pos] }
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators or keywords.
+func (p *exprParser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf(format+" at end of input", args...)
+	}
+	return fmt.Errorf(format+" at column %d", append(args, t.pos+1)...)
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > maxExpressionDepth {
+		return p.errorf("expression nested deeper than %d levels", maxExpressionDepth)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{or: true, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		if t := p.peek(); t.kind == tokIdent && t.text == "not" && p.tokens[p.pos+1].text == "in" {
+			p.pos += 2
+			op, ok = "not in", true
+		}
+	}
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: "-", left: &litNode{v: new(big.Rat)}, right: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	start := p.peek()
+	node, isRef, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			t := p.next()
+			if t.kind != tokIdent {
+				p.pos--
+				return nil, p.errorf("expected a field name")
+			}
+			node = &memberNode{x: node, key: &litNode{v: t.text}}
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &memberNode{x: node, key: index}
+			continue
+		}
+		break
+	}
+	if isRef {
+		end := p.tokens[p.pos-1]
+		p.addRef(p.src[start.pos:end.pos+len(end.text)], node)
+	}
+	return node, nil
+}
+
+func (p *exprParser) addRef(text string, node exprNode) {
+	if text == "actual" || text == "expected" {
+		return
+	}
+	for _, r := range p.refs {
+		if r.text == text {
+			return
+		}
+	}
+	p.refs = append(p.refs, exprRef{text: text, node: node})
+}
+
+func (p *exprParser) parsePrimary() (exprNode, bool, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		r, ok := parseNumber(t.text)
+		if !ok {
+			p.pos--
+			return nil, false, p.errorf("invalid number %q", t.text)
+		}
+		return &litNode{v: r}, false, nil
+	case tokString:
+		return &litNode{v: t.text}, false, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &litNode{v: true}, false, nil
+		case "false":
+			return &litNode{v: false}, false, nil
+		case "null":
+			return &litNode{v: nil}, false, nil
+		case "and", "or", "not", "in":
+			p.pos--
+			return nil, false, p.errorf("unexpected %q", t.text)
+		}
+		if _, ok := p.accept("("); ok {
+			node, err := p.parseCall(t)
+			return node, false, err
+		}
+		return &identNode{name: t.text}, true, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, false, err
+			}
+			return x, false, p.expect(")")
+		case "[":
+			var items []exprNode
+			if _, ok := p.accept("]"); ok {
+				return &listNode{}, false, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, false, err
+				}
+				items = append(items, item)
+				if _, ok := p.accept(","); ok {
+					continue
+				}
+				return &listNode{items: items}, false, p.expect("]")
+			}
+		}
+	}
+	p.pos--
+	if t.kind == tokEOF {
+		return nil, false, p.errorf("unexpected end of expression")
+	}
+	return nil, false, p.errorf("unexpected %q", t.text)
+}
+
+// exprFuncs maps function names to their arity.
+var exprFuncs = map[string]int{"len": 1, "lower": 1, "upper": 1, "abs": 1, "matches": 2}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	arity, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at column %d", name.text, name.pos+1)
+	}
+	var args []exprNode
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if len(args) != arity {
+		return nil, fmt.Errorf("%s() takes %d argument(s), got %d at column %d", name.text, arity, len(args), name.pos+1)
+	}
+
+	call := &callNode{name: name.text, args: args}
+	if name.text == "matches" {
+		if lit, ok := args[1].(*litNode); ok {
+			pattern, isString := lit.v.(string)
+			if !isString {
+				return nil, fmt.Errorf("matches() pattern must be a string at column %d", name.pos+1)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("matches(): invalid pattern: %w", err)
+			}
+			call.re = re
+		}
+	}
+	return call, nil
+}
+
+// ───── Evaluation ─────
+
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+type litNode struct{ v interface{} }
+
+func (n *litNode) eval(*exprEnv) (interface{}, error) { return n.v, nil }
+
+type listNode struct{ items []exprNode }
+
+func (n *listNode) eval(env *exprEnv) (interface{}, error) {
+	out := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(env *exprEnv) (interface{}, error) {
+	switch n.name {
+	case "actual":
+		return env.actual, nil
+	case "expected":
+		return env.expected, nil
+	}
+	return fieldOf(env.actual, n.name)
+}
+
+type memberNode struct {
+	x   exprNode
+	key exprNode
+}
+
+func (n *memberNode) eval(env *exprEnv) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if x == nil {
+		return nil, nil
+	}
+	switch k := key.(type) {
+	case string:
+		return fieldOf(x, k)
+	case *big.Rat, json.Number:
+		arr, ok := x.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %s with a number", exprTypeName(x))
+		}
+		r := toRat(k)
+		if r == nil || !r.IsInt() || !r.Num().IsInt64() {
+			return nil, fmt.Errorf("index %v is not an integer", k)
+		}
+		i := r.Num().Int64()
+		if i < 0 || i >= int64(len(arr)) {
+			return nil, nil
+		}
+		return arr[i], nil
+	}
+	return nil, fmt.Errorf("cannot index with %s", exprTypeName(key))
+}
+
+func fieldOf(x interface{}, key string) (interface{}, error) {
+	switch obj := x.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return obj[key], nil
+	}
+	return nil, fmt.Errorf("cannot read field %q of %s", key, exprTypeName(x))
+}
+
+type notNode struct{ x exprNode }
+
+func (n *notNode) eval(env *exprEnv) (interface{}, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operand of ! is %s, not a boolean", exprTypeName(v))
+	}
+	return !b, nil
+}
+
+type logicNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicNode) eval(env *exprEnv) (interface{}, error) {
+	op := "&&"
+	if n.or {
+		op = "||"
+	}
+	for _, side := range []exprNode{n.left, n.right} {
+		v, err := side.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of %s is %s, not a boolean", op, exprTypeName(v))
+		}
+		if b == n.or {
+			return b, nil
+		}
+	}
+	return !n.or, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(l, r), nil
+	case "!=":
+		return !exprEqual(l, r), nil
+	case "in", "not in":
+		found, err := exprIn(l, r)
+		if err != nil {
+			return nil, err
+		}
+		return found == (n.op == "in"), nil
+	case "<", "<=", ">", ">=":
+		cmp, err := exprCompare(l, r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compare %s %s %s", exprTypeName(l), n.op, exprTypeName(r))
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	}
+
+	if n.op == "+" {
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return ls + rs, nil
+			}
+		}
+	}
+	a, b := toRat(l), toRat(r)
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", n.op, exprTypeName(l), exprTypeName(r))
+	}
+	switch n.op {
+	case "+":
+		return new(big.Rat).Add(a, b), nil
+	case "-":
+		return new(big.Rat).Sub(a, b), nil
+	case "*":
+		return new(big.Rat).Mul(a, b), nil
+	case "/":
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return new(big.Rat).Quo(a, b), nil
+	case "%":
+		if !a.IsInt() || !b.IsInt() {
+			return nil, fmt.Errorf("%% needs integers")
+		}
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return new(big.Rat).SetInt(new(big.Int).Rem(a.Num(), b.Num())), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+	re   *regexp.Regexp // compiled literal pattern of matches()
+}
+
+func (n *callNode) eval(env *exprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.name {
+	case "len":
+		switch v := args[0].(type) {
+		case string:
+			return big.NewRat(int64(utf8.RuneCountInString(v)), 1), nil
+		case []interface{}:
+			return big.NewRat(int64(len(v)), 1), nil
+		case map[string]interface{}:
+			return big.NewRat(int64(len(v)), 1), nil
+		}
+	case "lower", "upper":
+		if s, ok := args[0].(string); ok {
+			if n.name == "lower" {
+				return strings.ToLower(s), nil
+			}
+			return strings.ToUpper(s), nil
+		}
+	case "abs":
+		if r := toRat(args[0]); r != nil {
+			return new(big.Rat).Abs(r), nil
+		}
+	case "matches":
+		s, ok := args[0].(string)
+		pattern, isString := args[1].(string)
+		if !ok || !isString {
+			break
+		}
+		re := n.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("matches(): invalid pattern: %w", err)
+			}
+		}
+		return re.MatchString(s), nil
+	}
+
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = exprTypeName(a)
+	}
+	return nil, fmt.Errorf("%s() does not accept %s", n.name, strings.Join(types, ", "))
+}
+
+// toRat returns numbers as exact rationals and nil for anything else.
+func toRat(v interface{}) *big.Rat {
+	switch n := v.(type) {
+	case *big.Rat:
+		return n
+	case json.Number:
+		if r, ok := parseNumber(n.String()); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+func exprEqual(a, b interface{}) bool {
+	if ra, rb := toRat(a), toRat(b); ra != nil || rb != nil {
+		return ra != nil && rb != nil && ra.Cmp(rb) == 0
+	}
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !exprEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, item := range av {
+			other, ok := bv[k]
+			if !ok || !exprEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func exprCompare(a, b interface{}) (int, error) {
+	if ra, rb := toRat(a), toRat(b); ra != nil && rb != nil {
+		return ra.Cmp(rb), nil
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			return strings.Compare(sa, sb), nil
+		}
+	}
+	return 0, fmt.Errorf("incomparable")
+}
+
+func exprIn(needle, haystack interface{}) (bool, error) {
+	switch h := haystack.(type) {
+	case []interface{}:
+		for _, item := range h {
+			if exprEqual(needle, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		if s, ok := needle.(string); ok {
+			return strings.Contains(h, s), nil
+		}
+	case map[string]interface{}:
+		if s, ok := needle.(string); ok {
+			_, found := h[s]
+			return found, nil
+		}
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot look for %s in %s", exprTypeName(needle), exprTypeName(haystack))
+}
+
+func exprTypeName(v interface{}) string {
+	if _, ok := v.(*big.Rat); ok {
+		return "number"
+	}
+	if t := getTypeName(v); t != "integer" {
+		return t
+	}
+	return "number"
+}
+
+func formatExprValue(v interface{}) string {
+	if r, ok := v.(*big.Rat); ok {
+		if r.IsInt() {
+			return r.RatString()
+		}
+		return strings.TrimRight(r.FloatString(10), "0")
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
@@ -0,0 +1,137 @@
+package flow
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	expected := json.RawMessage(`{"count": 2, "currency": "EUR"}`)
+	actual := json.RawMessage(`{
+		"amount": 10.10, "status": "PAID", "items": [{"sku": "A"}, {"sku": "B"}],
+		"customer": {"id": "C-1", "tags": ["vip"]}, "note": null, "order-id": "ORD-7"
+	}`)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"amount > 0", true},
+		{"amount == 10.1", true},
+		{"amount * 3 == 30.3", true},
+		{"amount - 10.1 == 0 && -amount < 0", true},
+		{"status in ['PAID', 'CAPTURED']", true},
+		{"status not in ['PAID', 'CAPTURED']", false},
+		{"len(items) == expected.count", true},
+		{"items[1].sku == 'B'", true},
+		{"items[5] == null", true},
+		{"customer.id == 'C-1' and 'vip' in customer.tags", true},
+		{"customer.address.city == null", true},
+		{"missing == null || missing > 0", true},
+		{"not (status == 'NEW')", true},
+		{"!(status == 'PAID') or amount > 100", false},
+		{"actual['order-id'] == 'ORD-7'", true},
+		{"matches(actual['order-id'], '^ORD-[0-9]+$')", true},
+		{"lower(status) + '!' == 'paid!'", true},
+		{"abs(-amount) == amount", true},
+		{"'sku' in items[0]", true},
+		{"'AI' in status", true},
+		{"expected.currency == \"EUR\"", true},
+		{"7 % 4 == 3 and 1 / 4 == 0.25 and 1e2 == 100", true},
+		{"note == null && len(customer) == 2", true},
+		{"items == ['A', 'B']", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := EvaluateExpression(tt.expr, expected, actual)
+			if err != nil {
+				t.Fatalf("EvaluateExpression() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateExpression() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"amount >",
+		"amount > 0)",
+		"(amount > 0",
+		"status in ['A', 'B'",
+		"name == 'unterminated",
+		"amount # 2",
+		"size(items) > 0",
+		"len(items, 2) > 0",
+		"matches(id, '(')",
+		"a.1 == 2",
+		"1.2.3 == 1",
+		"amount < 1e999999",
+		"amount > 1e-1001",
+		strings.Repeat("(", maxExpressionDepth+1) + "true" + strings.Repeat(")", maxExpressionDepth+1),
+		strings.Repeat("a", maxExpressionLength+1),
+	} {
+		if err := CheckExpression(expr); err == nil {
+			t.Errorf("CheckExpression(%q) should fail", expr)
+		}
+	}
+	if err := CheckExpression("len(items) == expected.count"); err != nil {
+		t.Errorf("CheckExpression() error = %v", err)
+	}
+	if err := CheckExpression("amount < 1e308 && amount > -1E-1000"); err != nil {
+		t.Errorf("CheckExpression() error = %v", err)
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	actual := json.RawMessage(`{"amount": 10, "status": "PAID", "items": []}`)
+	for _, expr := range []string{
+		"amount",
+		"status > 1",
+		"amount / 0 == 1",
+		"status.code == 1",
+		"len(amount) == 1",
+		"amount && true",
+		"items[0.5] == null",
+		"1 in amount",
+	} {
+		if _, err := EvaluateExpression(expr, nil, actual); err == nil {
+			t.Errorf("EvaluateExpression(%q) should fail", expr)
+		}
+	}
+}
+
+func TestEvaluateExpressions(t *testing.T) {
+	diffs := EvaluateExpressions(
+		[]string{"amount > 0", "len(items) == expected.count", "status > 1"},
+		json.RawMessage(`{"count": 3}`),
+		json.RawMessage(`{"amount": 5, "status": "PAID", "items": [1, 2]}`),
+	)
+	if len(diffs) != 2 {
+		t.Fatalf("EvaluateExpressions() = %v, want 2 diffs", diffs)
+	}
+	want := "expression len(items) == expected.count is false (items = [1,2], expected.count = 3)"
+	if diffs[0].Kind != DiffExpressionFailed || diffs[0].Message != want {
+		t.Errorf("diffs[0] = %+v, want message %q", diffs[0], want)
+	}
+	if diffs[1].Kind != DiffExpressionFailed || !strings.Contains(diffs[1].Message, "cannot compare string > number") {
+		t.Errorf("diffs[1] = %+v", diffs[1])
+	}
+}
+
+func TestComparePointWithExpressions(t *testing.T) {
+	client, _ := NewClient(nil, FlowConfig{IsProduction: true})
+	p := Point{
+		Expected:    json.RawMessage(`{"amount": 10}`),
+		Expressions: []string{"amount > 0"},
+	}
+	if diffs := client.comparePoint("Order", p, Assertion{Actual: json.RawMessage(`{"amount": 12, "extra": 1}`)}); len(diffs) != 0 {
+		t.Errorf("comparePoint() = %v, expressions should replace equality", diffs)
+	}
+	if diffs := client.comparePoint("Order", p, Assertion{Actual: json.RawMessage(`{"amount": -1}`)}); len(diffs) != 1 {
+		t.Errorf("comparePoint() = %v, want one failed expression", diffs)
+	}
+}
@@ -3,17 +3,27 @@ package flow
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
 type FlowClient struct {
-	DB      *sql.DB
-	Config  FlowConfig
-	storage *pgStorage
-	cache   *flowCache
-	logger  Logger
+	DB          *sql.DB
+	Config      FlowConfig
+	storage     *pgStorage
+	cache       *flowCache
+	logger      Logger
+	correlation []correlationRule
+	redaction   redactor
+	payloads    payloadPolicy
+
+	validatorsMu sync.RWMutex
+	validators   map[string]Validator
+
+	comparatorsMu sync.RWMutex
+	comparators   map[string][]PathComparator // by flow name, "" for every flow
 }
 
 type flowInstance struct {
@@ -23,12 +33,44 @@ type flowInstance struct {
 }
 
 func NewClient(db *sql.DB, config FlowConfig) (*FlowClient, error) {
+	correlation, err := compileCorrelation(config.Correlation)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.CompareOptions.Validate(); err != nil {
+		return nil, &ConfigError{msg: err.Error()}
+	}
+	for name, opts := range config.FlowCompareOptions {
+		if err := opts.Validate(); err != nil {
+			return nil, &ConfigError{msg: fmt.Sprintf("flow '%s': %v", name, err)}
+		}
+	}
+
+	redaction, err := compileRedaction(config.Redaction, config.RedactionSalt)
+	if err != nil {
+		return nil, &ConfigError{msg: err.Error()}
+	}
+
+	payloads, err := newPayloadPolicy(config)
+	if err != nil {
+		return nil, &ConfigError{msg: err.Error()}
+	}
+
 	client := &FlowClient{
-		DB:      db,
-		Config:  config,
-		storage: newPGStorage(db),
-		cache:   newFlowCache(config.CacheEnabled, config.MaxCacheSize),
-		logger:  noopLogger{},
+		DB:          db,
+		Config:      config,
+		storage:     newPGStorage(db),
+		cache:       newFlowCache(config.CacheEnabled, config.MaxCacheSize),
+		logger:      noopLogger{},
+		correlation: correlation,
+		redaction:   redactor{rules: redaction, salt: []byte(config.RedactionSalt)},
+		payloads:    payloads,
+	}
+
+	for name, v := range config.Validators {
+		if err := client.RegisterValidator(name, v); err != nil {
+			return nil, err
+		}
 	}
 
 	if !config.IsProduction {
@@ -46,6 +88,14 @@ func (c *FlowClient) Close() error {
 	return nil
 }
 
+// compareOptionsFor returns the client-wide rules merged with those of
+// flowName, followed by the registered comparators.
+func (c *FlowClient) compareOptionsFor(flowName string) CompareOptions {
+	opts := c.Config.CompareOptions.Merge(c.Config.FlowCompareOptions[flowName])
+	opts.comparators = append(opts.comparators, c.registeredComparators(flowName)...)
+	return opts
+}
+
 func isSkipped(status string) bool {
 	return len(status) >= 7 && status[:7] == "SKIPPED"
 }
@@ -124,6 +174,71 @@ func (c *FlowClient) GetFlow(ctx context.Context, flowName string, identifier ..
 	return &flowInstance{client: c, Flow: f, startTime: time.Now()}, nil
 }
 
+// GetFlowByID retrieves an active flow by its primary key, as carried by Inject/Extract.
+func (c *FlowClient) GetFlowByID(ctx context.Context, flowID int64) (*flowInstance, error) {
+	if c.Config.IsProduction {
+		return &flowInstance{client: c, Flow: &Flow{ID: flowID, Status: "SKIPPED"}, startTime: time.Now()}, nil
+	}
+
+	f, err := c.storage.FindActiveFlowByID(ctx, flowID)
+	if err != nil {
+		return nil, err
+	}
+	return &flowInstance{client: c, Flow: f, startTime: time.Now()}, nil
+}
+
+// Resume extracts a propagated flow identity from the carrier and retrieves
+// exactly that flow. Flows skipped by the producer stay skipped.
+func (c *FlowClient) Resume(ctx context.Context, carrier TextMapCarrier) (*flowInstance, error) {
+	propagated, err := Extract(carrier)
+	if err != nil {
+		return nil, &FlowError{Op: "Resume", Err: err}
+	}
+	return c.resume(ctx, propagated)
+}
+
+// FromContext retrieves the flow stored in ctx by ContextWithFlow.
+func (c *FlowClient) FromContext(ctx context.Context) (*flowInstance, error) {
+	propagated, ok := FlowFromContext(ctx)
+	if !ok {
+		return nil, &FlowError{Op: "FromContext", Err: ErrNoFlowContext}
+	}
+	if f, ok := ExecutorFromContext(ctx); ok {
+		if inst, ok := f.(*flowInstance); ok && inst.client == c {
+			return inst, nil
+		}
+	}
+	return c.resume(ctx, propagated)
+}
+
+func (c *FlowClient) resume(ctx context.Context, propagated *Flow) (*flowInstance, error) {
+	if c.Config.IsProduction {
+		return &flowInstance{client: c, Flow: &Flow{Name: propagated.Name, Status: "SKIPPED"}, startTime: time.Now()}, nil
+	}
+	if isSkipped(propagated.Status) {
+		return &flowInstance{client: c, Flow: &Flow{Name: propagated.Name, Identifier: propagated.Identifier, Status: propagated.Status}, startTime: time.Now()}, nil
+	}
+
+	inst, err := c.GetFlowByID(ctx, propagated.ID)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Flow.Name != propagated.Name {
+		return nil, &FlowError{
+			Op:       "Resume",
+			FlowName: propagated.Name,
+			Err:      fmt.Errorf("flow %d belongs to '%s': %w", propagated.ID, inst.Flow.Name, ErrFlowNotFound),
+		}
+	}
+	return inst, nil
+}
+
+// Context returns a copy of ctx carrying this flow, so it can be propagated
+// with Inject and retrieved with FromContext without a lookup.
+func (f *flowInstance) Context(ctx context.Context) context.Context {
+	return ContextWithExecutor(ctx, f)
+}
+
 func (f *flowInstance) GetFlowInfo() *Flow {
 	return f.Flow
 }
@@ -133,15 +248,9 @@ func (f *flowInstance) CreatePoint(ctx context.Context, description string, expe
 		return nil
 	}
 
-	expectedJSON, err := json.Marshal(expected)
-	if err != nil {
-		return fmt.Errorf("failed to marshal expected value: %w", err)
-	}
-
 	p := &Point{
 		FlowID:      f.Flow.ID,
 		Description: description,
-		Expected:    expectedJSON,
 		ServiceName: f.client.Config.ServiceName,
 	}
 
@@ -149,6 +258,69 @@ func (f *flowInstance) CreatePoint(ctx context.Context, description string, expe
 		opt(p)
 	}
 
+	expectedJSON, contentType, raw, err := encodePayload(p.codec, expected)
+	if err != nil {
+		return fmt.Errorf("failed to marshal expected value: %w", err)
+	}
+	doc, decodeErr := decodeJSON(expectedJSON)
+	if decodeErr == nil {
+		if err := validateMatchers(doc); err != nil {
+			return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+		}
+	}
+	expectedJSON, redacted, err := f.client.redaction.redactPayload(expectedJSON)
+	if err != nil {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+	}
+	if redacted {
+		raw = nil // the original encoding would still hold the redacted values
+	}
+	size := len(expectedJSON)
+	expectedJSON, reduced, err := f.client.payloads.seal(expectedJSON)
+	if err != nil {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+	}
+	if reduced {
+		if rules := p.digestSkippedRules(doc); len(rules) > 0 {
+			err := fmt.Errorf("%d bytes: %s need the whole payload, not its digest: %w", size, strings.Join(rules, ", "), ErrPayloadTooLarge)
+			return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+		}
+		raw = nil
+	}
+	if expectedJSON, err = encryptPayload(ctx, f.client.Config.Encryption, expectedJSON); err != nil {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+	}
+	if raw, err = encryptPayload(ctx, f.client.Config.Encryption, raw); err != nil {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+	}
+	p.Expected, p.ContentType, p.Raw = expectedJSON, contentType, raw
+	if len(p.Schema) > 0 {
+		if err := CheckSchema(p.Schema); err != nil {
+			return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+		}
+	}
+	for _, expr := range p.Expressions {
+		if err := CheckExpression(expr); err != nil {
+			return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+		}
+	}
+
+	if p.Compare != nil && len(p.Compare.comparators) > 0 {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: fmt.Errorf("comparators are not stored with points; register them on the client")}
+	}
+	compare := f.client.compareOptionsFor(f.Flow.Name)
+	if p.Compare != nil {
+		compare = compare.Merge(*p.Compare)
+	}
+	if err := compare.Validate(); err != nil {
+		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
+	}
+	compare.comparators = nil
+	p.Compare = nil
+	if !compare.IsZero() {
+		p.Compare = &compare
+	}
+
 	if err := f.client.storage.InsertPoint(ctx, p); err != nil {
 		return &FlowError{Op: "CreatePoint", FlowName: f.Flow.Name, Err: err}
 	}
@@ -157,17 +329,43 @@ func (f *flowInstance) CreatePoint(ctx context.Context, description string, expe
 	return nil
 }
 
-func (f *flowInstance) AddAssertion(ctx context.Context, actual interface{}) error {
+func (f *flowInstance) AddAssertion(ctx context.Context, actual interface{}, opts ...AssertionOption) error {
 	if f.client.Config.IsProduction || isSkipped(f.Flow.Status) {
 		return nil
 	}
 
-	actualJSON, err := json.Marshal(actual)
+	a := &Assertion{FlowID: f.Flow.ID, ServiceName: f.client.Config.ServiceName}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	actualJSON, contentType, raw, err := encodePayload(a.codec, actual)
 	if err != nil {
 		return fmt.Errorf("failed to marshal actual value: %w", err)
 	}
+	actualJSON, redacted, err := f.client.redaction.redactPayload(actualJSON)
+	if err != nil {
+		return &FlowError{Op: "AddAssertion", FlowName: f.Flow.Name, Err: err}
+	}
+	if redacted {
+		raw = nil
+	}
+	actualJSON, reduced, err := f.client.payloads.seal(actualJSON)
+	if err != nil {
+		return &FlowError{Op: "AddAssertion", FlowName: f.Flow.Name, Err: err}
+	}
+	if reduced {
+		raw = nil
+	}
+	if actualJSON, err = encryptPayload(ctx, f.client.Config.Encryption, actualJSON); err != nil {
+		return &FlowError{Op: "AddAssertion", FlowName: f.Flow.Name, Err: err}
+	}
+	if raw, err = encryptPayload(ctx, f.client.Config.Encryption, raw); err != nil {
+		return &FlowError{Op: "AddAssertion", FlowName: f.Flow.Name, Err: err}
+	}
+	a.Actual, a.ContentType, a.Raw = actualJSON, contentType, raw
 
-	if err := f.client.storage.InsertAssertion(ctx, f.Flow.ID, actualJSON, f.client.Config.ServiceName); err != nil {
+	if err := f.client.storage.InsertAssertion(ctx, a); err != nil {
 		return &FlowError{Op: "AddAssertion", FlowName: f.Flow.Name, Err: err}
 	}
 
@@ -175,6 +373,23 @@ func (f *flowInstance) AddAssertion(ctx context.Context, actual interface{}) err
 	return nil
 }
 
+// AddIdentifier attaches an alias identifier to the flow, so GetFlow and
+// Correlate find it by that value as well as by its primary identifier.
+func (f *flowInstance) AddIdentifier(ctx context.Context, kind, value string) error {
+	if f.client.Config.IsProduction || isSkipped(f.Flow.Status) {
+		return nil
+	}
+
+	if err := f.client.storage.InsertIdentifier(ctx, f.Flow.ID, kind, value); err != nil {
+		return &FlowError{Op: "AddIdentifier", FlowName: f.Flow.Name, Err: err}
+	}
+
+	f.Flow.Aliases = append(f.Flow.Aliases, FlowIdentifier{Kind: kind, Value: value})
+	f.client.cache.Set(f.Flow.Name, value, f.Flow)
+	f.client.logger.Debug("Identifier %s=%s added to flow '%s'", kind, value, f.Flow.Name)
+	return nil
+}
+
 func (f *flowInstance) Finish(ctx context.Context) (*FinishResult, error) {
 	if f.client.Config.IsProduction || isSkipped(f.Flow.Status) {
 		return &FinishResult{Success: true}, nil
@@ -185,6 +400,9 @@ func (f *flowInstance) Finish(ctx context.Context) (*FinishResult, error) {
 	}
 
 	f.client.cache.Delete(f.Flow.Name, f.Flow.Identifier)
+	for _, alias := range f.Flow.Aliases {
+		f.client.cache.Delete(f.Flow.Name, alias.Value)
+	}
 	return f.executeWorker(ctx)
 }
 
@@ -193,8 +411,11 @@ func (f *flowInstance) executeWorker(ctx context.Context) (*FinishResult, error)
 	if err != nil {
 		return nil, &FlowError{Op: "Finish", FlowName: f.Flow.Name, Err: err}
 	}
+	if err := f.client.decryptRun(ctx, points, assertions); err != nil {
+		return nil, &FlowError{Op: "Finish", FlowName: f.Flow.Name, Err: err}
+	}
 
-	var discrepancies []Discrepancy
+	var discrepancies, warnings, infos []Discrepancy
 	errorCount := 0
 
 	maxLen := len(points)
@@ -228,21 +449,46 @@ func (f *flowInstance) executeWorker(ctx context.Context) (*FinishResult, error)
 		p := points[i]
 		a := assertions[i]
 
-		diffs, equal := DeepCompare(p.Expected, a.Actual)
-		if !equal {
-			errorCount++
-			var expectedVal, actualVal interface{}
-			_ = json.Unmarshal(p.Expected, &expectedVal)
-			_ = json.Unmarshal(a.Actual, &actualVal)
+		diffs := f.client.comparePoint(f.Flow.Name, p, a)
+		if len(diffs) == 0 {
+			continue
+		}
 
-			diffStr := FormatDiffs(diffs)
+		expectedVal, _ := decodeJSON(p.Expected)
+		actualVal, _ := decodeJSON(a.Actual)
+		errs, warns := SplitDiffs(diffs)
+		if len(errs) > 0 {
+			errorCount++
 			discrepancies = append(discrepancies, Discrepancy{
 				PointID:     p.ID,
 				AssertionID: a.ID,
 				Description: p.Description,
 				Expected:    expectedVal,
 				Actual:      actualVal,
-				Diff:        diffStr,
+				Diff:        FormatDiffs(errs),
+				Timestamp:   time.Now(),
+			})
+		}
+		warns, notes := splitInfos(warns)
+		if len(warns) > 0 {
+			warnings = append(warnings, Discrepancy{
+				PointID:     p.ID,
+				AssertionID: a.ID,
+				Description: p.Description,
+				Expected:    expectedVal,
+				Actual:      actualVal,
+				Diff:        FormatDiffs(warns),
+				Timestamp:   time.Now(),
+			})
+		}
+		if len(notes) > 0 {
+			infos = append(infos, Discrepancy{
+				PointID:     p.ID,
+				AssertionID: a.ID,
+				Description: p.Description,
+				Expected:    expectedVal,
+				Actual:      actualVal,
+				Diff:        FormatDiffs(notes),
 				Timestamp:   time.Now(),
 			})
 		}
@@ -253,11 +499,16 @@ func (f *flowInstance) executeWorker(ctx context.Context) (*FinishResult, error)
 	result := &FinishResult{
 		Success:       len(discrepancies) == 0,
 		Discrepancies: discrepancies,
+		Warnings:      warnings,
+		Infos:         infos,
 		ExecutionTime: executionTime,
 		ErrorCount:    errorCount,
+		WarningCount:  len(warnings),
 	}
 
-	if result.Success {
+	if result.Success && len(warnings) > 0 {
+		f.client.logger.Info("Flow '%s' finished: SUCCESS with %d warnings (%s)", f.Flow.Name, len(warnings), executionTime)
+	} else if result.Success {
 		f.client.logger.Info("Flow '%s' finished: SUCCESS (%s)", f.Flow.Name, executionTime)
 	} else {
 		f.client.logger.Error("Flow '%s' finished: FAILED with %d discrepancies (%s)", f.Flow.Name, errorCount, executionTime)
@@ -0,0 +1,63 @@
+package flowhttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var ErrBodyTooLarge = errors.New("flowhttp: body exceeds capture limit")
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bufferBody reads up to max bytes of body for capture and returns a
+// replacement body that still yields the complete, unconsumed stream.
+func bufferBody(body io.ReadCloser, max int64) ([]byte, io.ReadCloser, error) {
+	if body == nil || body == http.NoBody {
+		return nil, body, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(body, max+1))
+	restored := &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), body), Closer: body}
+	if err != nil {
+		return nil, restored, err
+	}
+	if int64(len(buf)) > max {
+		return nil, restored, ErrBodyTooLarge
+	}
+	return buf, restored, nil
+}
+
+// captureWriter tees up to max bytes of the response body.
+type captureWriter struct {
+	http.ResponseWriter
+	buf      bytes.Buffer
+	max      int64
+	overflow bool
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if !w.overflow {
+		if int64(w.buf.Len()+len(p)) > w.max {
+			w.overflow = true
+			w.buf.Reset()
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,304 @@
+package flowhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flow-tool/pkg/flow"
+	"flow-tool/pkg/flow/flowtest"
+)
+
+func newTestClient(t *testing.T) *flow.FlowClient {
+	t.Helper()
+	client, err := flow.NewClient(nil, flow.FlowConfig{IsProduction: true})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func newResolver() *flowtest.Resolver {
+	return flowtest.NewResolver(&flow.Flow{ID: 9, Name: "Checkout"})
+}
+
+func TestMiddleware(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("Passes through without propagated flow", func(t *testing.T) {
+		var gotBody string
+		var hasFlow bool
+		h := Middleware(client, WithRequestCapture())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			_, hasFlow = flow.FlowFromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if gotBody != `{"id":1}` {
+			t.Errorf("body = %q", gotBody)
+		}
+		if hasFlow {
+			t.Error("context should not carry a flow")
+		}
+	})
+
+	t.Run("Resumes propagated flow and keeps body readable", func(t *testing.T) {
+		var gotBody string
+		var got *flow.Flow
+		h := Middleware(client, WithRequestCapture(), WithResponseCapture())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			got, _ = flow.FlowFromContext(r.Context())
+			w.Write([]byte(`{"ok":true}`))
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`))
+		flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 9, Name: "Checkout"}), flow.HeaderCarrier(req.Header))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if gotBody != `{"id":1}` {
+			t.Errorf("body = %q", gotBody)
+		}
+		if got == nil || got.Name != "Checkout" {
+			t.Errorf("flow in context = %+v", got)
+		}
+		if rec.Body.String() != `{"ok":true}` {
+			t.Errorf("response = %q", rec.Body.String())
+		}
+	})
+
+	t.Run("Reports malformed baggage", func(t *testing.T) {
+		var reported error
+		h := Middleware(client, WithErrorHandler(func(_ *http.Request, err error) { reported = err }))(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(flow.BaggageKey, "garbage")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if reported == nil {
+			t.Error("expected malformed baggage to be reported")
+		}
+	})
+}
+
+func TestTransport(t *testing.T) {
+	client := newTestClient(t)
+
+	var gotHeader, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get(flow.BaggageKey)
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: NewTransport(client, nil, WithRequestCapture())}
+	ctx := flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 5, Name: "Checkout"})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, strings.NewReader(`{"id":1}`))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if gotHeader == "" {
+		t.Error("expected flow baggage header on outgoing request")
+	}
+	if gotBody != `{"id":1}` {
+		t.Errorf("body = %q", gotBody)
+	}
+	if req.Header.Get(flow.BaggageKey) != "" {
+		t.Error("caller's request must not be modified")
+	}
+}
+
+func TestPayloadRedaction(t *testing.T) {
+	o := newOptions([]Option{WithRedactedKeys("Email", "card")})
+
+	doc, err := o.payload([]byte(`{"email":"a@b.c","items":[{"card":"4111"}],"total":10.50}`))
+	got, _ := json.Marshal(doc)
+	want := `{"email":"*****","items":[{"card":"****"}],"total":10.50}`
+	if err != nil || string(got) != want {
+		t.Errorf("payload() = %s, %v, want %s", got, err, want)
+	}
+
+	// A body the keys cannot be checked against is never recorded.
+	if doc, err := o.payload([]byte("email=a@b.c")); err == nil {
+		t.Errorf("payload() = %v, want an error for a non-JSON body with redacted keys", doc)
+	}
+
+	plain := newOptions(nil)
+	if doc, err := plain.payload([]byte("plain text")); err != nil || doc != "plain text" {
+		t.Errorf("payload() = %v, %v, want non-JSON bodies recorded as string without redaction", doc, err)
+	}
+}
+
+func TestBufferBodyTooLarge(t *testing.T) {
+	body, restored, err := bufferBody(io.NopCloser(strings.NewReader("0123456789")), 4)
+	if err != ErrBodyTooLarge {
+		t.Errorf("err = %v, want ErrBodyTooLarge", err)
+	}
+	if body != nil {
+		t.Errorf("body = %q, want nil", body)
+	}
+	all, _ := io.ReadAll(restored)
+	if string(all) != "0123456789" {
+		t.Errorf("restored = %q", all)
+	}
+}
+
+func TestMiddlewareRecordsBodies(t *testing.T) {
+	flows := newResolver()
+	o := newOptions([]Option{WithRequestCapture(), WithResponseCapture(), WithRedactedKeys("email")})
+
+	var inner flow.FlowExecutor
+	h := middleware(flows, o)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner, _ = flow.ExecutorFromContext(r.Context())
+		w.Write([]byte(`{"status":"accepted"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1,"email":"ada@example.com"}`))
+	flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 9, Name: "Checkout"}), flow.HeaderCarrier(req.Header))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := flows.Exec.Assertions()
+	if len(got) != 2 || got[1] != `{"status":"accepted"}` {
+		t.Fatalf("assertions = %v, want request and response bodies", got)
+	}
+	if !strings.Contains(got[0], `"id":1`) || strings.Contains(got[0], "ada@example.com") {
+		t.Errorf("request assertion = %s, want it recorded with the email redacted", got[0])
+	}
+	if inner != flows.Exec {
+		t.Error("handler context should carry the resolved executor")
+	}
+}
+
+func TestMiddlewareSkipsUnredactableBodies(t *testing.T) {
+	flows := newResolver()
+	var reported []error
+	o := newOptions([]Option{WithRequestCapture(), WithRedactedKeys("email"),
+		WithErrorHandler(func(_ *http.Request, err error) { reported = append(reported, err) })})
+	h := middleware(flows, o)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("email=ada@example.com"))
+	flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 9, Name: "Checkout"}), flow.HeaderCarrier(req.Header))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := flows.Exec.Assertions(); len(got) != 0 {
+		t.Errorf("assertions = %v, want none", got)
+	}
+	if len(reported) != 1 {
+		t.Errorf("reported errors = %v, want the redaction failure", reported)
+	}
+}
+
+func TestTransportRecordsRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	flows := newResolver()
+	tr := &Transport{flows: flows, opts: newOptions([]Option{WithRequestCapture()})}
+	send := func(ctx context.Context, body string) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/payments", strings.NewReader(body))
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// A context from the middleware already carries the executor.
+	send(flow.ContextWithExecutor(context.Background(), flows.Exec), `{"amount":10}`)
+	want := []flowtest.Point{{Description: "POST /payments", Expected: `{"amount":10}`}}
+	if got := flows.Exec.Points(); !reflect.DeepEqual(got, want) {
+		t.Errorf("points = %v, want %v", got, want)
+	}
+	if flows.Lookups() != 0 {
+		t.Errorf("lookups = %d, want the executor in the context reused", flows.Lookups())
+	}
+
+	send(flow.ContextWithFlow(context.Background(), flows.Exec.Info), `{"amount":20}`)
+	want = append(want, flowtest.Point{Description: "POST /payments", Expected: `{"amount":20}`})
+	if got := flows.Exec.Points(); flows.Lookups() != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("lookups = %d, points = %v", flows.Lookups(), got)
+	}
+
+	// A request that never reached the server leaves no point.
+	failing := newResolver()
+	tr = &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		}),
+		flows: failing,
+		opts:  newOptions([]Option{WithRequestCapture()}),
+	}
+	req, _ := http.NewRequestWithContext(flow.ContextWithExecutor(context.Background(), failing.Exec),
+		http.MethodPost, srv.URL+"/payments", strings.NewReader(`{"amount":30}`))
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() should fail")
+	}
+	if len(failing.Exec.Points()) != 0 {
+		t.Errorf("points = %v, want none for a request that was not sent", failing.Exec.Points())
+	}
+}
+
+func TestMiddlewareCorrelation(t *testing.T) {
+	serve := func(flows *flowtest.Resolver, withHeader bool) error {
+		var reported error
+		o := newOptions([]Option{WithRequestCapture(), WithCorrelation("Checkout"),
+			WithErrorHandler(func(_ *http.Request, err error) { reported = err })})
+		h := middleware(flows, o)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"order_id":"O1"}`))
+		if withHeader {
+			flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 9, Name: "Checkout"}), flow.HeaderCarrier(req.Header))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return reported
+	}
+
+	t.Run("Records on the correlated flow", func(t *testing.T) {
+		flows := newResolver()
+		if err := serve(flows, false); err != nil {
+			t.Fatalf("reported = %v", err)
+		}
+		if len(flows.Exec.Assertions()) != 1 || flows.Exec.Assertions()[0] != `{"order_id":"O1"}` {
+			t.Errorf("assertions = %v", flows.Exec.Assertions())
+		}
+	})
+
+	t.Run("Uncorrelated request is served silently", func(t *testing.T) {
+		flows := newResolver()
+		flows.CorrelateErr = &flow.FlowError{Op: "Correlate", Err: flow.ErrFlowNotFound}
+		if err := serve(flows, false); err != nil {
+			t.Errorf("reported = %v, want nothing", err)
+		}
+	})
+
+	t.Run("Missing propagated flow is reported", func(t *testing.T) {
+		flows := newResolver()
+		flows.ResumeErr = &flow.FlowError{Op: "Resume", Err: flow.ErrFlowNotFound}
+		if err := serve(flows, true); !flow.IsNotFound(err) {
+			t.Errorf("reported = %v, want ErrFlowNotFound", err)
+		}
+		if len(flows.Exec.Assertions()) != 0 {
+			t.Errorf("assertions = %v, want none", flows.Exec.Assertions())
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package flowhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"flow-tool/pkg/flow"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+type options struct {
+	captureRequest  bool
+	captureResponse bool
+	maxBodyBytes    int64
+	redaction       []flow.RedactionRule
+	describe        func(*http.Request) string
+	onError         func(*http.Request, error)
+	correlate       bool
+	flowNames       []string
+}
+
+// Option configures the server middleware and the client Transport.
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		maxBodyBytes: defaultMaxBodyBytes,
+		describe: func(r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		},
+		onError: func(*http.Request, error) {},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRequestCapture records the request body: as an assertion in the server
+// middleware, as a point in the client Transport.
+func WithRequestCapture() Option {
+	return func(o *options) {
+		o.captureRequest = true
+	}
+}
+
+// WithResponseCapture records the response body as an assertion in the server middleware.
+func WithResponseCapture() Option {
+	return func(o *options) {
+		o.captureResponse = true
+	}
+}
+
+// WithMaxBodyBytes caps how much of a body is buffered for capture.
+// Larger bodies are passed through untouched and reported to the error handler.
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithRedactedKeys masks the values of matching JSON keys (case-insensitive,
+// at any depth) before a captured body is recorded, like flow.MaskField.
+// The client's own redaction rules still apply when the body is stored.
+func WithRedactedKeys(keys ...string) Option {
+	return func(o *options) {
+		for _, k := range keys {
+			if k != "" {
+				o.redaction = append(o.redaction, flow.MaskField(k, 0))
+			}
+		}
+	}
+}
+
+// WithDescription sets how point descriptions are derived from outgoing requests.
+func WithDescription(fn func(*http.Request) string) Option {
+	return func(o *options) {
+		o.describe = fn
+	}
+}
+
+// WithErrorHandler receives flow errors, which never fail the HTTP exchange itself.
+func WithErrorHandler(fn func(*http.Request, error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// WithCorrelation lets the server middleware find the flow from the request
+// body alone, using the client's correlation rules, when a request carries no
+// flow headers. It requires WithRequestCapture. When flowNames is given, only
+// those flows are considered.
+func WithCorrelation(flowNames ...string) Option {
+	return func(o *options) {
+		o.correlate = true
+		o.flowNames = flowNames
+	}
+}
+
+// payload converts a captured body into the value recorded on the flow.
+// JSON bodies are recorded as JSON (and redacted); anything else is recorded
+// as a string, unless keys are redacted: a body that cannot be redacted is
+// never recorded.
+func (o *options) payload(body []byte) (interface{}, error) {
+	if len(o.redaction) == 0 {
+		if !json.Valid(body) {
+			return string(body), nil
+		}
+		return json.RawMessage(body), nil
+	}
+	out, err := flow.Redact(body, "", o.redaction...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
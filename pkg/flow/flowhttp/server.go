@@ -0,0 +1,84 @@
+// Package flowhttp integrates flows with net/http: a server middleware that
+// resumes propagated flows and a client RoundTripper that propagates them.
+package flowhttp
+
+import (
+	"net/http"
+
+	"flow-tool/pkg/flow"
+)
+
+// Middleware resumes the flow propagated in the request headers and stores it
+// in the request context, so handlers and outgoing Transports can use it.
+// Requests without a propagated (or correlated) flow are served unchanged.
+func Middleware(client *flow.FlowClient, opts ...Option) func(http.Handler) http.Handler {
+	return middleware(client.Resolver(), newOptions(opts))
+}
+
+func middleware(flows flow.FlowResolver, o *options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body []byte
+			var bodyErr error
+			if o.captureRequest {
+				body, r.Body, bodyErr = bufferBody(r.Body, o.maxBodyBytes)
+			}
+
+			f, err := flows.Resume(r.Context(), flow.HeaderCarrier(r.Header))
+			correlated := false
+			if flow.IsNoFlowContext(err) && o.correlate && len(body) > 0 {
+				var doc interface{}
+				if doc, err = o.payload(body); err == nil {
+					f, err = flows.Correlate(r.Context(), doc, o.flowNames...)
+					correlated = true
+				}
+			}
+			if err != nil {
+				// Most uncorrelated requests belong to no flow; a flow named
+				// by propagated headers that cannot be found is reported.
+				if !flow.IsNoFlowContext(err) && !(correlated && flow.IsNotFound(err)) {
+					o.onError(r, err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := flow.ContextWithExecutor(r.Context(), f)
+			r = r.WithContext(ctx)
+
+			if bodyErr != nil {
+				o.onError(r, bodyErr)
+			} else if len(body) > 0 {
+				o.record(r, f, body)
+			}
+
+			if !o.captureResponse {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &captureWriter{ResponseWriter: w, max: o.maxBodyBytes}
+			next.ServeHTTP(cw, r)
+
+			if cw.overflow {
+				o.onError(r, ErrBodyTooLarge)
+				return
+			}
+			if cw.buf.Len() > 0 {
+				o.record(r, f, cw.buf.Bytes())
+			}
+		})
+	}
+}
+
+// record adds body as an assertion of f, reporting failures to the error
+// handler.
+func (o *options) record(r *http.Request, f flow.FlowExecutor, body []byte) {
+	doc, err := o.payload(body)
+	if err == nil {
+		err = f.AddAssertion(r.Context(), doc)
+	}
+	if err != nil {
+		o.onError(r, err)
+	}
+}
@@ -0,0 +1,81 @@
+package flowhttp
+
+import (
+	"net/http"
+
+	"flow-tool/pkg/flow"
+)
+
+// Transport is an http.RoundTripper that injects the flow stored in the
+// request context into the outgoing headers and, optionally, records the
+// request body as a point once the request was sent.
+type Transport struct {
+	Base  http.RoundTripper
+	flows flow.FlowResolver
+	opts  *options
+}
+
+// NewTransport wraps base (http.DefaultTransport when nil).
+func NewTransport(client *flow.FlowClient, base http.RoundTripper, opts ...Option) *Transport {
+	return &Transport{
+		Base:  base,
+		flows: client.Resolver(),
+		opts:  newOptions(opts),
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	if _, ok := flow.FlowFromContext(ctx); !ok {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request.
+	out := req.Clone(ctx)
+	flow.Inject(ctx, flow.HeaderCarrier(out.Header))
+
+	var body []byte
+	if t.opts.captureRequest {
+		buf, restored, err := bufferBody(req.Body, t.opts.maxBodyBytes)
+		out.Body = restored
+		if err != nil {
+			t.opts.onError(req, err)
+		} else {
+			body = buf
+		}
+	}
+
+	resp, err := base.RoundTrip(out)
+	// A request that was never delivered gets no assertion, so it must not
+	// leave a point behind either.
+	if err == nil && len(body) > 0 {
+		t.record(out, body)
+	}
+	return resp, err
+}
+
+// record stores body as a point on the flow of the request context. The
+// executor stored by Middleware (or flowInstance.Context) is reused, so only
+// contexts built with flow.ContextWithFlow alone cost a lookup.
+func (t *Transport) record(req *http.Request, body []byte) {
+	f, ok := flow.ExecutorFromContext(req.Context())
+	if !ok {
+		var err error
+		if f, err = t.flows.FromContext(req.Context()); err != nil {
+			t.opts.onError(req, err)
+			return
+		}
+	}
+	doc, err := t.opts.payload(body)
+	if err == nil {
+		err = f.CreatePoint(req.Context(), t.opts.describe(req), doc)
+	}
+	if err != nil {
+		t.opts.onError(req, err)
+	}
+}
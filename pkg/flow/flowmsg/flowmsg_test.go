@@ -0,0 +1,242 @@
+package flowmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flow-tool/pkg/flow"
+	"flow-tool/pkg/flow/flowtest"
+)
+
+func newTestClient(t *testing.T) *flow.FlowClient {
+	t.Helper()
+	client, err := flow.NewClient(nil, flow.FlowConfig{IsProduction: true})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func newResolver() *flowtest.Resolver {
+	return flowtest.NewResolver(&flow.Flow{ID: 3, Name: "Order Processing"})
+}
+
+func TestWrapPublisher(t *testing.T) {
+	client := newTestClient(t)
+
+	var published *Message
+	pub := WrapPublisher(client, PublisherFunc(func(_ context.Context, msg *Message) error {
+		published = msg
+		return nil
+	}))
+
+	t.Run("Injects flow headers", func(t *testing.T) {
+		ctx := flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 3, Name: "Order Processing"})
+		if err := pub.Publish(ctx, &Message{ID: "m1", Payload: []byte(`{"id":1}`)}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		got, err := flow.Extract(published.Carrier())
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if got.ID != 3 || got.Name != "Order Processing" {
+			t.Errorf("Extract() = %+v", got)
+		}
+	})
+
+	t.Run("Passes through outside a flow", func(t *testing.T) {
+		msg := &Message{ID: "m2"}
+		if err := pub.Publish(context.Background(), msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if _, ok := msg.Headers[flow.BaggageKey]; ok {
+			t.Error("message outside a flow should not carry baggage")
+		}
+	})
+}
+
+func TestWrapHandler(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("Resumes flow into handler context", func(t *testing.T) {
+		var got *flow.Flow
+		h := WrapHandler(client, func(ctx context.Context, _ *Message) error {
+			got, _ = flow.FlowFromContext(ctx)
+			return nil
+		})
+
+		msg := &Message{ID: "m1"}
+		flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 3, Name: "Order Processing"}), msg.Carrier())
+		if err := h(context.Background(), msg); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		if got == nil || got.Name != "Order Processing" {
+			t.Errorf("flow in context = %+v", got)
+		}
+	})
+
+	t.Run("Flow errors are surfaced, business errors kept", func(t *testing.T) {
+		businessErr := errors.New("business failure")
+		called := false
+		h := WrapHandler(client, func(context.Context, *Message) error {
+			called = true
+			return businessErr
+		})
+
+		err := h(context.Background(), &Message{Headers: map[string]string{flow.BaggageKey: "garbage"}})
+		if !called {
+			t.Error("next handler must run even when the flow cannot be resumed")
+		}
+		if !errors.Is(err, businessErr) {
+			t.Errorf("err = %v, want business error", err)
+		}
+		if err == businessErr {
+			t.Error("flow error should be joined to the business error")
+		}
+	})
+
+	t.Run("Error handler can swallow flow errors", func(t *testing.T) {
+		h := WrapHandler(client, func(context.Context, *Message) error { return nil },
+			WithErrorHandler(func(context.Context, *Message, error) error { return nil }))
+
+		if err := h(context.Background(), &Message{Headers: map[string]string{flow.BaggageKey: "garbage"}}); err != nil {
+			t.Errorf("err = %v, want nil", err)
+		}
+	})
+
+	t.Run("Payload extraction errors are reported", func(t *testing.T) {
+		var reported error
+		h := WrapHandler(client, func(context.Context, *Message) error { return nil },
+			WithPayloadExtractor(func(*Message) (interface{}, error) { return nil, errors.New("bad payload") }),
+			WithErrorHandler(func(_ context.Context, _ *Message, err error) error { reported = err; return nil }))
+
+		msg := &Message{ID: "m1"}
+		flow.Inject(flow.ContextWithFlow(context.Background(), &flow.Flow{ID: 3, Name: "Order Processing"}), msg.Carrier())
+		h(context.Background(), msg)
+		if reported == nil {
+			t.Error("expected payload extraction error to be reported")
+		}
+	})
+}
+
+func TestPublisherRecordsPublishedMessages(t *testing.T) {
+	flows := newResolver()
+	ctx := flow.ContextWithFlow(context.Background(), flows.Exec.Info)
+
+	brokerErr := errors.New("broker down")
+	failing := wrapPublisher(flows, PublisherFunc(func(context.Context, *Message) error { return brokerErr }), newOptions(nil))
+	if err := failing.Publish(ctx, &Message{ID: "m1", Payload: []byte(`{"id":1}`)}); !errors.Is(err, brokerErr) {
+		t.Errorf("err = %v, want the publish error", err)
+	}
+	if got := flows.Exec.Points(); len(got) != 0 {
+		t.Errorf("points = %v, want none for a failed publish", got)
+	}
+
+	pub := wrapPublisher(flows, PublisherFunc(func(context.Context, *Message) error { return nil }), newOptions(nil))
+	if err := pub.Publish(ctx, &Message{ID: "m1", Payload: []byte(`{"id":1}`)}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got := flows.Exec.Points(); len(got) != 1 || got[0].Expected != `{"id":1}` {
+		t.Errorf("points = %v", got)
+	}
+}
+
+func TestHandlerRecordsRedelivery(t *testing.T) {
+	flows := newResolver()
+	flows.Exec.Failures = 1
+	var reported []error
+	h := wrapHandler(flows, func(context.Context, *Message) error { return nil }, newOptions([]Option{
+		WithErrorHandler(func(_ context.Context, _ *Message, err error) error { reported = append(reported, err); return nil }),
+	}))
+
+	msg := &Message{ID: "m1", Payload: []byte(`{"id":1}`)}
+	flow.Inject(flow.ContextWithFlow(context.Background(), flows.Exec.Info), msg.Carrier())
+
+	h(context.Background(), msg) // storage fails
+	h(context.Background(), msg) // redelivery is recorded
+	h(context.Background(), msg) // duplicate is dropped
+
+	if len(reported) != 1 {
+		t.Errorf("reported = %v, want the failed save only", reported)
+	}
+	if len(flows.Exec.Assertions()) != 1 || flows.Exec.Assertions()[0] != `{"id":1}` {
+		t.Errorf("assertions = %v, want the redelivered message once", flows.Exec.Assertions())
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryIdempotencyStore(2)
+
+	if first, _ := s.MarkSeen(ctx, "a"); !first {
+		t.Error("first sighting of a should be reported")
+	}
+	if first, _ := s.MarkSeen(ctx, "a"); first {
+		t.Error("a should be deduplicated")
+	}
+	s.MarkSeen(ctx, "b")
+	s.MarkSeen(ctx, "c") // evicts a
+	if first, _ := s.MarkSeen(ctx, "a"); !first {
+		t.Error("a should have been evicted")
+	}
+}
+
+func TestMemoryIdempotencyStoreForget(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryIdempotencyStore(2)
+
+	s.MarkSeen(ctx, "a")
+	s.MarkSeen(ctx, "b")
+	if err := s.Forget(ctx, "a"); err != nil {
+		t.Fatalf("Forget() error = %v", err)
+	}
+	if first, _ := s.MarkSeen(ctx, "a"); !first {
+		t.Error("forgotten key should be seen for the first time again")
+	}
+	if first, _ := s.MarkSeen(ctx, "b"); first {
+		t.Error("b should still be remembered")
+	}
+}
+
+func TestHandlerCorrelation(t *testing.T) {
+	handle := func(flows *flowtest.Resolver, withHeader bool) (bool, error) {
+		called := false
+		h := wrapHandler(flows, func(context.Context, *Message) error { called = true; return nil },
+			newOptions([]Option{WithCorrelation("Order Processing")}))
+
+		msg := &Message{ID: "m1", Payload: []byte(`{"order_id":"O1"}`)}
+		if withHeader {
+			flow.Inject(flow.ContextWithFlow(context.Background(), flows.Exec.Info), msg.Carrier())
+		}
+		err := h(context.Background(), msg)
+		return called, err
+	}
+
+	t.Run("Records on the correlated flow", func(t *testing.T) {
+		flows := newResolver()
+		if _, err := handle(flows, false); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		if len(flows.Exec.Assertions()) != 1 || flows.Exec.Assertions()[0] != `{"order_id":"O1"}` {
+			t.Errorf("assertions = %v", flows.Exec.Assertions())
+		}
+	})
+
+	t.Run("Uncorrelated message is handled silently", func(t *testing.T) {
+		flows := newResolver()
+		flows.CorrelateErr = &flow.FlowError{Op: "Correlate", Err: flow.ErrFlowNotFound}
+		if called, err := handle(flows, false); err != nil || !called {
+			t.Errorf("handler = %v, called %v; want nil and called", err, called)
+		}
+	})
+
+	t.Run("Missing propagated flow is reported", func(t *testing.T) {
+		flows := newResolver()
+		flows.ResumeErr = &flow.FlowError{Op: "Resume", Err: flow.ErrFlowNotFound}
+		called, err := handle(flows, true)
+		if !flow.IsNotFound(err) || !called {
+			t.Errorf("handler = %v, called %v; want ErrFlowNotFound and called", err, called)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package flowmsg
+
+import (
+	"context"
+	"sync"
+)
+
+// IdempotencyStore remembers which messages were already recorded, so broker
+// redeliveries do not produce duplicate points or assertions.
+type IdempotencyStore interface {
+	// MarkSeen records key and reports whether it was seen for the first time.
+	MarkSeen(ctx context.Context, key string) (bool, error)
+	// Forget removes key after the message failed to be recorded, so its
+	// redelivery is recorded.
+	Forget(ctx context.Context, key string) error
+}
+
+type memoryStore struct {
+	maxSize int
+	seen    map[string]struct{}
+	order   []string
+	mu      sync.Mutex
+}
+
+// NewMemoryIdempotencyStore keeps the most recent maxSize keys in memory.
+func NewMemoryIdempotencyStore(maxSize int) IdempotencyStore {
+	return &memoryStore{
+		maxSize: maxSize,
+		seen:    make(map[string]struct{}, maxSize),
+	}
+}
+
+func (s *memoryStore) MarkSeen(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seen[key]; ok {
+		return false, nil
+	}
+	if s.maxSize > 0 && len(s.order) >= s.maxSize {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.seen[key] = struct{}{}
+	s.order = append(s.order, key)
+	return true, nil
+}
+
+func (s *memoryStore) Forget(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seen[key]; !ok {
+		return nil
+	}
+	delete(s.seen, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package flowmsg integrates flows with message brokers through a
+// broker-agnostic Message and producer/consumer decorators.
+package flowmsg
+
+import (
+	"context"
+	"encoding/json"
+
+	"flow-tool/pkg/flow"
+)
+
+// Message is the broker-agnostic view of a message. Adapters convert their
+// broker's native message (Kafka record, SQS message, AMQP delivery...) to it.
+type Message struct {
+	ID      string
+	Topic   string
+	Key     string
+	Headers map[string]string
+	Payload []byte
+}
+
+// Carrier exposes the message headers as a flow carrier.
+func (m *Message) Carrier() flow.TextMapCarrier {
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	return flow.MapCarrier(m.Headers)
+}
+
+// Publisher sends a message to a broker.
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+func (fn PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return fn(ctx, msg)
+}
+
+// Handler processes a consumed message.
+type Handler func(ctx context.Context, msg *Message) error
+
+// PayloadExtractor turns a message into the value recorded on the flow.
+type PayloadExtractor func(msg *Message) (interface{}, error)
+
+// JSONPayload records JSON payloads as-is and anything else as a string.
+func JSONPayload(msg *Message) (interface{}, error) {
+	if json.Valid(msg.Payload) {
+		return json.RawMessage(msg.Payload), nil
+	}
+	return string(msg.Payload), nil
+}
@@ -0,0 +1,121 @@
+package flowmsg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"flow-tool/pkg/flow"
+)
+
+// WrapPublisher injects the flow stored in ctx into the message headers and,
+// once the message is published, records it as a point. Messages published
+// outside a flow are passed through unchanged.
+func WrapPublisher(client *flow.FlowClient, next Publisher, opts ...Option) Publisher {
+	return wrapPublisher(client.Resolver(), next, newOptions(opts))
+}
+
+func wrapPublisher(flows flow.FlowResolver, next Publisher, o *options) Publisher {
+	return PublisherFunc(func(ctx context.Context, msg *Message) error {
+		if _, ok := flow.FlowFromContext(ctx); !ok {
+			return next.Publish(ctx, msg)
+		}
+		flow.Inject(ctx, msg.Carrier())
+
+		// A message that never left has no consumer to assert it.
+		if err := next.Publish(ctx, msg); err != nil {
+			return err
+		}
+
+		f, ok := flow.ExecutorFromContext(ctx)
+		var err error
+		if !ok {
+			f, err = flows.FromContext(ctx)
+		}
+		if err == nil {
+			err = o.record(ctx, f, msg, "point", func(payload interface{}) error {
+				return f.CreatePoint(ctx, o.describe(msg), payload)
+			})
+		}
+		if err != nil {
+			return o.onError(ctx, msg, err)
+		}
+		return nil
+	})
+}
+
+// WrapHandler resumes the flow propagated in the message headers, records the
+// message as an assertion and calls next with the flow stored in ctx.
+// Messages without a propagated flow are handled unchanged.
+func WrapHandler(client *flow.FlowClient, next Handler, opts ...Option) Handler {
+	return wrapHandler(client.Resolver(), next, newOptions(opts))
+}
+
+func wrapHandler(flows flow.FlowResolver, next Handler, o *options) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		f, err := flows.Resume(ctx, msg.Carrier())
+		correlated := false
+		if flow.IsNoFlowContext(err) && o.correlate {
+			f, err = o.correlateFlow(ctx, flows, msg)
+			correlated = true
+		}
+		if err != nil {
+			// Most uncorrelated messages belong to no flow; a flow named by
+			// propagated headers that cannot be found is reported.
+			if flow.IsNoFlowContext(err) || (correlated && flow.IsNotFound(err)) {
+				return next(ctx, msg)
+			}
+			flowErr := o.onError(ctx, msg, err)
+			return errors.Join(next(ctx, msg), flowErr)
+		}
+		ctx = flow.ContextWithExecutor(ctx, f)
+
+		var flowErr error
+		if err := o.record(ctx, f, msg, "assertion", func(payload interface{}) error {
+			return f.AddAssertion(ctx, payload)
+		}); err != nil {
+			flowErr = o.onError(ctx, msg, err)
+		}
+
+		return errors.Join(next(ctx, msg), flowErr)
+	}
+}
+
+// correlateFlow finds the flow of a message without headers from its payload.
+func (o *options) correlateFlow(ctx context.Context, flows flow.FlowResolver, msg *Message) (flow.FlowExecutor, error) {
+	payload, err := o.payload(msg)
+	if err != nil {
+		return nil, fmt.Errorf("flowmsg: failed to extract payload: %w", err)
+	}
+	return flows.Correlate(ctx, payload, o.flowNames...)
+}
+
+// record deduplicates msg per flow and stores its extracted payload with save.
+// A message that fails to be stored is forgotten, so its redelivery is not
+// dropped as a duplicate.
+func (o *options) record(ctx context.Context, f flow.FlowExecutor, msg *Message, kind string, save func(interface{}) error) error {
+	key := o.idempotencyKey(msg)
+	if key != "" {
+		key = fmt.Sprintf("%s:%d:%s", kind, f.GetFlowInfo().ID, key)
+		first, err := o.store.MarkSeen(ctx, key)
+		if err != nil {
+			return fmt.Errorf("flowmsg: idempotency check failed: %w", err)
+		}
+		if !first {
+			return nil
+		}
+	}
+
+	payload, err := o.payload(msg)
+	if err != nil {
+		err = fmt.Errorf("flowmsg: failed to extract payload: %w", err)
+	} else {
+		err = save(payload)
+	}
+	if err != nil && key != "" {
+		if forgetErr := o.store.Forget(ctx, key); forgetErr != nil {
+			err = errors.Join(err, fmt.Errorf("flowmsg: failed to forget idempotency key: %w", forgetErr))
+		}
+	}
+	return err
+}
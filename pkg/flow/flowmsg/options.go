@@ -0,0 +1,87 @@
+package flowmsg
+
+import "context"
+
+type options struct {
+	payload        PayloadExtractor
+	describe       func(*Message) string
+	idempotencyKey func(*Message) string
+	store          IdempotencyStore
+	onError        func(context.Context, *Message, error) error
+	correlate      bool
+	flowNames      []string
+}
+
+// Option configures the producer and consumer decorators.
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		payload: JSONPayload,
+		describe: func(m *Message) string {
+			if m.Topic != "" {
+				return m.Topic
+			}
+			return "message"
+		},
+		idempotencyKey: func(m *Message) string {
+			return m.ID
+		},
+		store: NewMemoryIdempotencyStore(10000),
+		onError: func(_ context.Context, _ *Message, err error) error {
+			return err
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPayloadExtractor sets how the recorded value is derived from a message.
+func WithPayloadExtractor(fn PayloadExtractor) Option {
+	return func(o *options) {
+		o.payload = fn
+	}
+}
+
+// WithDescription sets how point descriptions are derived from published messages.
+func WithDescription(fn func(*Message) string) Option {
+	return func(o *options) {
+		o.describe = fn
+	}
+}
+
+// WithIdempotencyKey sets the deduplication key of a message (default: Message.ID).
+// Messages with an empty key are always recorded.
+func WithIdempotencyKey(fn func(*Message) string) Option {
+	return func(o *options) {
+		o.idempotencyKey = fn
+	}
+}
+
+// WithIdempotencyStore replaces the default in-memory store, e.g. with one shared
+// by all consumer replicas.
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithErrorHandler receives flow errors. Returning nil swallows the error;
+// by default it is returned alongside the result of the wrapped call.
+func WithErrorHandler(fn func(ctx context.Context, msg *Message, err error) error) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// WithCorrelation lets the consumer find the flow from the payload alone, using
+// the client's correlation rules, when a message carries no flow headers.
+// When flowNames is given, only those flows are considered.
+func WithCorrelation(flowNames ...string) Option {
+	return func(o *options) {
+		o.correlate = true
+		o.flowNames = flowNames
+	}
+}
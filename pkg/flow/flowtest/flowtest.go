@@ -0,0 +1,141 @@
+// Package flowtest provides in-memory fakes of a flow and of its lookup for
+// testing code built on flow.FlowExecutor and flow.FlowResolver, such as the
+// flowhttp and flowmsg adapters, without a database.
+package flowtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"flow-tool/pkg/flow"
+)
+
+// ErrUnavailable is returned by the recordings an Executor is told to fail.
+var ErrUnavailable = errors.New("flowtest: storage unavailable")
+
+// Point is a point recorded on an Executor, with its payload as JSON.
+type Point struct {
+	Description string
+	Expected    string
+}
+
+// Executor is a flow.FlowExecutor that keeps what is recorded on it as JSON.
+type Executor struct {
+	Info *flow.Flow
+	// Failures is the number of next recordings that fail with ErrUnavailable.
+	Failures int
+
+	mu         sync.Mutex
+	points     []Point
+	assertions []string
+}
+
+// NewExecutor returns an Executor for info.
+func NewExecutor(info *flow.Flow) *Executor {
+	return &Executor{Info: info}
+}
+
+// Points returns the points recorded so far.
+func (e *Executor) Points() []Point {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Point(nil), e.points...)
+}
+
+// Assertions returns the payloads of the assertions recorded so far.
+func (e *Executor) Assertions() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.assertions...)
+}
+
+func (e *Executor) save(v interface{}) (string, error) {
+	if e.Failures > 0 {
+		e.Failures--
+		return "", ErrUnavailable
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (e *Executor) CreatePoint(ctx context.Context, description string, expected interface{}, opts ...flow.PointOption) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, err := e.save(expected)
+	if err != nil {
+		return err
+	}
+	e.points = append(e.points, Point{Description: description, Expected: s})
+	return nil
+}
+
+func (e *Executor) AddAssertion(ctx context.Context, actual interface{}, opts ...flow.AssertionOption) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, err := e.save(actual)
+	if err != nil {
+		return err
+	}
+	e.assertions = append(e.assertions, s)
+	return nil
+}
+
+func (e *Executor) AddIdentifier(ctx context.Context, kind, value string) error { return nil }
+func (e *Executor) Finish(ctx context.Context) (*flow.FinishResult, error) {
+	return &flow.FinishResult{}, nil
+}
+func (e *Executor) GetFlowInfo() *flow.Flow { return e.Info }
+
+// Resolver is a flow.FlowResolver that resolves propagated, context and
+// correlated flows to Exec.
+type Resolver struct {
+	Exec *Executor
+	// ResumeErr fails the lookup of propagated flows, CorrelateErr that of
+	// payloads.
+	ResumeErr    error
+	CorrelateErr error
+
+	mu      sync.Mutex
+	lookups int
+}
+
+// NewResolver returns a Resolver of a new Executor for info.
+func NewResolver(info *flow.Flow) *Resolver {
+	return &Resolver{Exec: NewExecutor(info)}
+}
+
+// Lookups returns how many times FromContext was called.
+func (r *Resolver) Lookups() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func (r *Resolver) Resume(ctx context.Context, carrier flow.TextMapCarrier) (flow.FlowExecutor, error) {
+	if _, err := flow.Extract(carrier); err != nil {
+		return nil, err
+	}
+	if r.ResumeErr != nil {
+		return nil, r.ResumeErr
+	}
+	return r.Exec, nil
+}
+
+func (r *Resolver) FromContext(ctx context.Context) (flow.FlowExecutor, error) {
+	r.mu.Lock()
+	r.lookups++
+	r.mu.Unlock()
+	if _, ok := flow.FlowFromContext(ctx); !ok {
+		return nil, flow.ErrNoFlowContext
+	}
+	return r.Exec, nil
+}
+
+func (r *Resolver) Correlate(ctx context.Context, payload interface{}, flowNames ...string) (flow.FlowExecutor, error) {
+	if r.CorrelateErr != nil {
+		return nil, r.CorrelateErr
+	}
+	return r.Exec, nil
+}
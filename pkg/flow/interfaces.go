@@ -14,11 +14,15 @@ type FlowTracker interface {
 
 type FlowExecutor interface {
 	CreatePoint(ctx context.Context, description string, expected interface{}, opts ...PointOption) error
-	AddAssertion(ctx context.Context, actual interface{}) error
+	AddAssertion(ctx context.Context, actual interface{}, opts ...AssertionOption) error
+	AddIdentifier(ctx context.Context, kind, value string) error
 	Finish(ctx context.Context) (*FinishResult, error)
 	GetFlowInfo() *Flow
 }
 
+// Validator replaces DeepCompare for points created WithValidator. It gets
+// the decoded expected and actual values (numbers as json.Number) and returns
+// a message and false on mismatch.
 type Validator interface {
 	Validate(expected, actual interface{}) (string, bool)
 }
@@ -44,6 +48,28 @@ type FlowConfig struct {
 	CacheEnabled  bool
 	MaxCacheSize  int
 	Timeout       time.Duration
+	// Correlation maps a flow name to JSONPaths (e.g. "$.order_id") that
+	// extract its identifier from a payload. See FlowClient.Correlate.
+	Correlation map[string][]string
+	// CompareOptions apply to every point this client creates or finishes;
+	// FlowCompareOptions add rules per flow name.
+	CompareOptions     CompareOptions
+	FlowCompareOptions map[string]CompareOptions
+	// Validators are registered by name for points created WithValidator.
+	Validators map[string]Validator
+	// Redaction rules run on every payload before it is stored; hashed
+	// values use RedactionSalt, which services comparing them must share.
+	Redaction     []RedactionRule
+	RedactionSalt string
+	// MaxPayloadBytes caps the encoded size of stored payloads (0 means no
+	// limit); OversizePolicy decides what happens to larger ones.
+	MaxPayloadBytes int
+	OversizePolicy  string
+	// CompressAbove gzips payloads larger than this many bytes (0 disables).
+	CompressAbove int
+	// Encryption encrypts payloads at rest; only clients holding the keys
+	// can compare or read them.
+	Encryption KeyProvider
 }
 
 type StorageConfig struct {
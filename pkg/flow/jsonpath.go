@@ -0,0 +1,188 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segKey segmentKind = iota
+	segIndex
+	segWildcard
+	segRecursive
+)
+
+// pathSegment is one step of a JSONPath such as $.items[0].id or $..order_id.
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// parsePath parses the JSONPath subset used across the package: dotted keys,
+// bracketed keys (['a.b']), indexes ([0]), wildcards (.* and [*]) and
+// recursive descent (..key).
+func parsePath(path string) ([]pathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("flow: path %q must start with $", path)
+	}
+
+	var segs []pathSegment
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			segs = append(segs, pathSegment{kind: segRecursive})
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".[") {
+				rest = rest[1:]
+			}
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("flow: empty key in path %q", path)
+			}
+			if name == "*" {
+				segs = append(segs, pathSegment{kind: segWildcard})
+			} else {
+				segs = append(segs, pathSegment{kind: segKey, key: name})
+			}
+			rest = rest[end:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("flow: unterminated bracket in path %q", path)
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				segs = append(segs, pathSegment{kind: segWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segs = append(segs, pathSegment{kind: segKey, key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("flow: invalid index %q in path %q", inner, path)
+				}
+				segs = append(segs, pathSegment{kind: segIndex, index: i})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("flow: unexpected %q in path %q", rest[0], path)
+		}
+	}
+	if n := len(segs); n > 0 && segs[n-1].kind == segRecursive {
+		return nil, fmt.Errorf("flow: path %q cannot end with ..", path)
+	}
+	return segs, nil
+}
+
+// evalPath returns every value of doc selected by segs.
+func evalPath(doc interface{}, segs []pathSegment) []interface{} {
+	if len(segs) == 0 {
+		return []interface{}{doc}
+	}
+
+	seg, rest := segs[0], segs[1:]
+	var out []interface{}
+	switch seg.kind {
+	case segKey:
+		if m, ok := doc.(map[string]interface{}); ok {
+			if v, ok := m[seg.key]; ok {
+				out = append(out, evalPath(v, rest)...)
+			}
+		}
+	case segIndex:
+		if s, ok := doc.([]interface{}); ok && seg.index < len(s) {
+			out = append(out, evalPath(s[seg.index], rest)...)
+		}
+	case segWildcard:
+		for _, child := range children(doc) {
+			out = append(out, evalPath(child, rest)...)
+		}
+	case segRecursive:
+		out = append(out, evalPath(doc, rest)...)
+		for _, child := range children(doc) {
+			out = append(out, evalPath(child, segs)...)
+		}
+	}
+	return out
+}
+
+func children(doc interface{}) []interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			out = append(out, v[k])
+		}
+		return out
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+// ExtractPath evaluates a JSONPath against a JSON document.
+func ExtractPath(doc json.RawMessage, path string) ([]interface{}, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return evalPath(v, segs), nil
+}
+
+// decodeJSON unmarshals a document keeping numbers as json.Number, so int64
+// IDs above 2^53 and decimal amounts survive without float64 rounding.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// scalarString renders a scalar JSON value as an identifier.
+func scalarString(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, val != ""
+	case json.Number:
+		return val.String(), true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtractPath(t *testing.T) {
+	doc := json.RawMessage(`{
+		"order_id": "ORD-1",
+		"payment": {"payment_id": 9007199254740993, "method": "pix"},
+		"items": [{"id": "A", "meta": {"order_id": "ORD-2"}}, {"id": "B"}],
+		"a.b": true
+	}`)
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"$.order_id", []interface{}{"ORD-1"}},
+		{"$.payment.payment_id", []interface{}{json.Number("9007199254740993")}},
+		{"$.items[1].id", []interface{}{"B"}},
+		{"$.items[*].id", []interface{}{"A", "B"}},
+		{"$['a.b']", []interface{}{true}},
+		{"$..order_id", []interface{}{"ORD-1", "ORD-2"}},
+		{"$.items[5].id", nil},
+		{"$.missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ExtractPath(doc, tt.path)
+			if err != nil {
+				t.Fatalf("ExtractPath() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractPath() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	for _, p := range []string{"order_id", "$.", "$.items[", "$.items[x]", "$..", "$a"} {
+		if _, err := parsePath(p); err == nil {
+			t.Errorf("parsePath(%q) should fail", p)
+		}
+	}
+}
+
+func TestCorrelationCandidates(t *testing.T) {
+	rules, err := compileCorrelation(map[string][]string{
+		"Order Processing": {"$.order_id", "$.payment_id", "$..order_id"},
+	})
+	if err != nil {
+		t.Fatalf("compileCorrelation() error = %v", err)
+	}
+
+	doc, _ := decodeJSON([]byte(`{"payment_id": 77, "order": {"order_id": "ORD-1"}}`))
+	got := rules[0].candidates(doc)
+	want := []string{"77", "ORD-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates() = %v, want %v", got, want)
+	}
+}
+
+func TestCorrelationConfigValidation(t *testing.T) {
+	_, err := NewClient(nil, FlowConfig{
+		IsProduction: true,
+		Correlation:  map[string][]string{"Order Processing": {"order_id"}},
+	})
+	if err == nil {
+		t.Error("NewClient should reject invalid correlation paths")
+	}
+}
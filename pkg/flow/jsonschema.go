@@ -0,0 +1,356 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateSchema checks doc against a JSON Schema and returns one
+// DiffSchemaViolation per violation. It supports type, required, properties,
+// additionalProperties, items, enum, const, pattern, minimum/maximum (and
+// their exclusive forms), minLength/maxLength, minItems/maxItems and local
+// $ref pointers ("#/definitions/x", "#/$defs/x"). Unknown keywords are
+// ignored. An error means the schema itself is invalid.
+func ValidateSchema(schema, doc json.RawMessage) ([]DiffEntry, error) {
+	v, err := newSchemaValidator(schema)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := decodeJSON(doc)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("failed to unmarshal actual: %v", err)}}, nil
+	}
+	if _, ok := reducedDigest(instance); ok {
+		return []DiffEntry{unverifiable("schema")}, nil
+	}
+	v.validate(v.root, instance, "$", nil, 0)
+	return v.diffs, nil
+}
+
+// CheckSchema reports whether schema is a JSON Schema ValidateSchema can use.
+func CheckSchema(schema json.RawMessage) error {
+	_, err := newSchemaValidator(schema)
+	return err
+}
+
+// maxRefDepth bounds $ref chains so recursive schemas cannot loop forever.
+const maxRefDepth = 64
+
+type schemaValidator struct {
+	root    interface{}
+	regexes map[string]*regexp.Regexp
+	diffs   []DiffEntry
+}
+
+func newSchemaValidator(schema json.RawMessage) (*schemaValidator, error) {
+	root, err := decodeJSON(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	v := &schemaValidator{root: root, regexes: map[string]*regexp.Regexp{}}
+	if err := v.check(root, "#"); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return v, nil
+}
+
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// check validates the schema up front: known types, compilable patterns and
+// resolvable references.
+func (v *schemaValidator) check(node interface{}, at string) error {
+	switch s := node.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		for _, t := range typeList(s["type"]) {
+			if !schemaTypes[t] {
+				return fmt.Errorf("%s: unknown type %q", at, t)
+			}
+		}
+		if p, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", at, err)
+			}
+			v.regexes[p] = re
+		}
+		if ref, ok := s["$ref"].(string); ok {
+			if _, err := v.resolve(ref); err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		}
+		for _, k := range sortedKeys(s) {
+			switch k {
+			case "properties", "definitions", "$defs":
+				children, _ := s[k].(map[string]interface{})
+				for _, name := range sortedKeys(children) {
+					if err := v.check(children[name], at+"/"+k+"/"+name); err != nil {
+						return err
+					}
+				}
+			case "items", "additionalProperties":
+				if tuple, ok := s[k].([]interface{}); ok && k == "items" {
+					for i, item := range tuple {
+						if err := v.check(item, fmt.Sprintf("%s/items/%d", at, i)); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				if err := v.check(s[k], at+"/"+k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("%s: schema must be an object or a boolean", at)
+}
+
+// resolve follows a local JSON Pointer reference.
+func (v *schemaValidator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+	cur := v.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return cur, nil
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if cur, ok = obj[tok]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return cur, nil
+}
+
+func (v *schemaValidator) fail(path string, segs []pathSegment, keyword string, actual interface{}, format string, args ...interface{}) {
+	v.diffs = append(v.diffs, DiffEntry{
+		Path:     path,
+		Kind:     DiffSchemaViolation,
+		Expected: keyword,
+		Actual:   actual,
+		Message:  fmt.Sprintf("path %s: schema %s: %s", path, keyword, fmt.Sprintf(format, args...)),
+		segs:     segs,
+	})
+}
+
+func (v *schemaValidator) validate(node, instance interface{}, path string, segs []pathSegment, depth int) {
+	s, ok := node.(map[string]interface{})
+	if !ok {
+		if b, isBool := node.(bool); isBool && !b {
+			v.fail(path, segs, "false", instance, "no value is allowed")
+		}
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		if depth >= maxRefDepth {
+			v.fail(path, segs, "$ref", instance, "reference depth exceeded at %s", ref)
+			return
+		}
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, segs, "$ref", instance, "%v", err)
+			return
+		}
+		v.validate(target, instance, path, segs, depth+1)
+	}
+
+	if types := typeList(s["type"]); len(types) > 0 && !matchesType(types, instance) {
+		expected := strings.Join(types, " or ")
+		v.fail(path, segs, "type", instance, "%v", &TypeError{expected: expected, actual: instance})
+		return
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, segs, "enum", instance, "%v is not one of %v", instance, enum)
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, instance) {
+		v.fail(path, segs, "const", instance, "%v != %v", instance, c)
+	}
+
+	switch val := instance.(type) {
+	case string:
+		v.validateString(s, val, path, segs)
+	case json.Number:
+		v.validateNumber(s, val, path, segs)
+	case []interface{}:
+		v.validateArray(s, val, path, segs, depth)
+	case map[string]interface{}:
+		v.validateObject(s, val, path, segs, depth)
+	}
+}
+
+func (v *schemaValidator) validateString(s map[string]interface{}, val, path string, segs []pathSegment) {
+	length := utf8.RuneCountInString(val)
+	if n, ok := schemaInt(s["minLength"]); ok && length < n {
+		v.fail(path, segs, "minLength", val, "length %d < %d", length, n)
+	}
+	if n, ok := schemaInt(s["maxLength"]); ok && length > n {
+		v.fail(path, segs, "maxLength", val, "length %d > %d", length, n)
+	}
+	if p, ok := s["pattern"].(string); ok {
+		if re := v.regexes[p]; re != nil && !re.MatchString(val) {
+			v.fail(path, segs, "pattern", val, "%q does not match %q", val, p)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(s map[string]interface{}, val json.Number, path string, segs []pathSegment) {
+	r, ok := new(big.Rat).SetString(val.String())
+	if !ok {
+		return
+	}
+	checks := []struct {
+		keyword string
+		op      string
+		fails   func(cmp int) bool
+	}{
+		{"minimum", "<", func(cmp int) bool { return cmp < 0 }},
+		{"maximum", ">", func(cmp int) bool { return cmp > 0 }},
+		{"exclusiveMinimum", "<=", func(cmp int) bool { return cmp <= 0 }},
+		{"exclusiveMaximum", ">=", func(cmp int) bool { return cmp >= 0 }},
+	}
+	for _, c := range checks {
+		n, ok := s[c.keyword].(json.Number)
+		if !ok {
+			continue
+		}
+		b, ok := new(big.Rat).SetString(n.String())
+		if ok && c.fails(r.Cmp(b)) {
+			v.fail(path, segs, c.keyword, val, "%s %s %s", val, c.op, n)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(s map[string]interface{}, val []interface{}, path string, segs []pathSegment, depth int) {
+	if n, ok := schemaInt(s["minItems"]); ok && len(val) < n {
+		v.fail(path, segs, "minItems", len(val), "%d items < %d", len(val), n)
+	}
+	if n, ok := schemaInt(s["maxItems"]); ok && len(val) > n {
+		v.fail(path, segs, "maxItems", len(val), "%d items > %d", len(val), n)
+	}
+	items, ok := s["items"]
+	if !ok {
+		return
+	}
+	tuple, positional := items.([]interface{})
+	for i, item := range val {
+		sub := items
+		if positional {
+			if i >= len(tuple) {
+				break
+			}
+			sub = tuple[i]
+		}
+		v.validate(sub, item, elemPath(path, i), elemSegs(segs, i), depth)
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]interface{}, val map[string]interface{}, path string, segs []pathSegment, depth int) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := val[name]; !present {
+				childSegs := childPath(segs, pathSegment{kind: segKey, key: name})
+				v.fail(path+"."+name, childSegs, "required", nil, "required property missing")
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	for _, k := range sortedKeys(val) {
+		keyPath, keySegs := path+"."+k, childPath(segs, pathSegment{kind: segKey, key: k})
+		if sub, ok := props[k]; ok {
+			v.validate(sub, val[k], keyPath, keySegs, depth)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if b, ok := additional.(bool); ok {
+			if !b {
+				v.fail(keyPath, keySegs, "additionalProperties", val[k], "property not allowed")
+			}
+			continue
+		}
+		v.validate(additional, val[k], keyPath, keySegs, depth)
+	}
+}
+
+func typeList(t interface{}) []string {
+	switch val := t.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		var out []string
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func matchesType(types []string, instance interface{}) bool {
+	actual := getTypeName(instance)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+		if t == "integer" && actual == "number" {
+			if n, ok := instance.(json.Number); ok {
+				if r, ok := new(big.Rat).SetString(n.String()); ok && r.IsInt() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func schemaInt(v interface{}) (int, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(n.String())
+	return i, err == nil
+}
+
+// jsonEqual compares decoded JSON values, numbers by value.
+func jsonEqual(a, b interface{}) bool {
+	c, _ := newComparer(CompareOptions{})
+	c.collectDiffs(a, b, "$", nil)
+	return len(c.diffs) == 0
+}
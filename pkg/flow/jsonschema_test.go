@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "status", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^ORD-", "minLength": 5},
+		"status": {"enum": ["NEW", "PAID"]},
+		"total": {"type": "number", "minimum": 0, "exclusiveMaximum": 10000},
+		"items": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/item"}},
+		"note": {"type": ["string", "null"], "maxLength": 10}
+	},
+	"$defs": {
+		"item": {
+			"type": "object",
+			"required": ["sku", "qty"],
+			"properties": {"sku": {"type": "string"}, "qty": {"type": "integer", "minimum": 1}}
+		}
+	}
+}`
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		wantPaths []string
+	}{
+		{"Valid", `{"id": "ORD-1", "status": "NEW", "total": 10.5, "items": [{"sku": "A", "qty": 1}], "note": null}`, nil},
+		{"Integer written as decimal", `{"id": "ORD-1", "status": "NEW", "items": [{"sku": "A", "qty": 2.0}]}`, nil},
+		{"Missing required", `{"id": "ORD-1", "items": [{"sku": "A", "qty": 1}]}`, []string{"$.status"}},
+		{"Pattern and enum", `{"id": "INV-12", "status": "LOST", "items": [{"sku": "A", "qty": 1}]}`, []string{"$.id", "$.status"}},
+		{"Bounds", `{"id": "ORD-1", "status": "NEW", "total": 10000, "items": []}`, []string{"$.items", "$.total"}},
+		{"Ref item violations", `{"id": "ORD-1", "status": "NEW", "items": [{"sku": 1, "qty": 0.5}, {"qty": 0}]}`,
+			[]string{"$.items[0].qty", "$.items[0].sku", "$.items[1].sku", "$.items[1].qty"}},
+		{"Additional property", `{"id": "ORD-1", "status": "NEW", "items": [{"sku": "A", "qty": 1}], "extra": 1}`, []string{"$.extra"}},
+		{"Type mismatch at root", `[]`, []string{"$"}},
+		{"Union type", `{"id": "ORD-1", "status": "NEW", "items": [{"sku": "A", "qty": 1}], "note": 5}`, []string{"$.note"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := ValidateSchema(json.RawMessage(orderSchema), json.RawMessage(tt.doc))
+			if err != nil {
+				t.Fatalf("ValidateSchema() error = %v", err)
+			}
+			if len(diffs) != len(tt.wantPaths) {
+				t.Fatalf("ValidateSchema() = %v, want paths %v", diffs, tt.wantPaths)
+			}
+			for i, d := range diffs {
+				if d.Kind != DiffSchemaViolation || d.Path != tt.wantPaths[i] {
+					t.Errorf("diff[%d] = %s %s, want schema_violation at %s", i, d.Kind, d.Path, tt.wantPaths[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "text"}`,
+		`{"pattern": "("}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "http://example.com/schema.json"}`,
+		`{"properties": {"a": 1}}`,
+		`not json`,
+	} {
+		if err := CheckSchema(json.RawMessage(schema)); err == nil {
+			t.Errorf("CheckSchema(%s) should fail", schema)
+		}
+	}
+	if err := CheckSchema(json.RawMessage(orderSchema)); err != nil {
+		t.Errorf("CheckSchema(orderSchema) error = %v", err)
+	}
+}
+
+func TestValidateWithSchemaUsesSchema(t *testing.T) {
+	doc := json.RawMessage(`{"id": "INV-1", "status": "NEW", "items": [{"sku": "A", "qty": 1}]}`)
+	msg, ok := ValidateWithSchema(doc, doc, json.RawMessage(orderSchema))
+	if ok || !strings.Contains(msg, "schema pattern") {
+		t.Errorf("ValidateWithSchema() = %q, %v; want a pattern violation", msg, ok)
+	}
+}
+
+func TestComparePointSchemaEnabled(t *testing.T) {
+	p := Point{
+		Expected: json.RawMessage(`{"id": "INV-1"}`),
+		Schema:   json.RawMessage(`{"properties": {"id": {"pattern": "^ORD-"}}}`),
+	}
+	a := Assertion{Actual: json.RawMessage(`{"id": "INV-1"}`)}
+
+	disabled, _ := NewClient(nil, FlowConfig{IsProduction: true})
+	if diffs := disabled.comparePoint("Order", p, a); len(diffs) != 0 {
+		t.Errorf("comparePoint() without SchemaEnabled = %v", diffs)
+	}
+
+	enabled, _ := NewClient(nil, FlowConfig{IsProduction: true, SchemaEnabled: true})
+	diffs := enabled.comparePoint("Order", p, a)
+	if len(diffs) != 1 || diffs[0].Kind != DiffSchemaViolation {
+		t.Errorf("comparePoint() with SchemaEnabled = %v", diffs)
+	}
+}
@@ -0,0 +1,248 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// MatcherKey is the reserved key that marks a matcher inside an expected
+// payload: {"$flow_matcher": "regex", "pattern": "^ORD-"}.
+const MatcherKey = "$flow_matcher"
+
+// Matcher kinds.
+const (
+	MatchAny       = "any"
+	MatchString    = "string"
+	MatchNumber    = "number"
+	MatchRegex     = "regex"
+	MatchBetween   = "between"
+	MatchTimestamp = "timestamp"
+)
+
+// Matcher is a placeholder for a value the producer cannot know exactly, such
+// as a generated UUID or a timestamp. Place it anywhere in an expected payload:
+//
+//	f.CreatePoint(ctx, "Order Created", map[string]interface{}{
+//	    "id":         flow.Regex("^ORD-"),
+//	    "created_at": flow.Timestamp(),
+//	})
+type Matcher struct {
+	Kind    string   `json:"$flow_matcher"`
+	Pattern string   `json:"pattern,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Layout  string   `json:"layout,omitempty"`
+}
+
+// Any matches any present value, including null.
+func Any() Matcher { return Matcher{Kind: MatchAny} }
+
+// AnyString matches any string.
+func AnyString() Matcher { return Matcher{Kind: MatchString} }
+
+// AnyNumber matches any number.
+func AnyNumber() Matcher { return Matcher{Kind: MatchNumber} }
+
+// Regex matches strings against an RE2 pattern.
+func Regex(pattern string) Matcher { return Matcher{Kind: MatchRegex, Pattern: pattern} }
+
+// Between matches numbers in [min, max].
+func Between(min, max float64) Matcher {
+	return Matcher{Kind: MatchBetween, Min: &min, Max: &max}
+}
+
+// Timestamp matches strings parseable with layout (RFC 3339 by default).
+func Timestamp(layout ...string) Matcher {
+	m := Matcher{Kind: MatchTimestamp}
+	if len(layout) > 0 {
+		m.Layout = layout[0]
+	}
+	return m
+}
+
+// String describes the matcher in diffs, e.g. regex(^ORD-).
+func (m Matcher) String() string {
+	switch m.Kind {
+	case MatchRegex:
+		return fmt.Sprintf("regex(%s)", m.Pattern)
+	case MatchBetween:
+		return fmt.Sprintf("between(%s, %s)", formatBound(m.Min), formatBound(m.Max))
+	case MatchTimestamp:
+		if m.Layout != "" {
+			return fmt.Sprintf("timestamp(%s)", m.Layout)
+		}
+		return "timestamp()"
+	case MatchString:
+		return "anyString()"
+	case MatchNumber:
+		return "anyNumber()"
+	}
+	return m.Kind + "()"
+}
+
+func formatBound(v *float64) string {
+	if v == nil {
+		return "*"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// Validate checks the matcher kind and its arguments.
+func (m Matcher) Validate() error {
+	switch m.Kind {
+	case MatchAny, MatchString, MatchNumber, MatchTimestamp:
+		return nil
+	case MatchRegex:
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return fmt.Errorf("invalid regex matcher: %w", err)
+		}
+		return nil
+	case MatchBetween:
+		if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+			return fmt.Errorf("invalid between matcher: min %v > max %v", *m.Min, *m.Max)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown matcher %q", m.Kind)
+}
+
+// matcherFrom recognises a decoded matcher object.
+func matcherFrom(v interface{}) (Matcher, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return Matcher{}, false
+	}
+	kind, ok := obj[MatcherKey].(string)
+	if !ok {
+		return Matcher{}, false
+	}
+	m := Matcher{Kind: kind}
+	m.Pattern, _ = obj["pattern"].(string)
+	m.Layout, _ = obj["layout"].(string)
+	m.Min = boundFrom(obj["min"])
+	m.Max = boundFrom(obj["max"])
+	return m, true
+}
+
+func boundFrom(v interface{}) *float64 {
+	switch n := v.(type) {
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return &f
+		}
+	case float64:
+		return &n
+	}
+	return nil
+}
+
+// match reports whether actual satisfies the matcher.
+func (m Matcher) match(actual interface{}, regexes map[string]*regexp.Regexp) (bool, error) {
+	switch m.Kind {
+	case MatchAny:
+		return true, nil
+	case MatchString:
+		_, ok := actual.(string)
+		return ok, nil
+	case MatchNumber:
+		_, ok := actual.(json.Number)
+		return ok, nil
+	case MatchRegex:
+		s, ok := actual.(string)
+		if !ok {
+			return false, nil
+		}
+		re, ok := regexes[m.Pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(m.Pattern); err != nil {
+				return false, fmt.Errorf("invalid regex matcher: %w", err)
+			}
+			regexes[m.Pattern] = re
+		}
+		return re.MatchString(s), nil
+	case MatchBetween:
+		n, ok := actual.(json.Number)
+		if !ok {
+			return false, nil
+		}
+		r, ok := new(big.Rat).SetString(n.String())
+		if !ok {
+			return false, nil
+		}
+		if m.Min != nil && r.Cmp(decimalRat(*m.Min)) < 0 {
+			return false, nil
+		}
+		if m.Max != nil && r.Cmp(decimalRat(*m.Max)) > 0 {
+			return false, nil
+		}
+		return true, nil
+	case MatchTimestamp:
+		s, ok := actual.(string)
+		if !ok {
+			return false, nil
+		}
+		layout := m.Layout
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		_, err := time.Parse(layout, s)
+		return err == nil, nil
+	}
+	return false, fmt.Errorf("unknown matcher %q", m.Kind)
+}
+
+// decimalRat converts a bound through its shortest decimal form, so
+// Between(0.1, 0.3) includes 0.1 as written in JSON.
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return r
+}
+
+// hasMatchers reports whether a decoded document embeds a matcher.
+func hasMatchers(v interface{}) bool {
+	if _, ok := matcherFrom(v); ok {
+		return true
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, child := range val {
+			if hasMatchers(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range val {
+			if hasMatchers(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateMatchers checks every matcher embedded in a decoded document.
+func validateMatchers(v interface{}) error {
+	if m, ok := matcherFrom(v); ok {
+		return m.Validate()
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			if err := validateMatchers(val[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range val {
+			if err := validateMatchers(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
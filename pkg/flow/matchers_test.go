@@ -0,0 +1,72 @@
+package flow
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDeepCompareMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher Matcher
+		actual  string
+		want    bool
+	}{
+		{"Any string", Any(), `"x"`, true},
+		{"Any null", Any(), `null`, true},
+		{"AnyString", AnyString(), `"ORD-1"`, true},
+		{"AnyString on number", AnyString(), `1`, false},
+		{"AnyNumber", AnyNumber(), `9007199254740993`, true},
+		{"AnyNumber on string", AnyNumber(), `"1"`, false},
+		{"Regex match", Regex("^ORD-"), `"ORD-42"`, true},
+		{"Regex mismatch", Regex("^ORD-"), `"INV-42"`, false},
+		{"Between inside", Between(0, 1), `0.5`, true},
+		{"Between inclusive decimal", Between(0.1, 0.3), `0.1`, true},
+		{"Between outside", Between(0, 1), `1.0001`, false},
+		{"Timestamp RFC 3339", Timestamp(), `"2026-01-02T15:04:05.123Z"`, true},
+		{"Timestamp custom layout", Timestamp("2006-01-02"), `"2026-01-02"`, true},
+		{"Timestamp invalid", Timestamp(), `"yesterday"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := json.Marshal(map[string]interface{}{"v": tt.matcher})
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			actual := []byte(`{"v": ` + tt.actual + `}`)
+			diffs, equal := DeepCompare(expected, actual)
+			if equal != tt.want {
+				t.Errorf("DeepCompare() equal = %v, want %v. Diffs: %v", equal, tt.want, diffs)
+			}
+		})
+	}
+}
+
+func TestMatcherMissingKey(t *testing.T) {
+	expected, _ := json.Marshal(map[string]interface{}{"id": Any()})
+	if _, equal := DeepCompare(expected, []byte(`{}`)); equal {
+		t.Error("Any() should not match a missing key")
+	}
+}
+
+func TestValidateMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     interface{}
+		wantErr bool
+	}{
+		{"Valid", map[string]interface{}{"id": Regex("^ORD-"), "items": []interface{}{Between(0, 1)}}, false},
+		{"Bad regex", map[string]interface{}{"items": []interface{}{Regex("(")}}, true},
+		{"Inverted range", Between(2, 1), true},
+		{"Unknown kind", Matcher{Kind: "uuid"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, _ := json.Marshal(tt.doc)
+			doc, _ := decodeJSON(raw)
+			if err := validateMatchers(doc); (err != nil) != tt.wantErr {
+				t.Errorf("validateMatchers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package flow
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Normalization transforms, applied before comparison in the order given.
+const (
+	NormalizeTrim          = "trim"            // strip surrounding whitespace
+	NormalizeLower         = "lower"           // lower-case strings
+	NormalizeUpper         = "upper"           // upper-case strings
+	NormalizeNumber        = "number"          // numeric strings ("150.50") become numbers
+	NormalizeTimestamp     = "timestamp"       // RFC 3339 strings become UTC
+	NormalizeNullAsMissing = "null_as_missing" // null object members are dropped
+)
+
+// NormalizeRule applies transforms to both documents at Path and below it,
+// before they are compared. Rules accumulate: every matching rule applies.
+type NormalizeRule struct {
+	Path       string   `json:"path"`
+	Transforms []string `json:"transforms"`
+}
+
+// Normalize applies transforms to the values at path and below it.
+func Normalize(path string, transforms ...string) CompareOption {
+	return func(o *CompareOptions) {
+		o.Normalize = append(o.Normalize, NormalizeRule{Path: path, Transforms: transforms})
+	}
+}
+
+// TrimStrings ignores surrounding whitespace below the paths (the whole
+// document when none are given).
+func TrimStrings(paths ...string) CompareOption {
+	return normalizeRules(NormalizeTrim, paths)
+}
+
+// CaseInsensitive compares strings below the paths ignoring case.
+func CaseInsensitive(paths ...string) CompareOption {
+	return normalizeRules(NormalizeLower, paths)
+}
+
+// NumbersFromStrings compares numeric strings below the paths as numbers, so
+// "150.50" equals 150.5.
+func NumbersFromStrings(paths ...string) CompareOption {
+	return normalizeRules(NormalizeNumber, paths)
+}
+
+// CanonicalTimestamps compares RFC 3339 timestamps below the paths as
+// instants, whatever their zone or fractional digits.
+func CanonicalTimestamps(paths ...string) CompareOption {
+	return normalizeRules(NormalizeTimestamp, paths)
+}
+
+// NullAsMissing treats null members below the paths as absent keys.
+func NullAsMissing(paths ...string) CompareOption {
+	return normalizeRules(NormalizeNullAsMissing, paths)
+}
+
+func normalizeRules(transform string, paths []string) CompareOption {
+	if len(paths) == 0 {
+		paths = []string{"$"}
+	}
+	return func(o *CompareOptions) {
+		for _, p := range paths {
+			o.Normalize = append(o.Normalize, NormalizeRule{Path: p, Transforms: []string{transform}})
+		}
+	}
+}
+
+func validNormalizeTransform(t string) bool {
+	switch t {
+	case NormalizeTrim, NormalizeLower, NormalizeUpper, NormalizeNumber, NormalizeTimestamp, NormalizeNullAsMissing:
+		return true
+	}
+	return false
+}
+
+type compiledNormalizeRule struct {
+	pattern    pathPattern
+	transforms []string
+}
+
+func compileNormalizeRules(rules []NormalizeRule) []compiledNormalizeRule {
+	out := make([]compiledNormalizeRule, 0, len(rules))
+	for _, r := range rules {
+		if segs, err := parsePath(r.Path); err == nil {
+			out = append(out, compiledNormalizeRule{pattern: segs, transforms: r.Transforms})
+		}
+	}
+	return out
+}
+
+// transforms returns the transforms of every rule matching segs or one of
+// its ancestors, in rule order, each once.
+func (c *comparer) transforms(segs []pathSegment) []string {
+	var out []string
+	for _, r := range c.normalize {
+		if !r.pattern.matchesWithin(segs) {
+			continue
+		}
+		for _, t := range r.transforms {
+			if !containsString(out, t) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// normalizeDoc returns a normalized copy of v; v itself is not modified.
+// Matchers are left untouched.
+func (c *comparer) normalizeDoc(v interface{}, segs []pathSegment) interface{} {
+	if len(c.normalize) == 0 {
+		return v
+	}
+	if _, ok := matcherFrom(v); ok {
+		return v
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			childSegs := childPath(segs, pathSegment{kind: segKey, key: k})
+			if item == nil && containsString(c.transforms(childSegs), NormalizeNullAsMissing) {
+				continue
+			}
+			out[k] = c.normalizeDoc(item, childSegs)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = c.normalizeDoc(item, childPath(segs, pathSegment{kind: segIndex, index: i}))
+		}
+		return out
+	case string:
+		return normalizeString(val, c.transforms(segs))
+	}
+	return v
+}
+
+// jsonNumberPattern is the JSON number grammar.
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func normalizeString(s string, transforms []string) interface{} {
+	for _, t := range transforms {
+		switch t {
+		case NormalizeTrim:
+			s = strings.TrimSpace(s)
+		case NormalizeLower:
+			s = strings.ToLower(s)
+		case NormalizeUpper:
+			s = strings.ToUpper(s)
+		case NormalizeTimestamp:
+			if ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s)); err == nil {
+				s = ts.UTC().Format(time.RFC3339Nano)
+			}
+		case NormalizeNumber:
+			if n := strings.TrimSpace(s); jsonNumberPattern.MatchString(n) {
+				return json.Number(n)
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package flow
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDeepCompareNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  string
+		actual    string
+		opts      []CompareOption
+		wantEqual bool
+	}{
+		{"Numeric string", `{"total": 150.5}`, `{"total": "150.50"}`, []CompareOption{NumbersFromStrings("$.total")}, true},
+		{"Numeric string on both sides", `{"total": "1e2"}`, `{"total": " 100 "}`, []CompareOption{NumbersFromStrings()}, true},
+		{"Numeric string without rule", `{"total": 150.5}`, `{"total": "150.50"}`, nil, false},
+		{"Not a number", `{"total": 150.5}`, `{"total": "150,50"}`, []CompareOption{NumbersFromStrings()}, false},
+		{"Case", `{"status": "paid"}`, `{"status": "PAID"}`, []CompareOption{CaseInsensitive("$.status")}, true},
+		{"Case on another path", `{"status": "paid", "id": "a"}`, `{"status": "paid", "id": "A"}`, []CompareOption{CaseInsensitive("$.status")}, false},
+		{"Trim and case below a path", `{"c": {"name": " Ada "}}`, `{"c": {"name": "ADA"}}`, []CompareOption{Normalize("$.c", NormalizeTrim, NormalizeUpper)}, true},
+		{"Timestamp zones", `{"at": "2024-05-01T12:00:00+02:00"}`, `{"at": "2024-05-01T10:00:00.000Z"}`, []CompareOption{CanonicalTimestamps()}, true},
+		{"Different instants", `{"at": "2024-05-01T12:00:00+02:00"}`, `{"at": "2024-05-01T12:00:00Z"}`, []CompareOption{CanonicalTimestamps()}, false},
+		{"Null as missing", `{"id": 1}`, `{"id": 1, "note": null}`, []CompareOption{NullAsMissing()}, true},
+		{"Null as missing in expected", `{"id": 1, "note": null}`, `{"id": 1}`, []CompareOption{NullAsMissing("$.note")}, true},
+		{"Null in arrays kept", `{"a": [1]}`, `{"a": [1, null]}`, []CompareOption{NullAsMissing()}, false},
+		{"Wildcard path", `{"items": [{"s": "a"}, {"s": "b"}]}`, `{"items": [{"s": "A"}, {"s": "B"}]}`, []CompareOption{CaseInsensitive("$.items[*].s")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare(json.RawMessage(tt.expected), json.RawMessage(tt.actual), tt.opts...)
+			if equal != tt.wantEqual {
+				t.Errorf("DeepCompare() equal = %v, want %v (diffs %v)", equal, tt.wantEqual, diffs)
+			}
+		})
+	}
+}
+
+func TestNormalizeLeavesMatchersAndInputs(t *testing.T) {
+	expected, _ := json.Marshal(map[string]interface{}{"id": Regex("^ord-")})
+	if _, equal := DeepCompare(expected, json.RawMessage(`{"id": "ORD-1"}`), CaseInsensitive()); !equal {
+		t.Error("the actual value should be lower-cased before matching")
+	}
+
+	c, _ := newComparer(NewCompareOptions(TrimStrings()))
+	doc := map[string]interface{}{"a": " x "}
+	c.normalizeDoc(doc, nil)
+	if doc["a"] != " x " {
+		t.Errorf("normalizeDoc() modified its input: %v", doc)
+	}
+}
+
+func TestNormalizeValidation(t *testing.T) {
+	for _, opts := range []CompareOptions{
+		NewCompareOptions(Normalize("$.a")),
+		NewCompareOptions(Normalize("$.a", "squash")),
+		NewCompareOptions(Normalize("$[", NormalizeTrim)),
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", opts.Normalize)
+		}
+	}
+	merged := NewCompareOptions(TrimStrings()).Merge(NewCompareOptions(CaseInsensitive("$.a")))
+	if len(merged.Normalize) != 2 || merged.IsZero() {
+		t.Errorf("Merge() = %+v", merged.Normalize)
+	}
+}
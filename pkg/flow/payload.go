@@ -0,0 +1,309 @@
+package flow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policies for payloads larger than FlowConfig.MaxPayloadBytes.
+const (
+	OversizeReject   = "reject"   // CreatePoint and AddAssertion fail with ErrPayloadTooLarge (default)
+	OversizeTruncate = "truncate" // a marker with the size, digest and the start of the payload
+	OversizeHash     = "hash"     // a marker with the size and digest only
+)
+
+// payloadKey marks stored payloads that are not the document itself:
+// {"$flow_payload": "gzip", "data": "<base64>"} is opened transparently on
+// read; "truncated" and "hash" markers are compared by digest.
+const payloadKey = "$flow_payload"
+
+const (
+	payloadGzip      = "gzip"
+	payloadTruncated = "truncated"
+	payloadHash      = "hash"
+)
+
+// maxPreviewBytes bounds the preview kept by OversizeTruncate.
+const maxPreviewBytes = 1024
+
+// maxOpenBytes bounds the decompressed size of gzip markers that do not
+// record the size of their document.
+const maxOpenBytes = 64 << 20
+
+type payloadMarker struct {
+	Kind    string `json:"$flow_payload"`
+	Size    int    `json:"size,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Preview string `json:"preview,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Nonce   string `json:"nonce,omitempty"`
+}
+
+// payloadPolicy applies the size limit and compression of a client.
+type payloadPolicy struct {
+	maxBytes      int
+	oversize      string
+	compressAbove int
+}
+
+func newPayloadPolicy(config FlowConfig) (payloadPolicy, error) {
+	p := payloadPolicy{maxBytes: config.MaxPayloadBytes, oversize: config.OversizePolicy, compressAbove: config.CompressAbove}
+	if p.maxBytes < 0 || p.compressAbove < 0 {
+		return p, fmt.Errorf("payload size limits must not be negative")
+	}
+	switch p.oversize {
+	case "":
+		p.oversize = OversizeReject
+	case OversizeReject, OversizeTruncate, OversizeHash:
+	default:
+		return p, fmt.Errorf("unknown oversize policy %q", p.oversize)
+	}
+	return p, nil
+}
+
+// seal applies the size limit, then compression, to a JSON document. It
+// reports whether the document was replaced by a marker.
+func (p payloadPolicy) seal(doc json.RawMessage) (json.RawMessage, bool, error) {
+	reduced := false
+	if p.maxBytes > 0 && len(doc) > p.maxBytes {
+		if p.oversize == OversizeReject {
+			return nil, false, fmt.Errorf("%d bytes, limit %d: %w", len(doc), p.maxBytes, ErrPayloadTooLarge)
+		}
+		m := payloadMarker{Kind: payloadHash, Size: len(doc), SHA256: payloadDigest(doc)}
+		if p.oversize == OversizeTruncate {
+			m.Kind = payloadTruncated
+			m.Preview = preview(doc, p.maxBytes/2)
+		}
+		var err error
+		if doc, err = json.Marshal(m); err != nil {
+			return nil, false, err
+		}
+		reduced = true
+	}
+
+	if p.compressAbove > 0 && len(doc) > p.compressAbove {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(doc); err != nil {
+			return nil, false, fmt.Errorf("failed to compress payload: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, false, fmt.Errorf("failed to compress payload: %w", err)
+		}
+		sealed, err := json.Marshal(payloadMarker{Kind: payloadGzip, Size: len(doc), Data: base64.StdEncoding.EncodeToString(buf.Bytes())})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(sealed) < len(doc) {
+			doc = sealed
+		}
+	}
+	return doc, reduced, nil
+}
+
+// OpenPayload returns the document of a stored payload, decompressing it if
+// needed. Truncated and hashed payloads are returned as their markers. A
+// compressed payload that inflates beyond the size recorded in its marker
+// fails with ErrPayloadTooLarge.
+func OpenPayload(stored json.RawMessage) (json.RawMessage, error) {
+	m, ok := parsePayloadMarker(stored)
+	if !ok || m.Kind != payloadGzip {
+		return stored, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(m.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode compressed payload: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	defer zr.Close()
+	limit := int64(m.Size)
+	if limit <= 0 || limit > maxOpenBytes {
+		limit = maxOpenBytes
+	}
+	doc, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	if int64(len(doc)) > limit {
+		return nil, fmt.Errorf("compressed payload inflates beyond %d bytes: %w", limit, ErrPayloadTooLarge)
+	}
+	return doc, nil
+}
+
+// parsePayloadMarker cheaply rejects documents that cannot be markers before
+// decoding them.
+func parsePayloadMarker(doc []byte) (payloadMarker, bool) {
+	var m payloadMarker
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(payloadKey)) {
+		return m, false
+	}
+	if err := json.Unmarshal(trimmed, &m); err != nil || m.Kind == "" {
+		return m, false
+	}
+	return m, true
+}
+
+// payloadDigest hashes the canonical encoding of a document (sorted keys,
+// numbers as written), so the same payload hashes alike in every service.
+func payloadDigest(doc json.RawMessage) string {
+	if v, err := decodeJSON(doc); err == nil {
+		return valueDigest(v)
+	}
+	sum := sha256.Sum256(doc)
+	return hex.EncodeToString(sum[:])
+}
+
+func valueDigest(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// reducedDigest returns the digest of a decoded truncated or hashed marker.
+func reducedDigest(v interface{}) (payloadMarker, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return payloadMarker{}, false
+	}
+	kind, _ := obj[payloadKey].(string)
+	if kind != payloadTruncated && kind != payloadHash {
+		return payloadMarker{}, false
+	}
+	m := payloadMarker{Kind: kind}
+	m.SHA256, _ = obj["sha256"].(string)
+	if n, ok := obj["size"].(json.Number); ok {
+		size, _ := n.Int64()
+		m.Size = int(size)
+	}
+	return m, true
+}
+
+// isReducedPayload reports whether a stored document is a truncated or
+// hashed marker, whose content is gone.
+func isReducedPayload(doc json.RawMessage) bool {
+	m, ok := parsePayloadMarker(doc)
+	return ok && (m.Kind == payloadTruncated || m.Kind == payloadHash)
+}
+
+// unverifiable reports a check that cannot run on a payload reduced to its
+// digest.
+func unverifiable(check string) DiffEntry {
+	return DiffEntry{
+		Path:    "$",
+		Kind:    DiffInvalid,
+		Message: fmt.Sprintf("path $: oversized payload stored as a digest: %s cannot be checked", check),
+	}
+}
+
+// digestSkippedRules names the rules of opts, and the matchers of docs, that
+// a comparison by digest cannot apply. Severity rules, known differences and
+// MaxDiffs still apply to its diffs.
+func digestSkippedRules(opts CompareOptions, docs ...interface{}) []string {
+	var rules []string
+	for _, r := range []struct {
+		n    int
+		name string
+	}{
+		{len(opts.IgnorePaths), "ignore paths"},
+		{len(opts.Tolerances), "tolerances"},
+		{len(opts.Arrays), "array rules"},
+		{len(opts.Subsets), "subset rules"},
+		{len(opts.Normalize), "normalizers"},
+		{len(opts.comparators), "comparators"},
+	} {
+		if r.n > 0 {
+			rules = append(rules, r.name)
+		}
+	}
+	for _, doc := range docs {
+		if hasMatchers(doc) {
+			return append(rules, "matchers")
+		}
+	}
+	return rules
+}
+
+// digestSkippedRules names what checking an assertion against p would lose
+// if the expected document doc were reduced to its digest. Schemas only read
+// the actual payload, so they do not count.
+func (p *Point) digestSkippedRules(doc interface{}) []string {
+	var opts CompareOptions
+	if p.Compare != nil {
+		opts = *p.Compare
+	}
+	rules := digestSkippedRules(opts, doc)
+	if p.Validator != "" {
+		rules = append(rules, "validator "+p.Validator)
+	}
+	if len(p.Expressions) > 0 {
+		rules = append(rules, "expressions")
+	}
+	return rules
+}
+
+// compareReduced compares documents by digest when either was reduced by an
+// oversize policy. Differing digests under rules the digest cannot honour
+// are also reported as invalid, naming the skipped rules.
+func compareReduced(expected, actual interface{}, opts CompareOptions) ([]DiffEntry, bool) {
+	em, eReduced := reducedDigest(expected)
+	am, aReduced := reducedDigest(actual)
+	if !eReduced && !aReduced {
+		return nil, false
+	}
+	eDigest, aDigest := em.SHA256, am.SHA256
+	if !eReduced {
+		eDigest = valueDigest(expected)
+	}
+	if !aReduced {
+		aDigest = valueDigest(actual)
+	}
+	if eDigest == aDigest {
+		return nil, true
+	}
+	size := em.Size
+	if !eReduced {
+		size = am.Size
+	}
+	diffs := []DiffEntry{{
+		Path:     "$",
+		Kind:     DiffValueMismatch,
+		Expected: "sha256:" + eDigest,
+		Actual:   "sha256:" + aDigest,
+		Message:  fmt.Sprintf("path $: oversized payload (%d bytes) compared by digest: digests differ", size),
+	}}
+	if skipped := digestSkippedRules(opts, expected, actual); len(skipped) > 0 {
+		diffs = append(diffs, DiffEntry{
+			Path:    "$",
+			Kind:    DiffInvalid,
+			Message: fmt.Sprintf("path $: %s cannot be applied to a payload compared by digest", strings.Join(skipped, ", ")),
+		})
+	}
+	return diffs, true
+}
+
+// preview returns at most n bytes of doc, cut on a rune boundary.
+func preview(doc []byte, n int) string {
+	if n > maxPreviewBytes {
+		n = maxPreviewBytes
+	}
+	if n >= len(doc) {
+		return string(doc)
+	}
+	for n > 0 && !utf8.RuneStart(doc[n]) {
+		n--
+	}
+	return string(doc[:n])
+}
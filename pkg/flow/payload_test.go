@@ -0,0 +1,199 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPayloadPolicyConfig(t *testing.T) {
+	if p, err := newPayloadPolicy(FlowConfig{MaxPayloadBytes: 10}); err != nil || p.oversize != OversizeReject {
+		t.Errorf("default policy = %q, %v; want %q", p.oversize, err, OversizeReject)
+	}
+	for _, cfg := range []FlowConfig{
+		{MaxPayloadBytes: -1},
+		{CompressAbove: -1},
+		{MaxPayloadBytes: 10, OversizePolicy: "drop"},
+	} {
+		if _, err := newPayloadPolicy(cfg); err == nil {
+			t.Errorf("newPayloadPolicy(%+v) should fail", cfg)
+		}
+	}
+}
+
+func TestSealOversizePayload(t *testing.T) {
+	doc := json.RawMessage(`{"items": ["` + strings.Repeat("x", 200) + `"], "id": 1}`)
+
+	reject := payloadPolicy{maxBytes: 100, oversize: OversizeReject}
+	if _, _, err := reject.seal(doc); !IsPayloadTooLarge(err) {
+		t.Errorf("reject: err = %v, want ErrPayloadTooLarge", err)
+	}
+	if out, reduced, err := reject.seal(json.RawMessage(`{"id": 1}`)); err != nil || reduced || string(out) != `{"id": 1}` {
+		t.Errorf("small payload = %s, %v, %v; want it unchanged", out, reduced, err)
+	}
+
+	for _, policy := range []string{OversizeTruncate, OversizeHash} {
+		out, reduced, err := payloadPolicy{maxBytes: 100, oversize: policy}.seal(doc)
+		if err != nil || !reduced {
+			t.Fatalf("%s: seal() = %s, %v, %v", policy, out, reduced, err)
+		}
+		m, ok := parsePayloadMarker(out)
+		if !ok || m.Size != len(doc) || m.SHA256 != payloadDigest(doc) {
+			t.Errorf("%s: marker = %s", policy, out)
+		}
+		if (m.Preview != "") != (policy == OversizeTruncate) || len(m.Preview) > 50 {
+			t.Errorf("%s: preview = %q", policy, m.Preview)
+		}
+	}
+}
+
+func TestSealCompressesAndOpens(t *testing.T) {
+	doc := json.RawMessage(`{"text": "` + strings.Repeat("abc", 500) + `"}`)
+	out, reduced, err := payloadPolicy{compressAbove: 100}.seal(doc)
+	if err != nil || reduced {
+		t.Fatalf("seal() = %v, %v", reduced, err)
+	}
+	if m, ok := parsePayloadMarker(out); !ok || m.Kind != payloadGzip || len(out) >= len(doc) {
+		t.Fatalf("compressed payload = %.80s", out)
+	}
+	opened, err := OpenPayload(out)
+	if err != nil || string(opened) != string(doc) {
+		t.Errorf("OpenPayload() = %.80s, %v", opened, err)
+	}
+
+	// Incompressible payloads are stored as they are.
+	small := json.RawMessage(`{"id": "4f9c1a2b7d"}`)
+	if out, _, _ := (payloadPolicy{compressAbove: 10}).seal(small); string(out) != string(small) {
+		t.Errorf("seal() = %s, want it unchanged", out)
+	}
+	if opened, err := OpenPayload(small); err != nil || string(opened) != string(small) {
+		t.Errorf("OpenPayload() = %s, %v", opened, err)
+	}
+	if _, err := OpenPayload(json.RawMessage(`{"$flow_payload": "gzip", "data": "!!"}`)); err == nil {
+		t.Error("OpenPayload() should fail on corrupt data")
+	}
+}
+
+func TestOpenPayloadBoundsDecompression(t *testing.T) {
+	doc := json.RawMessage(`{"text": "` + strings.Repeat("a", 10000) + `"}`)
+	out, _, err := payloadPolicy{compressAbove: 100}.seal(doc)
+	if err != nil {
+		t.Fatalf("seal() error = %v", err)
+	}
+	m, _ := parsePayloadMarker(out)
+	if m.Size != len(doc) {
+		t.Fatalf("marker size = %d, want %d", m.Size, len(doc))
+	}
+
+	// A marker claiming a smaller document is not inflated past its size.
+	m.Size = 100
+	forged, _ := json.Marshal(m)
+	if _, err := OpenPayload(forged); !IsPayloadTooLarge(err) {
+		t.Errorf("OpenPayload() error = %v, want ErrPayloadTooLarge", err)
+	}
+
+	// Markers without a size fall back to maxOpenBytes.
+	m.Size = 0
+	legacy, _ := json.Marshal(m)
+	if opened, err := OpenPayload(legacy); err != nil || string(opened) != string(doc) {
+		t.Errorf("OpenPayload() = %.80s, %v", opened, err)
+	}
+}
+
+func TestCompareOversizePayloads(t *testing.T) {
+	doc := json.RawMessage(`{"id": 1, "items": [1, 2, 3], "note": "` + strings.Repeat("n", 100) + `"}`)
+	sealed, _, err := payloadPolicy{maxBytes: 50, oversize: OversizeHash}.seal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Key order and whitespace do not change the digest.
+	same := json.RawMessage(`{"note":"` + strings.Repeat("n", 100) + `","items":[1,2,3],"id":1}`)
+	if diffs, equal := DeepCompare(sealed, same); !equal {
+		t.Errorf("digest of the same payload should match: %v", diffs)
+	}
+	truncated, _, _ := payloadPolicy{maxBytes: 50, oversize: OversizeTruncate}.seal(same)
+	if diffs, equal := DeepCompare(sealed, truncated); !equal {
+		t.Errorf("hash and truncated markers of the same payload should match: %v", diffs)
+	}
+
+	other := json.RawMessage(`{"id": 2, "items": [1, 2, 3], "note": "` + strings.Repeat("n", 100) + `"}`)
+	diffs, equal := DeepCompare(sealed, other)
+	if equal || len(diffs) != 1 || diffs[0].Path != "$" || !strings.Contains(diffs[0].Message, "digest") {
+		t.Errorf("DeepCompare() = %v, %v; want one digest diff", diffs, equal)
+	}
+	if _, equal := DeepCompareWithOptions(sealed, other, NewCompareOptions(PathSeverity(SeverityWarning, "$"))); !equal {
+		t.Error("severity rules should apply to digest diffs")
+	}
+}
+
+func TestCompareOversizePayloadsWithRules(t *testing.T) {
+	doc := json.RawMessage(`{"id": 1, "items": [1, 2, 3], "note": "` + strings.Repeat("n", 100) + `"}`)
+	sealed, _, err := payloadPolicy{maxBytes: 50, oversize: OversizeHash}.seal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := json.RawMessage(`{"id": 2, "items": [1, 2, 3], "note": "` + strings.Repeat("n", 100) + `"}`)
+
+	diffs, equal := DeepCompare(sealed, other, IgnorePaths("$.id"), Tolerance(1, 0))
+	if equal || len(diffs) != 2 || diffs[1].Kind != DiffInvalid || !strings.Contains(diffs[1].Message, "ignore paths, tolerances") {
+		t.Errorf("DeepCompare() = %v, %v; want the skipped rules reported", diffs, equal)
+	}
+	if diffs, _ := DeepCompare(sealed, other, IgnorePaths("$.id"), MaxDiffs(1)); len(diffs) != 2 || diffs[1].Kind != DiffTruncated {
+		t.Errorf("DeepCompare() = %v; MaxDiffs should apply to digest diffs", diffs)
+	}
+
+	expected, _ := json.Marshal(map[string]interface{}{"id": AnyNumber(), "note": AnyString()})
+	if diffs, _ := DeepCompare(expected, sealed); len(diffs) != 2 || !strings.Contains(diffs[1].Message, "matchers") {
+		t.Errorf("DeepCompare() = %v; want matchers reported as skipped", diffs)
+	}
+	if diffs, equal := DeepCompare(sealed, doc, IgnorePaths("$.id")); !equal {
+		t.Errorf("equal digests need no rules: %v", diffs)
+	}
+}
+
+func TestReducedPayloadsAreUnverifiable(t *testing.T) {
+	doc := json.RawMessage(`{"id": 1, "note": "` + strings.Repeat("n", 100) + `"}`)
+	sealed, _, _ := payloadPolicy{maxBytes: 50, oversize: OversizeTruncate}.seal(doc)
+
+	diffs := EvaluateExpressions([]string{"id > 0"}, nil, sealed)
+	if len(diffs) != 1 || diffs[0].Kind != DiffInvalid || !strings.Contains(diffs[0].Message, "expressions cannot be checked") {
+		t.Errorf("EvaluateExpressions() = %v", diffs)
+	}
+	diffs, err := ValidateSchema(json.RawMessage(`{"required": ["total"]}`), sealed)
+	if err != nil || len(diffs) != 1 || !strings.Contains(diffs[0].Message, "schema cannot be checked") {
+		t.Errorf("ValidateSchema() = %v, %v", diffs, err)
+	}
+
+	schemas, err := InferSchemas("Checkout", []Point{
+		{ID: 1, Description: "Created", Expected: json.RawMessage(`{"id": 1}`)},
+		{ID: 2, Description: "Created", Expected: sealed},
+		{ID: 3, Description: "Archived", Expected: sealed},
+	})
+	if err != nil || len(schemas) != 1 || schemas[0].Samples != 1 {
+		t.Errorf("InferSchemas() = %+v, %v; want reduced payloads skipped", schemas, err)
+	}
+}
+
+func TestCreatePointRefusesDigestWithRules(t *testing.T) {
+	f := &flowInstance{
+		Flow:   &Flow{ID: 1, Name: "Checkout"},
+		client: &FlowClient{payloads: payloadPolicy{maxBytes: 50, oversize: OversizeHash}},
+	}
+	big := map[string]interface{}{"id": 1, "note": strings.Repeat("n", 100)}
+
+	for _, opt := range []PointOption{
+		WithCompareOptions(IgnorePaths("$.id")),
+		WithExpression("id > 0"),
+		WithValidator("order"),
+	} {
+		if err := f.CreatePoint(context.Background(), "Created", big, opt); !IsPayloadTooLarge(err) {
+			t.Errorf("CreatePoint() error = %v, want ErrPayloadTooLarge", err)
+		}
+	}
+	err := f.CreatePoint(context.Background(), "Created", map[string]interface{}{"id": AnyNumber(), "note": strings.Repeat("n", 100)})
+	if !IsPayloadTooLarge(err) || !strings.Contains(err.Error(), "matchers") {
+		t.Errorf("CreatePoint() error = %v, want matchers named", err)
+	}
+}
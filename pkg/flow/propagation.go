@@ -0,0 +1,166 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BaggageKey is the carrier key that holds the propagated flow identity.
+const BaggageKey = "flow-baggage"
+
+// TextMapCarrier is a generic key/value transport for flow identity, such as
+// HTTP headers or message attributes.
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key, value string)
+	Keys() []string
+}
+
+// MapCarrier adapts a plain map (e.g. message attributes) to TextMapCarrier.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c MapCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c MapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// HeaderCarrier adapts http.Header to TextMapCarrier.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type flowContextKey struct{}
+
+// ContextWithFlow returns a copy of ctx carrying f, ready to be injected.
+func ContextWithFlow(ctx context.Context, f *Flow) context.Context {
+	return context.WithValue(ctx, flowContextKey{}, f)
+}
+
+// FlowFromContext returns the flow stored in ctx, if any.
+func FlowFromContext(ctx context.Context) (*Flow, bool) {
+	f, ok := ctx.Value(flowContextKey{}).(*Flow)
+	return f, ok && f != nil
+}
+
+type executorContextKey struct{}
+
+// ContextWithExecutor returns a copy of ctx carrying f and its flow, so code
+// further down the call (e.g. an outgoing flowhttp.Transport) records on f
+// without looking the flow up again.
+func ContextWithExecutor(ctx context.Context, f FlowExecutor) context.Context {
+	ctx = ContextWithFlow(ctx, f.GetFlowInfo())
+	return context.WithValue(ctx, executorContextKey{}, f)
+}
+
+// ExecutorFromContext returns the executor stored by ContextWithExecutor,
+// unless a different flow was stored in ctx since.
+func ExecutorFromContext(ctx context.Context) (FlowExecutor, bool) {
+	f, ok := ctx.Value(executorContextKey{}).(FlowExecutor)
+	if !ok {
+		return nil, false
+	}
+	current, ok := FlowFromContext(ctx)
+	return f, ok && current == f.GetFlowInfo()
+}
+
+// Inject writes the identity of the flow stored in ctx into the carrier.
+// It is a no-op when ctx carries no flow.
+func Inject(ctx context.Context, carrier TextMapCarrier) {
+	f, ok := FlowFromContext(ctx)
+	if !ok {
+		return
+	}
+	carrier.Set(BaggageKey, encodeBaggage(f))
+}
+
+// Extract reads a flow identity previously written by Inject. The returned
+// Flow only has ID, Name, Identifier and Status populated.
+func Extract(carrier TextMapCarrier) (*Flow, error) {
+	value := carrier.Get(BaggageKey)
+	if value == "" {
+		return nil, ErrNoFlowContext
+	}
+	return decodeBaggage(value)
+}
+
+func encodeBaggage(f *Flow) string {
+	members := []string{
+		"id=" + strconv.FormatInt(f.ID, 10),
+		"name=" + url.PathEscape(f.Name),
+	}
+	if f.Identifier != "" {
+		members = append(members, "identifier="+url.PathEscape(f.Identifier))
+	}
+	if isSkipped(f.Status) {
+		members = append(members, "status="+url.PathEscape(f.Status))
+	}
+	return strings.Join(members, ",")
+}
+
+func decodeBaggage(value string) (*Flow, error) {
+	f := &Flow{Status: "ACTIVE"}
+	for _, member := range strings.Split(value, ",") {
+		// W3C baggage allows ";"-separated properties after the value; they are ignored.
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		k, v, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			return nil, fmt.Errorf("flow: malformed baggage member %q", member)
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("flow: malformed baggage value for %q: %w", k, err)
+		}
+		switch strings.TrimSpace(k) {
+		case "id":
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("flow: malformed flow id %q: %w", v, err)
+			}
+			f.ID = id
+		case "name":
+			f.Name = v
+		case "identifier":
+			f.Identifier = v
+		case "status":
+			f.Status = v
+		}
+	}
+	if f.Name == "" {
+		return nil, fmt.Errorf("flow: baggage is missing the flow name")
+	}
+	if f.ID == 0 && !isSkipped(f.Status) {
+		return nil, fmt.Errorf("flow: baggage is missing the flow id")
+	}
+	return f, nil
+}
@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestInjectExtract(t *testing.T) {
+	t.Run("Round trip through map carrier", func(t *testing.T) {
+		f := &Flow{ID: 42, Name: "Order Processing", Identifier: "ORD-1,2=3", Status: "ACTIVE"}
+		carrier := MapCarrier{}
+		Inject(ContextWithFlow(context.Background(), f), carrier)
+
+		got, err := Extract(carrier)
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if got.ID != 42 || got.Name != f.Name || got.Identifier != f.Identifier {
+			t.Errorf("Extract() = %+v, want %+v", got, f)
+		}
+		if got.Status != "ACTIVE" {
+			t.Errorf("Status = %q, want ACTIVE", got.Status)
+		}
+	})
+
+	t.Run("Round trip through HTTP headers", func(t *testing.T) {
+		h := http.Header{}
+		Inject(ContextWithFlow(context.Background(), &Flow{ID: 7, Name: "Checkout"}), HeaderCarrier(h))
+
+		if h.Get(BaggageKey) == "" {
+			t.Fatal("expected baggage header to be set")
+		}
+		got, err := Extract(HeaderCarrier(h))
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if got.ID != 7 || got.Name != "Checkout" {
+			t.Errorf("Extract() = %+v", got)
+		}
+	})
+
+	t.Run("Skipped flow keeps its status", func(t *testing.T) {
+		carrier := MapCarrier{}
+		Inject(ContextWithFlow(context.Background(), &Flow{Name: "Checkout", Status: "SKIPPED_LIMIT"}), carrier)
+
+		got, err := Extract(carrier)
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if got.Status != "SKIPPED_LIMIT" {
+			t.Errorf("Status = %q, want SKIPPED_LIMIT", got.Status)
+		}
+	})
+
+	t.Run("Inject without flow is a no-op", func(t *testing.T) {
+		carrier := MapCarrier{}
+		Inject(context.Background(), carrier)
+		if len(carrier) != 0 {
+			t.Errorf("carrier = %v, want empty", carrier)
+		}
+	})
+
+	t.Run("Extract without baggage", func(t *testing.T) {
+		_, err := Extract(MapCarrier{})
+		if !IsNoFlowContext(err) {
+			t.Errorf("Extract() error = %v, want ErrNoFlowContext", err)
+		}
+	})
+
+	t.Run("Extract ignores properties and whitespace", func(t *testing.T) {
+		got, err := Extract(MapCarrier{BaggageKey: "id=3;prop=1, name=Order%20Processing"})
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if got.ID != 3 || got.Name != "Order Processing" {
+			t.Errorf("Extract() = %+v", got)
+		}
+	})
+
+	t.Run("Extract rejects malformed baggage", func(t *testing.T) {
+		for _, v := range []string{"garbage", "id=abc,name=x", "id=1", "name=x"} {
+			if _, err := Extract(MapCarrier{BaggageKey: v}); err == nil {
+				t.Errorf("Extract(%q) should fail", v)
+			}
+		}
+	})
+}
+
+func TestExecutorFromContext(t *testing.T) {
+	if _, ok := ExecutorFromContext(context.Background()); ok {
+		t.Error("empty context should carry no executor")
+	}
+
+	inst := &flowInstance{Flow: &Flow{ID: 1, Name: "Checkout"}}
+	ctx := ContextWithExecutor(context.Background(), inst)
+	if f, ok := ExecutorFromContext(ctx); !ok || f != inst {
+		t.Errorf("ExecutorFromContext() = %v, %v", f, ok)
+	}
+	if got, _ := FlowFromContext(ctx); got != inst.Flow {
+		t.Errorf("FlowFromContext() = %+v, want the executor's flow", got)
+	}
+
+	// Storing another flow hides the executor of the previous one.
+	ctx = ContextWithFlow(ctx, &Flow{ID: 2, Name: "Refund"})
+	if _, ok := ExecutorFromContext(ctx); ok {
+		t.Error("executor of a replaced flow should not be returned")
+	}
+}
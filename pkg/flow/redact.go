@@ -0,0 +1,208 @@
+package flow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Redaction actions.
+const (
+	RedactDrop = "drop" // members are removed, array elements become null
+	RedactMask = "mask" // strings keep their length and last Keep characters
+	RedactHash = "hash" // salted HMAC-SHA256, so equal values still compare equal
+)
+
+// RedactionRule removes personal data from payloads before CreatePoint and
+// AddAssertion store them. Selector is a path pattern ($.customer.email,
+// $..card_number) or a key name matched at any depth, case-insensitively.
+type RedactionRule struct {
+	Selector string
+	Action   string
+	Keep     int // mask only
+}
+
+// DropField removes the values selected by selector.
+func DropField(selector string) RedactionRule {
+	return RedactionRule{Selector: selector, Action: RedactDrop}
+}
+
+// MaskField replaces the values selected by selector with asterisks, leaving
+// the last keep characters of strings visible (e.g. card fragments).
+func MaskField(selector string, keep int) RedactionRule {
+	return RedactionRule{Selector: selector, Action: RedactMask, Keep: keep}
+}
+
+// HashField replaces the values selected by selector with a salted hash.
+// It requires FlowConfig.RedactionSalt, which services comparing hashed
+// values must share.
+func HashField(selector string) RedactionRule {
+	return RedactionRule{Selector: selector, Action: RedactHash}
+}
+
+// maskedValue replaces values that are not strings.
+const maskedValue = "***"
+
+type compiledRedaction struct {
+	pattern pathPattern // nil for key rules
+	key     string
+	rule    RedactionRule
+}
+
+func compileRedaction(rules []RedactionRule, salt string) ([]compiledRedaction, error) {
+	out := make([]compiledRedaction, 0, len(rules))
+	for _, r := range rules {
+		switch r.Action {
+		case RedactDrop, RedactMask:
+		case RedactHash:
+			// An unsalted hash of a short value (an email, a document number)
+			// is reversed by hashing candidates.
+			if salt == "" {
+				return nil, fmt.Errorf("redaction rule for %q: hash requires a redaction salt", r.Selector)
+			}
+		default:
+			return nil, fmt.Errorf("redaction rule for %q: unknown action %q", r.Selector, r.Action)
+		}
+		if r.Keep < 0 {
+			return nil, fmt.Errorf("redaction rule for %q: keep must not be negative", r.Selector)
+		}
+		cr := compiledRedaction{rule: r}
+		switch {
+		case r.Selector == "":
+			return nil, fmt.Errorf("redaction rule: selector is required")
+		case strings.HasPrefix(r.Selector, "$"):
+			segs, err := parsePath(r.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction path: %w", err)
+			}
+			cr.pattern = segs
+		default:
+			cr.key = strings.ToLower(r.Selector)
+		}
+		out = append(out, cr)
+	}
+	return out, nil
+}
+
+// redactor applies the redaction rules of a client.
+type redactor struct {
+	rules []compiledRedaction
+	salt  []byte
+}
+
+// Redact applies rules to a JSON document outside a client, for adapters
+// that record payloads on their own (see flowhttp.WithRedactedKeys). Hash
+// rules need salt; documents that are not JSON are rejected.
+func Redact(doc json.RawMessage, salt string, rules ...RedactionRule) (json.RawMessage, error) {
+	compiled, err := compileRedaction(rules, salt)
+	if err != nil {
+		return nil, &ConfigError{msg: err.Error()}
+	}
+	r := redactor{rules: compiled, salt: []byte(salt)}
+	out, _, err := r.redactPayload(doc)
+	return out, err
+}
+
+// redactPayload redacts a JSON document and reports whether it changed.
+func (r *redactor) redactPayload(doc json.RawMessage) (json.RawMessage, bool, error) {
+	if len(r.rules) == 0 {
+		return doc, false, nil
+	}
+	v, err := decodeJSON(doc)
+	if err != nil {
+		// Rules cannot be checked against a document that is not JSON, so
+		// it is never passed through.
+		return nil, false, fmt.Errorf("cannot redact a payload that is not JSON: %w", err)
+	}
+	v, changed := r.redact(v, nil)
+	if !changed {
+		return doc, false, nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal redacted payload: %w", err)
+	}
+	return out, true, nil
+}
+
+// rule returns the last rule selecting segs.
+func (r *redactor) rule(segs []pathSegment) (RedactionRule, bool) {
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		cr := r.rules[i]
+		if cr.pattern != nil {
+			if cr.pattern.matches(segs) {
+				return cr.rule, true
+			}
+			continue
+		}
+		if n := len(segs); n > 0 && segs[n-1].kind == segKey && strings.ToLower(segs[n-1].key) == cr.key {
+			return cr.rule, true
+		}
+	}
+	return RedactionRule{}, false
+}
+
+func (r *redactor) redact(v interface{}, segs []pathSegment) (interface{}, bool) {
+	changed := false
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			out, drop, c := r.redactChild(val[k], childPath(segs, pathSegment{kind: segKey, key: k}))
+			if drop {
+				delete(val, k)
+			} else {
+				val[k] = out
+			}
+			changed = changed || c
+		}
+	case []interface{}:
+		for i := range val {
+			out, _, c := r.redactChild(val[i], childPath(segs, pathSegment{kind: segIndex, index: i}))
+			val[i] = out
+			changed = changed || c
+		}
+	}
+	return v, changed
+}
+
+// redactChild applies the rule selecting segs to v, or redacts below it.
+// Dropped array elements become null.
+func (r *redactor) redactChild(v interface{}, segs []pathSegment) (out interface{}, drop, changed bool) {
+	if _, ok := matcherFrom(v); ok {
+		return v, false, false
+	}
+	rule, ok := r.rule(segs)
+	if !ok {
+		out, changed = r.redact(v, segs)
+		return out, false, changed
+	}
+	if rule.Action == RedactDrop {
+		return nil, true, true
+	}
+	return r.apply(rule, v), false, true
+}
+
+func (r *redactor) apply(rule RedactionRule, v interface{}) interface{} {
+	switch rule.Action {
+	case RedactMask:
+		s, ok := v.(string)
+		if !ok {
+			return maskedValue
+		}
+		runes := []rune(s)
+		keep := rule.Keep
+		if keep > len(runes) {
+			keep = len(runes)
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	case RedactHash:
+		b, _ := json.Marshal(v)
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write(b)
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package flow
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestRedactor(t *testing.T, salt string, rules ...RedactionRule) redactor {
+	t.Helper()
+	compiled, err := compileRedaction(rules, salt)
+	if err != nil {
+		t.Fatalf("compileRedaction() error = %v", err)
+	}
+	return redactor{rules: compiled, salt: []byte(salt)}
+}
+
+func TestRedactPayload(t *testing.T) {
+	r := newTestRedactor(t, "s3cret",
+		DropField("$.customer.document"),
+		MaskField("card_number", 4),
+		MaskField("$.customer.phone", 0),
+		HashField("Email"),
+		DropField("$.notes[1]"),
+	)
+	in := json.RawMessage(`{
+		"id": "ORD-1",
+		"customer": {"email": "ada@example.com", "document": "123.456.789-00", "phone": 5551234},
+		"payments": [{"card_number": "4111111111111111", "amount": 10}],
+		"notes": ["ok", "call ada@example.com"]
+	}`)
+
+	out, redacted, err := r.redactPayload(in)
+	if err != nil || !redacted {
+		t.Fatalf("redactPayload() = %s, %v, %v", out, redacted, err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(out, &got)
+	customer := got["customer"].(map[string]interface{})
+	if _, ok := customer["document"]; ok {
+		t.Errorf("document should be dropped: %v", customer)
+	}
+	if customer["phone"] != maskedValue {
+		t.Errorf("phone = %v, want %s", customer["phone"], maskedValue)
+	}
+	if email := customer["email"].(string); !strings.HasPrefix(email, "sha256:") || strings.Contains(email, "ada") {
+		t.Errorf("email = %q, want a hash", email)
+	}
+	if card := got["payments"].([]interface{})[0].(map[string]interface{})["card_number"]; card != "************1111" {
+		t.Errorf("card_number = %v", card)
+	}
+	if notes := got["notes"].([]interface{}); notes[0] != "ok" || notes[1] != nil {
+		t.Errorf("notes = %v", notes)
+	}
+	if got["id"] != "ORD-1" {
+		t.Errorf("id = %v, should be untouched", got["id"])
+	}
+
+	if out, _, err := r.redactPayload(json.RawMessage(`email=ada@example.com`)); err == nil {
+		t.Errorf("redactPayload() = %s, want an error for a payload that is not JSON", out)
+	}
+
+	unchanged := json.RawMessage(`{"id": 1}`)
+	if out, redacted, _ := r.redactPayload(unchanged); redacted || string(out) != string(unchanged) {
+		t.Errorf("redactPayload() = %s, %v; want the payload untouched", out, redacted)
+	}
+}
+
+func TestRedactHashKeepsEquality(t *testing.T) {
+	r := newTestRedactor(t, "s3cret", HashField("$.email"))
+	a, _, _ := r.redactPayload(json.RawMessage(`{"email": "ada@example.com"}`))
+	b, _, _ := r.redactPayload(json.RawMessage(`{"email": "ada@example.com"}`))
+	c, _, _ := r.redactPayload(json.RawMessage(`{"email": "bob@example.com"}`))
+	if _, equal := DeepCompare(a, b); !equal {
+		t.Error("equal values should hash equally")
+	}
+	if _, equal := DeepCompare(a, c); equal {
+		t.Error("different values should hash differently")
+	}
+
+	other := newTestRedactor(t, "other", HashField("$.email"))
+	d, _, _ := other.redactPayload(json.RawMessage(`{"email": "ada@example.com"}`))
+	if string(a) == string(d) {
+		t.Error("the salt should change the hash")
+	}
+
+	// Matchers in expected payloads are left as they are.
+	expected, _ := json.Marshal(map[string]interface{}{"email": AnyString()})
+	if out, redacted, _ := r.redactPayload(expected); redacted || string(out) != string(expected) {
+		t.Errorf("redactPayload() = %s; matchers should not be redacted", out)
+	}
+}
+
+func TestRedactionConfig(t *testing.T) {
+	for _, rules := range [][]RedactionRule{
+		{{Selector: "email", Action: "erase"}},
+		{{Selector: "", Action: RedactDrop}},
+		{{Selector: "$[", Action: RedactDrop}},
+		{MaskField("card", -1)},
+		{HashField("email")},
+	} {
+		if _, err := NewClient(nil, FlowConfig{IsProduction: true, Redaction: rules}); err == nil {
+			t.Errorf("NewClient() with %+v should fail", rules)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	out, err := Redact(json.RawMessage(`{"user": {"Email": "ada@example.com", "age": 36}}`), "",
+		MaskField("email", 0), DropField("$.user.age"))
+	if err != nil || string(out) != `{"user":{"Email":"***************"}}` {
+		t.Errorf("Redact() = %s, %v", out, err)
+	}
+	if _, err := Redact(json.RawMessage(`{"email": "ada@example.com"}`), "", HashField("email")); err == nil {
+		t.Error("Redact() should reject hash rules without a salt")
+	}
+	if out, err := Redact(json.RawMessage(`{"email": "ada@example.com"}`), "s3cret", HashField("email")); err != nil || !strings.Contains(string(out), "sha256:") {
+		t.Errorf("Redact() = %s, %v", out, err)
+	}
+}
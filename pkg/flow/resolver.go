@@ -0,0 +1,48 @@
+package flow
+
+import "context"
+
+// FlowResolver finds the flow an incoming request or message belongs to, or
+// the flow of the caller's context. The flowhttp and flowmsg adapters depend
+// on it rather than on FlowClient, so they can be tested without a database;
+// FlowClient.Resolver provides it.
+type FlowResolver interface {
+	Resume(ctx context.Context, carrier TextMapCarrier) (FlowExecutor, error)
+	FromContext(ctx context.Context) (FlowExecutor, error)
+	Correlate(ctx context.Context, payload interface{}, flowNames ...string) (FlowExecutor, error)
+}
+
+// Resolver returns c as a FlowResolver.
+func (c *FlowClient) Resolver() FlowResolver {
+	return clientResolver{c}
+}
+
+// clientResolver converts the *flowInstance results of a client to
+// FlowExecutor, keeping failed lookups a nil interface.
+type clientResolver struct {
+	client *FlowClient
+}
+
+func (r clientResolver) Resume(ctx context.Context, carrier TextMapCarrier) (FlowExecutor, error) {
+	f, err := r.client.Resume(ctx, carrier)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r clientResolver) FromContext(ctx context.Context) (FlowExecutor, error) {
+	f, err := r.client.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r clientResolver) Correlate(ctx context.Context, payload interface{}, flowNames ...string) (FlowExecutor, error) {
+	f, err := r.client.Correlate(ctx, payload, flowNames...)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,280 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// InferredSchema is the schema inferred for one point description of a flow.
+type InferredSchema struct {
+	FlowName    string          `json:"flow_name"`
+	Description string          `json:"description"`
+	Samples     int             `json:"samples"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// InferOption configures schema inference.
+type InferOption func(*inferConfig)
+
+type inferConfig struct {
+	enumThreshold int
+}
+
+// EnumThreshold turns string fields that take at most n distinct values into
+// enums, provided each value was seen twice on average so that identifiers
+// seen in few samples do not become enums. Zero (the default) disables enums.
+func EnumThreshold(n int) InferOption {
+	return func(c *inferConfig) { c.enumThreshold = n }
+}
+
+// inferSampleLimit bounds how many recorded points FlowClient.InferSchemas reads.
+const inferSampleLimit = 10000
+
+// InferSchema returns a JSON Schema that every expected payload of points
+// satisfies. Fields missing from some payloads are optional, fields seen with
+// several types get a type union (integer and number merge into number), and
+// matchers become the type they accept. Payloads reduced to a digest by an
+// oversize policy are skipped.
+func InferSchema(points []Point, opts ...InferOption) (json.RawMessage, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points to infer a schema from")
+	}
+	var cfg inferConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	root := newShape(cfg)
+	samples := 0
+	for _, p := range points {
+		v, err := decodeJSON(p.Expected)
+		if err != nil {
+			return nil, fmt.Errorf("point %d (%s): failed to unmarshal expected: %w", p.ID, p.Description, err)
+		}
+		if _, ok := reducedDigest(v); ok {
+			continue
+		}
+		root.add(v)
+		samples++
+	}
+	if samples == 0 {
+		return nil, fmt.Errorf("no points to infer a schema from: every payload was reduced to a digest")
+	}
+
+	schema := root.schema()
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return json.Marshal(schema)
+}
+
+// InferSchemas infers one schema per point description of flowName, sorted
+// by description. Descriptions whose payloads were all reduced to a digest
+// are left out.
+func InferSchemas(flowName string, points []Point, opts ...InferOption) ([]InferredSchema, error) {
+	groups := map[string][]Point{}
+	for _, p := range points {
+		if isReducedPayload(p.Expected) {
+			continue
+		}
+		groups[p.Description] = append(groups[p.Description], p)
+	}
+	descriptions := make([]string, 0, len(groups))
+	for d := range groups {
+		descriptions = append(descriptions, d)
+	}
+	sort.Strings(descriptions)
+
+	out := make([]InferredSchema, 0, len(descriptions))
+	for _, d := range descriptions {
+		schema, err := InferSchema(groups[d], opts...)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, InferredSchema{FlowName: flowName, Description: d, Samples: len(groups[d]), Schema: schema})
+	}
+	return out, nil
+}
+
+// InferSchemas infers schemas from the points recorded for flowName, reading
+// at most the 10000 most recent ones.
+func (c *FlowClient) InferSchemas(ctx context.Context, flowName string, opts ...InferOption) ([]InferredSchema, error) {
+	points, err := c.storage.FetchPointsByFlowName(ctx, flowName, inferSampleLimit)
+	if err != nil {
+		return nil, &FlowError{Op: "InferSchemas", FlowName: flowName, Err: err}
+	}
+	return c.inferSchemas(ctx, flowName, points, opts...)
+}
+
+// inferSchemas decrypts stored points before inferring their schemas.
+func (c *FlowClient) inferSchemas(ctx context.Context, flowName string, points []Point, opts ...InferOption) ([]InferredSchema, error) {
+	if err := c.decryptRun(ctx, points, nil); err != nil {
+		return nil, &FlowError{Op: "InferSchemas", FlowName: flowName, Err: err}
+	}
+	schemas, err := InferSchemas(flowName, points, opts...)
+	if err != nil {
+		return nil, &FlowError{Op: "InferSchemas", FlowName: flowName, Err: err}
+	}
+	return schemas, nil
+}
+
+// shape accumulates the values seen at one position of the samples.
+type shape struct {
+	cfg     inferConfig
+	anys    int
+	types   map[string]int
+	objects int
+	props   map[string]*shape
+	items   *shape
+	// strs counts distinct string values while they can still form an enum;
+	// openStrings is set once they cannot (too many, or a string matcher).
+	strs        map[string]int
+	openStrings bool
+	timestamps  int
+}
+
+func newShape(cfg inferConfig) *shape {
+	return &shape{cfg: cfg, types: map[string]int{}, strs: map[string]int{}}
+}
+
+func (s *shape) add(v interface{}) {
+	if m, ok := matcherFrom(v); ok {
+		switch m.Kind {
+		case MatchAny:
+			s.anys++
+		case MatchNumber, MatchBetween:
+			s.types["number"]++
+		case MatchTimestamp:
+			s.types["string"]++
+			s.openStrings = true
+			if m.Layout == "" {
+				s.timestamps++
+			}
+		default:
+			s.types["string"]++
+			s.openStrings = true
+		}
+		return
+	}
+
+	s.types[getTypeName(v)]++
+	switch val := v.(type) {
+	case string:
+		if s.openStrings {
+			return
+		}
+		s.strs[val]++
+		if len(s.strs) > s.cfg.enumThreshold {
+			s.openStrings = true
+			s.strs = nil
+		}
+	case []interface{}:
+		if s.items == nil {
+			s.items = newShape(s.cfg)
+		}
+		for _, item := range val {
+			s.items.add(item)
+		}
+	case map[string]interface{}:
+		s.objects++
+		if s.props == nil {
+			s.props = map[string]*shape{}
+		}
+		for k, item := range val {
+			if s.props[k] == nil {
+				s.props[k] = newShape(s.cfg)
+			}
+			s.props[k].add(item)
+		}
+	}
+}
+
+// inferTypeOrder fixes the order of type unions.
+var inferTypeOrder = []string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+func (s *shape) schema() map[string]interface{} {
+	out := map[string]interface{}{}
+	if s.anys > 0 {
+		return out
+	}
+
+	if s.types["integer"] > 0 && s.types["number"] > 0 {
+		s.types["number"] += s.types["integer"]
+		delete(s.types, "integer")
+	}
+	var types []string
+	for _, t := range inferTypeOrder {
+		if s.types[t] > 0 {
+			types = append(types, t)
+		}
+	}
+	switch len(types) {
+	case 0:
+	case 1:
+		out["type"] = types[0]
+	default:
+		out["type"] = types
+	}
+
+	if enum := s.enum(); enum != nil {
+		out["enum"] = enum
+	}
+	if s.timestamps > 0 && s.timestamps == s.types["string"] {
+		out["format"] = "date-time"
+	}
+
+	if s.items != nil && s.items.seen() > 0 {
+		out["items"] = s.items.schema()
+	}
+
+	if s.objects > 0 {
+		props := map[string]interface{}{}
+		var required []string
+		for k, p := range s.props {
+			props[k] = p.schema()
+			if p.seen() == s.objects {
+				required = append(required, k)
+			}
+		}
+		sort.Strings(required)
+		out["properties"] = props
+		if len(required) > 0 {
+			out["required"] = required
+		}
+	}
+	return out
+}
+
+// seen is the number of values recorded, matchers included.
+func (s *shape) seen() int {
+	n := s.anys
+	for _, c := range s.types {
+		n += c
+	}
+	return n
+}
+
+// enum returns the string values of a string (or nullable string) field that
+// qualifies under the enum threshold, with null appended when seen.
+func (s *shape) enum() []interface{} {
+	n := s.types["string"]
+	if s.cfg.enumThreshold <= 0 || s.openStrings || n == 0 {
+		return nil
+	}
+	if n+s.types["null"] != s.seen() || n < 2*len(s.strs) {
+		return nil
+	}
+	values := make([]string, 0, len(s.strs))
+	for v := range s.strs {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	enum := make([]interface{}, 0, len(values)+1)
+	for _, v := range values {
+		enum = append(enum, v)
+	}
+	if s.types["null"] > 0 {
+		enum = append(enum, nil)
+	}
+	return enum
+}
@@ -0,0 +1,155 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func inferPoints(description string, payloads ...string) []Point {
+	points := make([]Point, len(payloads))
+	for i, p := range payloads {
+		points[i] = Point{ID: int64(i + 1), Description: description, Expected: json.RawMessage(p)}
+	}
+	return points
+}
+
+func TestInferSchema(t *testing.T) {
+	points := inferPoints("Order Created",
+		`{"id": "ORD-1", "status": "NEW", "total": 10, "note": null, "items": [{"sku": "A", "qty": 1}]}`,
+		`{"id": "ORD-2", "status": "PAID", "total": 12.5, "note": "gift", "items": [{"sku": "B", "qty": 2, "gift": true}]}`,
+		`{"id": "ORD-3", "status": "NEW", "total": 7, "items": []}`,
+		`{"id": "ORD-4", "status": "PAID", "total": 3, "items": [{"sku": "C", "qty": 1}]}`,
+	)
+
+	raw, err := InferSchema(points, EnumThreshold(3))
+	if err != nil {
+		t.Fatalf("InferSchema() error = %v", err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(raw, &got)
+
+	want := map[string]interface{}{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"type":     "object",
+		"required": []interface{}{"id", "items", "status", "total"},
+		"properties": map[string]interface{}{
+			"id":     map[string]interface{}{"type": "string"},
+			"status": map[string]interface{}{"type": "string", "enum": []interface{}{"NEW", "PAID"}},
+			"total":  map[string]interface{}{"type": "number"},
+			"note":   map[string]interface{}{"type": []interface{}{"null", "string"}},
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []interface{}{"qty", "sku"},
+					"properties": map[string]interface{}{
+						"sku":  map[string]interface{}{"type": "string"},
+						"qty":  map[string]interface{}{"type": "integer"},
+						"gift": map[string]interface{}{"type": "boolean"},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InferSchema() =\n%s", raw)
+	}
+
+	for _, p := range points {
+		if diffs, err := ValidateSchema(raw, p.Expected); err != nil || len(diffs) != 0 {
+			t.Errorf("sample %d does not satisfy the inferred schema: %v %v", p.ID, diffs, err)
+		}
+	}
+}
+
+func TestInferSchemaEnumThreshold(t *testing.T) {
+	points := inferPoints("Order", `{"status": "NEW"}`, `{"status": "PAID"}`, `{"status": "NEW"}`, `{"status": "SHIPPED"}`)
+
+	tests := []struct {
+		name     string
+		opts     []InferOption
+		wantEnum bool
+	}{
+		{"Disabled by default", nil, false},
+		{"Within threshold", []InferOption{EnumThreshold(3)}, false}, // 3 values in 4 samples do not repeat enough
+		{"Too many values", []InferOption{EnumThreshold(2)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := InferSchema(points, tt.opts...)
+			if err != nil {
+				t.Fatalf("InferSchema() error = %v", err)
+			}
+			var got struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			}
+			json.Unmarshal(raw, &got)
+			if _, ok := got.Properties["status"]["enum"]; ok != tt.wantEnum {
+				t.Errorf("InferSchema() = %s, want enum %v", raw, tt.wantEnum)
+			}
+		})
+	}
+
+	repeated := append(points, inferPoints("Order", `{"status": "PAID"}`, `{"status": "SHIPPED"}`)...)
+	raw, _ := InferSchema(repeated, EnumThreshold(3))
+	var got struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	json.Unmarshal(raw, &got)
+	if enum := got.Properties["status"]["enum"]; !reflect.DeepEqual(enum, []interface{}{"NEW", "PAID", "SHIPPED"}) {
+		t.Errorf("enum = %v", enum)
+	}
+}
+
+func TestInferSchemaMatchers(t *testing.T) {
+	expected, _ := json.Marshal(map[string]interface{}{
+		"id":    Regex("^ORD-"),
+		"at":    Timestamp(),
+		"score": Between(0, 1),
+		"meta":  Any(),
+	})
+	raw, err := InferSchema([]Point{{Expected: expected}, {Expected: json.RawMessage(`{"id": "ORD-9", "at": "2024-01-01T00:00:00Z", "score": 1}`)}})
+	if err != nil {
+		t.Fatalf("InferSchema() error = %v", err)
+	}
+	var got struct {
+		Required   []string                          `json:"required"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	json.Unmarshal(raw, &got)
+
+	if got.Properties["id"]["type"] != "string" || got.Properties["at"]["type"] != "string" {
+		t.Errorf("string matchers = %v, %v", got.Properties["id"], got.Properties["at"])
+	}
+	if got.Properties["score"]["type"] != "number" {
+		t.Errorf("between matcher = %v", got.Properties["score"])
+	}
+	if len(got.Properties["meta"]) != 0 {
+		t.Errorf("any matcher = %v, want an empty schema", got.Properties["meta"])
+	}
+	if !reflect.DeepEqual(got.Required, []string{"at", "id", "score"}) {
+		t.Errorf("required = %v", got.Required)
+	}
+}
+
+func TestInferSchemas(t *testing.T) {
+	points := append(inferPoints("Shipped", `{"carrier": "DHL"}`),
+		inferPoints("Created", `{"id": 1}`, `{"id": 2}`)...)
+
+	schemas, err := InferSchemas("Order Processing", points)
+	if err != nil {
+		t.Fatalf("InferSchemas() error = %v", err)
+	}
+	if len(schemas) != 2 || schemas[0].Description != "Created" || schemas[0].Samples != 2 ||
+		schemas[1].Description != "Shipped" || schemas[1].FlowName != "Order Processing" {
+		t.Errorf("InferSchemas() = %+v", schemas)
+	}
+
+	if _, err := InferSchemas("Order", inferPoints("Bad", `{"id": `)); err == nil {
+		t.Error("InferSchemas() should fail on invalid expected JSON")
+	}
+	if _, err := InferSchema(nil); err == nil {
+		t.Error("InferSchema() should fail without points")
+	}
+}
@@ -0,0 +1,149 @@
+package flow
+
+import (
+	"fmt"
+	"time"
+)
+
+// SeverityRule sets the severity of diffs at Path and below it, optionally
+// only those of Kind. An empty Path matches every path. The last matching
+// rule wins, so point rules override flow-name and client rules.
+type SeverityRule struct {
+	Path     string   `json:"path,omitempty"`
+	Kind     DiffKind `json:"kind,omitempty"`
+	Severity Severity `json:"severity"`
+}
+
+// KnownDifference acknowledges a failing diff at Path (optionally only of
+// Kind) until Expires: it is reported as a warning naming Owner instead of
+// failing the comparison. Once expired, it fails again.
+type KnownDifference struct {
+	Path    string    `json:"path"`
+	Kind    DiffKind  `json:"kind,omitempty"`
+	Owner   string    `json:"owner"`
+	Reason  string    `json:"reason,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// PathSeverity reports diffs below the paths with severity (SeverityWarning,
+// SeverityInfo, or SeverityError to override a broader rule).
+func PathSeverity(severity Severity, paths ...string) CompareOption {
+	return KindSeverity("", severity, paths...)
+}
+
+// KindSeverity reports diffs of kind below the paths (the whole document when
+// none are given) with severity.
+func KindSeverity(kind DiffKind, severity Severity, paths ...string) CompareOption {
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	return func(o *CompareOptions) {
+		for _, p := range paths {
+			o.Severities = append(o.Severities, SeverityRule{Path: p, Kind: kind, Severity: severity})
+		}
+	}
+}
+
+// KnownDifferences acknowledges failing diffs until they expire.
+func KnownDifferences(known ...KnownDifference) CompareOption {
+	return func(o *CompareOptions) {
+		o.Known = append(o.Known, known...)
+	}
+}
+
+func validSeverity(s Severity) bool {
+	switch s {
+	case SeverityError, SeverityWarning, SeverityInfo:
+		return true
+	}
+	return false
+}
+
+type compiledSeverityRule struct {
+	pattern  pathPattern // nil matches every path
+	kind     DiffKind
+	severity Severity
+}
+
+type compiledKnownDifference struct {
+	pattern pathPattern
+	known   KnownDifference
+}
+
+func compileSeverityRules(rules []SeverityRule) ([]compiledSeverityRule, error) {
+	out := make([]compiledSeverityRule, 0, len(rules))
+	for _, r := range rules {
+		if !validSeverity(r.Severity) {
+			return nil, fmt.Errorf("invalid severity %q for %q", r.Severity, r.Path)
+		}
+		cr := compiledSeverityRule{kind: r.Kind, severity: r.Severity}
+		if r.Path != "" {
+			segs, err := parsePath(r.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid severity path: %w", err)
+			}
+			cr.pattern = segs
+		}
+		out = append(out, cr)
+	}
+	return out, nil
+}
+
+func compileKnownDifferences(known []KnownDifference) ([]compiledKnownDifference, error) {
+	out := make([]compiledKnownDifference, 0, len(known))
+	for _, k := range known {
+		segs, err := parsePath(k.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid known difference path: %w", err)
+		}
+		out = append(out, compiledKnownDifference{pattern: segs, known: k})
+	}
+	return out, nil
+}
+
+// classify applies the severity rules, then the known differences, to d.
+func (c *comparer) classify(d *DiffEntry, segs []pathSegment) {
+	if segs == nil && d.Path != "$" {
+		segs, _ = parsePath(d.Path)
+	}
+	for i := len(c.severities) - 1; i >= 0; i-- {
+		r := c.severities[i]
+		if (r.kind == "" || r.kind == d.Kind) && (r.pattern == nil || r.pattern.matchesWithin(segs)) {
+			d.Severity = r.severity
+			break
+		}
+	}
+	if d.IsWarning() {
+		return
+	}
+
+	for i := len(c.known) - 1; i >= 0; i-- {
+		k := c.known[i]
+		if (k.known.Kind != "" && k.known.Kind != d.Kind) || !k.pattern.matchesWithin(segs) {
+			continue
+		}
+		if c.now.After(k.known.Expires) {
+			d.Message += fmt.Sprintf(" (known difference owned by %s expired on %s)", k.known.Owner, k.known.Expires.Format("2006-01-02"))
+			return
+		}
+		d.Severity = SeverityWarning
+		d.Message += fmt.Sprintf(" (known difference owned by %s until %s)", k.known.Owner, k.known.Expires.Format("2006-01-02"))
+		return
+	}
+}
+
+// ClassifyDiffs applies the severity rules and known differences of opts to
+// diffs produced outside DeepCompare (validators, expressions, schemas).
+func ClassifyDiffs(opts CompareOptions, diffs []DiffEntry) []DiffEntry {
+	if len(opts.Severities) == 0 && len(opts.Known) == 0 {
+		return diffs
+	}
+	c, err := newComparer(opts)
+	if err != nil {
+		return append(diffs, invalidOptionsDiff(err))
+	}
+	for i := range diffs {
+		c.classify(&diffs[i], diffs[i].segs)
+	}
+	return diffs
+}
@@ -0,0 +1,127 @@
+package flow
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeepCompareSeverityRules(t *testing.T) {
+	expected := json.RawMessage(`{"id": 1, "meta": {"v": 1, "region": "eu"}, "status": "paid"}`)
+	actual := json.RawMessage(`{"id": 1, "meta": {"v": 2, "zone": "a"}, "status": "PAID"}`)
+
+	tests := []struct {
+		name                   string
+		opts                   []CompareOption
+		wantEqual              bool
+		wantErrs, wantWarnings int
+	}{
+		{"No rules", nil, false, 4, 0},
+		{"Path downgraded", []CompareOption{PathSeverity(SeverityWarning, "$.meta")}, false, 1, 3},
+		{"Everything downgraded", []CompareOption{PathSeverity(SeverityInfo)}, true, 0, 4},
+		{"Kind downgraded", []CompareOption{KindSeverity(DiffExtraKey, SeverityInfo)}, false, 3, 1},
+		{"Narrower rule restores errors", []CompareOption{PathSeverity(SeverityWarning), PathSeverity(SeverityError, "$.status")}, false, 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, equal := DeepCompare(expected, actual, tt.opts...)
+			errs, warnings := SplitDiffs(diffs)
+			if equal != tt.wantEqual || len(errs) != tt.wantErrs || len(warnings) != tt.wantWarnings {
+				t.Errorf("DeepCompare() equal = %v, %d errors, %d warnings; want %v, %d, %d. Diffs: %v",
+					equal, len(errs), len(warnings), tt.wantEqual, tt.wantErrs, tt.wantWarnings, diffs)
+			}
+		})
+	}
+}
+
+func TestKnownDifferences(t *testing.T) {
+	expected := json.RawMessage(`{"total": 10, "currency": "EUR"}`)
+	actual := json.RawMessage(`{"total": 11, "currency": "eur"}`)
+	future := time.Now().Add(24 * time.Hour)
+	past := time.Now().Add(-24 * time.Hour)
+
+	diffs, equal := DeepCompare(expected, actual, KnownDifferences(
+		KnownDifference{Path: "$.total", Owner: "billing", Reason: "rounding fix pending", Expires: future},
+		KnownDifference{Path: "$.currency", Kind: DiffTypeMismatch, Owner: "billing", Expires: future},
+	))
+	if equal || len(diffs) != 2 {
+		t.Fatalf("DeepCompare() = %v, %v; want the currency diff to fail", diffs, equal)
+	}
+	if diffs[1].Path != "$.total" || !diffs[1].IsWarning() || !strings.Contains(diffs[1].Message, "known difference owned by billing until") {
+		t.Errorf("known difference = %+v", diffs[1])
+	}
+	if diffs[0].IsWarning() {
+		t.Errorf("a known difference of another kind should not apply: %+v", diffs[0])
+	}
+
+	diffs, equal = DeepCompare(expected, json.RawMessage(`{"total": 11, "currency": "EUR"}`), KnownDifferences(
+		KnownDifference{Path: "$.total", Owner: "billing", Expires: past},
+	))
+	if equal || len(diffs) != 1 || !strings.Contains(diffs[0].Message, "expired on "+past.Format("2006-01-02")) {
+		t.Errorf("expired known difference = %v, %v", diffs, equal)
+	}
+}
+
+func TestClassifyDiffsOutsideDeepCompare(t *testing.T) {
+	client, _ := NewClient(nil, FlowConfig{
+		IsProduction:       true,
+		FlowCompareOptions: map[string]CompareOptions{"Billing": NewCompareOptions(KindSeverity(DiffExpressionFailed, SeverityWarning))},
+	})
+	p := Point{Expected: json.RawMessage(`{}`), Expressions: []string{"actual.total > 0"}}
+	a := Assertion{Actual: json.RawMessage(`{"total": 0}`)}
+
+	// CreatePoint stores the flow-name rules with the point.
+	billing := p
+	opts := client.compareOptionsFor("Billing")
+	billing.Compare = &opts
+	diffs := client.comparePoint("Billing", billing, a)
+	if len(diffs) != 1 || !diffs[0].IsWarning() {
+		t.Errorf("comparePoint(Billing) = %v, want a warning", diffs)
+	}
+	if diffs := client.comparePoint("Shipping", p, a); len(diffs) != 1 || diffs[0].IsWarning() {
+		t.Errorf("comparePoint(Shipping) = %v, want an error", diffs)
+	}
+}
+
+func TestSeverityValidation(t *testing.T) {
+	for _, opts := range []CompareOptions{
+		NewCompareOptions(PathSeverity("fatal", "$.a")),
+		NewCompareOptions(PathSeverity(SeverityWarning, "a")),
+		NewCompareOptions(KnownDifferences(KnownDifference{Path: "$.a", Expires: time.Now()})),
+		NewCompareOptions(KnownDifferences(KnownDifference{Path: "$.a", Owner: "billing"})),
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", opts)
+		}
+	}
+	if err := NewCompareOptions(PathSeverity(SeverityInfo)).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestSeverityRuleErrors(t *testing.T) {
+	expected := json.RawMessage(`{"a": {"b": 1}}`)
+	actual := json.RawMessage(`{"a": {"b": 2}}`)
+
+	diffs, equal := DeepCompare(expected, actual, PathSeverity(SeverityWarning, "$.a"), PathSeverity(SeverityError, "$.a.b"))
+	if equal || len(diffs) != 1 || diffs[0].Severity != SeverityError {
+		t.Errorf("DeepCompare() = %v, %v; want an explicit error", diffs, equal)
+	}
+	if diffs, _ := DeepCompare(expected, actual); len(diffs) != 1 || diffs[0].Severity != "" {
+		t.Errorf("DeepCompare() = %v; want an unclassified error", diffs)
+	}
+
+	for _, opt := range []CompareOption{
+		PathSeverity(SeverityWarning, "$["),
+		KnownDifferences(KnownDifference{Path: "a.b", Owner: "billing", Expires: time.Now().Add(time.Hour)}),
+	} {
+		diffs, equal := DeepCompare(expected, actual, opt)
+		if equal || len(diffs) != 1 || diffs[0].Kind != DiffInvalid || !strings.Contains(diffs[0].Message, "invalid compare options") {
+			t.Errorf("DeepCompare() = %v, %v; want the invalid rule reported", diffs, equal)
+		}
+	}
+	if _, err := JSONPatch(expected, actual, PathSeverity(SeverityWarning, "$[")); err == nil {
+		t.Error("JSONPatch() should reject an invalid severity path")
+	}
+}
@@ -30,22 +30,48 @@ CREATE TABLE IF NOT EXISTS points (
     service_name VARCHAR(255),
     schema JSONB,
     timeout BIGINT,
+    compare JSONB,
+    validator VARCHAR(100),
+    expressions JSONB,
+    content_type VARCHAR(100),
+    raw BYTEA,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+ALTER TABLE points ADD COLUMN IF NOT EXISTS compare JSONB;
+ALTER TABLE points ADD COLUMN IF NOT EXISTS validator VARCHAR(100);
+ALTER TABLE points ADD COLUMN IF NOT EXISTS expressions JSONB;
+ALTER TABLE points ADD COLUMN IF NOT EXISTS content_type VARCHAR(100);
+ALTER TABLE points ADD COLUMN IF NOT EXISTS raw BYTEA;
+
 CREATE TABLE IF NOT EXISTS assertions (
     id BIGSERIAL PRIMARY KEY,
     flow_id BIGINT REFERENCES flows(id) ON DELETE CASCADE,
     actual JSONB,
     service_name VARCHAR(255),
     processed_at TIMESTAMP,
+    content_type VARCHAR(100),
+    raw BYTEA,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+ALTER TABLE assertions ADD COLUMN IF NOT EXISTS content_type VARCHAR(100);
+ALTER TABLE assertions ADD COLUMN IF NOT EXISTS raw BYTEA;
+
+CREATE TABLE IF NOT EXISTS flow_identifiers (
+    id BIGSERIAL PRIMARY KEY,
+    flow_id BIGINT REFERENCES flows(id) ON DELETE CASCADE,
+    kind VARCHAR(100) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (flow_id, kind, value)
+);
+
 CREATE INDEX IF NOT EXISTS idx_points_flow_id ON points(flow_id);
 CREATE INDEX IF NOT EXISTS idx_assertions_flow_id ON assertions(flow_id);
 CREATE INDEX IF NOT EXISTS idx_flows_name_status ON flows(name, status);
 CREATE INDEX IF NOT EXISTS idx_flows_identifier ON flows(identifier);
+CREATE INDEX IF NOT EXISTS idx_flow_identifiers_value ON flow_identifiers(value);
 `
 
 // pgStorage implements Storage using PostgreSQL.
@@ -113,7 +139,7 @@ func (s *pgStorage) FindActiveFlow(ctx context.Context, flowName, identifier str
 	args := []interface{}{flowName}
 
 	if identifier != "" {
-		query += " AND identifier = $2"
+		query += " AND (identifier = $2 OR id IN (SELECT flow_id FROM flow_identifiers WHERE value = $2))"
 		args = append(args, identifier)
 	} else {
 		query += " AND identifier IS NULL"
@@ -136,9 +162,106 @@ func (s *pgStorage) FindActiveFlow(ctx context.Context, flowName, identifier str
 		return nil, fmt.Errorf("error fetching flow: %w", err)
 	}
 	f.Identifier = identSql.String
+	if f.Aliases, err = s.fetchIdentifiers(ctx, f.ID); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *pgStorage) FindActiveFlowByID(ctx context.Context, flowID int64) (*Flow, error) {
+	var f Flow
+	var identSql, svcSql sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, identifier, status, service, created_at FROM flows WHERE id = $1 AND status = 'ACTIVE'", flowID,
+	).Scan(&f.ID, &f.Name, &identSql, &f.Status, &svcSql, &f.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &FlowError{
+				Op:  "GetFlowByID",
+				Err: ErrFlowNotFound,
+			}
+		}
+		return nil, fmt.Errorf("error fetching flow: %w", err)
+	}
+	f.Identifier = identSql.String
+	f.Service = svcSql.String
+	if f.Aliases, err = s.fetchIdentifiers(ctx, f.ID); err != nil {
+		return nil, err
+	}
 	return &f, nil
 }
 
+// FindFlowByID returns a flow whatever its status.
+func (s *pgStorage) FindFlowByID(ctx context.Context, flowID int64) (*Flow, error) {
+	var f Flow
+	var identSql, svcSql sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, identifier, status, service, created_at FROM flows WHERE id = $1", flowID,
+	).Scan(&f.ID, &f.Name, &identSql, &f.Status, &svcSql, &f.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &FlowError{
+				Op:  "GetFlowByID",
+				Err: ErrFlowNotFound,
+			}
+		}
+		return nil, fmt.Errorf("error fetching flow: %w", err)
+	}
+	f.Identifier = identSql.String
+	f.Service = svcSql.String
+	return &f, nil
+}
+
+// RecentFlowIDs returns the IDs of the last finished runs of flowName that
+// started before the run beforeID, newest first.
+func (s *pgStorage) RecentFlowIDs(ctx context.Context, flowName string, beforeID int64, limit int) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id FROM flows WHERE name = $1 AND id < $2 AND status = 'FINISHED' ORDER BY id DESC LIMIT $3", flowName, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent flows: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *pgStorage) InsertIdentifier(ctx context.Context, flowID int64, kind, value string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO flow_identifiers (flow_id, kind, value) VALUES ($1, $2, $3) ON CONFLICT (flow_id, kind, value) DO NOTHING",
+		flowID, kind, value)
+	if err != nil {
+		return fmt.Errorf("failed to add identifier: %w", err)
+	}
+	return nil
+}
+
+func (s *pgStorage) fetchIdentifiers(ctx context.Context, flowID int64) ([]FlowIdentifier, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, value FROM flow_identifiers WHERE flow_id = $1 ORDER BY id ASC", flowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identifiers: %w", err)
+	}
+	defer rows.Close()
+
+	var identifiers []FlowIdentifier
+	for rows.Next() {
+		var fi FlowIdentifier
+		if err := rows.Scan(&fi.Kind, &fi.Value); err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, fi)
+	}
+	return identifiers, rows.Err()
+}
+
 func (s *pgStorage) FinishFlow(ctx context.Context, flowID int64) error {
 	_, err := s.db.ExecContext(ctx,
 		"UPDATE flows SET status = 'FINISHED', updated_at = CURRENT_TIMESTAMP WHERE id = $1", flowID)
@@ -157,20 +280,49 @@ func (s *pgStorage) InsertPoint(ctx context.Context, p *Point) error {
 	if p.Timeout != nil {
 		timeoutArg = p.Timeout.Milliseconds()
 	}
+	var compareArg interface{}
+	if p.Compare != nil {
+		compareJSON, err := json.Marshal(p.Compare)
+		if err != nil {
+			return fmt.Errorf("failed to marshal compare options: %w", err)
+		}
+		compareArg = compareJSON
+	}
+	var validatorArg interface{}
+	if p.Validator != "" {
+		validatorArg = p.Validator
+	}
+	var expressionsArg interface{}
+	if len(p.Expressions) > 0 {
+		expressionsJSON, err := json.Marshal(p.Expressions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal expressions: %w", err)
+		}
+		expressionsArg = expressionsJSON
+	}
+
+	var contentTypeArg interface{}
+	if p.ContentType != "" {
+		contentTypeArg = p.ContentType
+	}
 
 	_, err := s.db.ExecContext(ctx,
-		"INSERT INTO points (flow_id, description, expected, service_name, schema, timeout) VALUES ($1, $2, $3, $4, $5, $6)",
-		p.FlowID, p.Description, []byte(p.Expected), p.ServiceName, schemaArg, timeoutArg)
+		"INSERT INTO points (flow_id, description, expected, service_name, schema, timeout, compare, validator, expressions, content_type, raw) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		p.FlowID, p.Description, []byte(p.Expected), p.ServiceName, schemaArg, timeoutArg, compareArg, validatorArg, expressionsArg, contentTypeArg, p.Raw)
 	if err != nil {
 		return fmt.Errorf("failed to create point: %w", err)
 	}
 	return nil
 }
 
-func (s *pgStorage) InsertAssertion(ctx context.Context, flowID int64, actualJSON []byte, serviceName string) error {
+func (s *pgStorage) InsertAssertion(ctx context.Context, a *Assertion) error {
+	var contentTypeArg interface{}
+	if a.ContentType != "" {
+		contentTypeArg = a.ContentType
+	}
 	_, err := s.db.ExecContext(ctx,
-		"INSERT INTO assertions (flow_id, actual, service_name, processed_at) VALUES ($1, $2, $3, $4)",
-		flowID, actualJSON, serviceName, time.Now())
+		"INSERT INTO assertions (flow_id, actual, service_name, processed_at, content_type, raw) VALUES ($1, $2, $3, $4, $5, $6)",
+		a.FlowID, []byte(a.Actual), a.ServiceName, time.Now(), contentTypeArg, a.Raw)
 	if err != nil {
 		return fmt.Errorf("failed to add assertion: %w", err)
 	}
@@ -215,7 +367,7 @@ func (s *pgStorage) FetchPointsAndAssertions(ctx context.Context, flowID int64)
 
 func (s *pgStorage) fetchPoints(ctx context.Context, flowID int64) ([]Point, error) {
 	rows, err := s.db.QueryContext(ctx,
-		"SELECT id, description, expected, created_at FROM points WHERE flow_id = $1 ORDER BY created_at ASC", flowID)
+		"SELECT id, description, expected, schema, compare, validator, expressions, content_type, raw, created_at FROM points WHERE flow_id = $1 ORDER BY created_at ASC", flowID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch points: %w", err)
 	}
@@ -224,12 +376,56 @@ func (s *pgStorage) fetchPoints(ctx context.Context, flowID int64) ([]Point, err
 	var points []Point
 	for rows.Next() {
 		var p Point
-		var expectedBytes []byte
-		if err := rows.Scan(&p.ID, &p.Description, &expectedBytes, &p.CreatedAt); err != nil {
+		var expectedBytes, schemaBytes, compareBytes, expressionsBytes []byte
+		var validator, contentType sql.NullString
+		if err := rows.Scan(&p.ID, &p.Description, &expectedBytes, &schemaBytes, &compareBytes, &validator, &expressionsBytes, &contentType, &p.Raw, &p.CreatedAt); err != nil {
 			return nil, err
 		}
+		p.ContentType = contentType.String
+		if schemaBytes != nil {
+			p.Schema = json.RawMessage(schemaBytes)
+		}
+		p.Validator = validator.String
 		if expectedBytes != nil {
-			p.Expected = json.RawMessage(expectedBytes)
+			if p.Expected, err = OpenPayload(expectedBytes); err != nil {
+				return nil, fmt.Errorf("failed to open payload of point %d: %w", p.ID, err)
+			}
+		}
+		if compareBytes != nil {
+			p.Compare = &CompareOptions{}
+			if err := json.Unmarshal(compareBytes, p.Compare); err != nil {
+				return nil, fmt.Errorf("failed to decode compare options of point %d: %w", p.ID, err)
+			}
+		}
+		if expressionsBytes != nil {
+			if err := json.Unmarshal(expressionsBytes, &p.Expressions); err != nil {
+				return nil, fmt.Errorf("failed to decode expressions of point %d: %w", p.ID, err)
+			}
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// FetchPointsByFlowName returns the most recent points recorded under
+// flowName across all its flows.
+func (s *pgStorage) FetchPointsByFlowName(ctx context.Context, flowName string, limit int) ([]Point, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT p.id, p.flow_id, p.description, p.expected, p.created_at FROM points p JOIN flows f ON f.id = p.flow_id WHERE f.name = $1 ORDER BY p.id DESC LIMIT $2", flowName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch points: %w", err)
+	}
+	defer rows.Close()
+
+	var points []Point
+	for rows.Next() {
+		var p Point
+		var expectedBytes []byte
+		if err := rows.Scan(&p.ID, &p.FlowID, &p.Description, &expectedBytes, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		if p.Expected, err = OpenPayload(expectedBytes); err != nil {
+			return nil, fmt.Errorf("failed to open payload of point %d: %w", p.ID, err)
 		}
 		points = append(points, p)
 	}
@@ -238,7 +434,7 @@ func (s *pgStorage) fetchPoints(ctx context.Context, flowID int64) ([]Point, err
 
 func (s *pgStorage) fetchAssertions(ctx context.Context, flowID int64) ([]Assertion, error) {
 	rows, err := s.db.QueryContext(ctx,
-		"SELECT id, actual, created_at FROM assertions WHERE flow_id = $1 ORDER BY created_at ASC", flowID)
+		"SELECT id, actual, content_type, raw, created_at FROM assertions WHERE flow_id = $1 ORDER BY created_at ASC", flowID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch assertions: %w", err)
 	}
@@ -248,13 +444,63 @@ func (s *pgStorage) fetchAssertions(ctx context.Context, flowID int64) ([]Assert
 	for rows.Next() {
 		var a Assertion
 		var actualBytes []byte
-		if err := rows.Scan(&a.ID, &actualBytes, &a.CreatedAt); err != nil {
+		var contentType sql.NullString
+		if err := rows.Scan(&a.ID, &actualBytes, &contentType, &a.Raw, &a.CreatedAt); err != nil {
 			return nil, err
 		}
+		a.ContentType = contentType.String
 		if actualBytes != nil {
-			a.Actual = json.RawMessage(actualBytes)
+			if a.Actual, err = OpenPayload(actualBytes); err != nil {
+				return nil, fmt.Errorf("failed to open payload of assertion %d: %w", a.ID, err)
+			}
 		}
 		assertions = append(assertions, a)
 	}
 	return assertions, rows.Err()
 }
+
+// encryptedRow is a stored payload RotateKeys re-encrypts.
+type encryptedRow struct {
+	id      int64
+	payload []byte
+	raw     []byte
+}
+
+// payloadColumns maps the tables holding payloads to their payload column.
+var payloadColumns = map[string]string{"points": "expected", "assertions": "actual"}
+
+// FetchStaleEncrypted returns rows of table after the id after whose payload
+// is encrypted with a key other than currentKey.
+func (s *pgStorage) FetchStaleEncrypted(ctx context.Context, table, currentKey string, after int64, limit int) ([]encryptedRow, error) {
+	col, ok := payloadColumns[table]
+	if !ok {
+		return nil, fmt.Errorf("no payloads in table %q", table)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, %[1]s, raw FROM %[2]s WHERE %[1]s->>'$flow_payload' = 'encrypted' AND %[1]s->>'key' <> $1 AND id > $2 ORDER BY id LIMIT $3", col, table), currentKey, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch encrypted payloads: %w", err)
+	}
+	defer rows.Close()
+
+	var out []encryptedRow
+	for rows.Next() {
+		var r encryptedRow
+		if err := rows.Scan(&r.id, &r.payload, &r.raw); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *pgStorage) UpdateEncrypted(ctx context.Context, table string, r encryptedRow) error {
+	col, ok := payloadColumns[table]
+	if !ok {
+		return fmt.Errorf("no payloads in table %q", table)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s = $1, raw = $2 WHERE id = $3", table, col), r.payload, r.raw, r.id); err != nil {
+		return fmt.Errorf("failed to update encrypted payload: %w", err)
+	}
+	return nil
+}
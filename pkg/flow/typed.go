@@ -0,0 +1,252 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PointOf creates a point from a value of the Go type both services share.
+// Comparison rules declared with `flow` struct tags on T are stored with the
+// point, before the rules of opts:
+//
+//	type Order struct {
+//	    ID        string    `json:"id"`
+//	    CreatedAt time.Time `json:"created_at" flow:"ignore"`
+//	    Total     float64   `json:"total" flow:"tolerance=0.01"`
+//	    Items     []Item    `json:"items"`
+//	    Tags      []string  `json:"tags" flow:"unordered"`
+//	}
+//	type Item struct {
+//	    SKU string `json:"sku" flow:"key"` // Items are matched by sku
+//	}
+//
+// Tags are comma-separated: ignore, tolerance=<abs> or tolerance=<rel>%,
+// unordered (a multiset), key (match slices of the struct by this field).
+// Paths follow the json tags, as encoding/json does. Tags of a recursive
+// type apply at its outermost level only.
+func PointOf[T any](ctx context.Context, f FlowExecutor, description string, expected T, opts ...PointOption) error {
+	tagged, err := TagCompareOptions[T]()
+	if err != nil {
+		return err
+	}
+	if !tagged.IsZero() {
+		opts = append([]PointOption{WithCompareOptions(func(o *CompareOptions) {
+			*o = o.Merge(tagged)
+		})}, opts...)
+	}
+	return f.CreatePoint(ctx, description, expected, opts...)
+}
+
+// AssertOf adds an assertion of the type its point was created with.
+func AssertOf[T any](ctx context.Context, f FlowExecutor, actual T, opts ...AssertionOption) error {
+	return f.AddAssertion(ctx, actual, opts...)
+}
+
+// TagCompareOptions returns the comparison rules declared with `flow` struct
+// tags on T. See PointOf for the tag syntax.
+func TagCompareOptions[T any]() (CompareOptions, error) {
+	return tagCompareOptions(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+type tagOptions struct {
+	opts CompareOptions
+	err  error
+}
+
+// tagOptionsCache holds the parsed rules of each type, so PointOf costs a map
+// lookup once a type has been seen.
+var tagOptionsCache sync.Map // reflect.Type -> tagOptions
+
+func tagCompareOptions(t reflect.Type) (CompareOptions, error) {
+	if cached, ok := tagOptionsCache.Load(t); ok {
+		c := cached.(tagOptions)
+		return c.opts, c.err
+	}
+	var opts CompareOptions
+	err := collectTagRules(t, "$", map[reflect.Type]bool{}, &opts)
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		err = &ConfigError{msg: fmt.Sprintf("flow tags of %s: %v", t, err)}
+		opts = CompareOptions{}
+	}
+	tagOptionsCache.Store(t, tagOptions{opts: opts, err: err})
+	return opts, err
+}
+
+// flowTag is a parsed `flow` struct tag.
+type flowTag struct {
+	ignore    bool
+	key       bool
+	unordered bool
+	tolerance *NumericTolerance
+}
+
+func parseFlowTag(tag string) (flowTag, error) {
+	var ft flowTag
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "":
+		case "ignore":
+			ft.ignore = true
+		case "key":
+			ft.key = true
+		case "unordered":
+			ft.unordered = true
+		case "tolerance":
+			t := &NumericTolerance{}
+			rel := strings.HasSuffix(value, "%")
+			f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil || f < 0 {
+				return ft, fmt.Errorf("invalid tolerance %q", value)
+			}
+			if rel {
+				t.Rel = f / 100
+			} else {
+				t.Abs = f
+			}
+			ft.tolerance = t
+		default:
+			return ft, fmt.Errorf("unknown flow tag option %q", name)
+		}
+	}
+	return ft, nil
+}
+
+// jsonFieldName returns the name encoding/json uses for f, and whether f is
+// skipped or flattened into its parent.
+func jsonFieldName(f reflect.StructField) (name string, skip, flatten bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true, false
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if f.Anonymous && name == "" {
+		t := f.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			return "", false, true
+		}
+	}
+	if !f.IsExported() {
+		return "", true, false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, false, false
+}
+
+// keyField returns the json name of the field of struct t tagged `flow:"key"`.
+func keyField(t reflect.Type) (string, error) {
+	var key string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft, err := parseFlowTag(f.Tag.Get("flow"))
+		if err != nil || !ft.key {
+			continue
+		}
+		name, skip, _ := jsonFieldName(f)
+		if skip || name == "" {
+			return "", fmt.Errorf("key field %s is not encoded", f.Name)
+		}
+		if key != "" {
+			return "", fmt.Errorf("several key fields (%s, %s)", key, name)
+		}
+		key = name
+	}
+	return key, nil
+}
+
+// collectTagRules adds the rules declared on t, found at path, to o. Types
+// already on the walk (recursive types) are visited once.
+func collectTagRules(t reflect.Type, path string, walking map[reflect.Type]bool, o *CompareOptions) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if walking[t] {
+			return nil
+		}
+		walking[t] = true
+		defer delete(walking, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, skip, flatten := jsonFieldName(f)
+			if skip {
+				continue
+			}
+			if flatten {
+				if err := collectTagRules(f.Type, path, walking, o); err != nil {
+					return err
+				}
+				continue
+			}
+
+			ft, err := parseFlowTag(f.Tag.Get("flow"))
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			fpath := path + "." + name
+			if ft.ignore {
+				IgnorePaths(fpath)(o)
+				continue
+			}
+			ftype := f.Type
+			for ftype.Kind() == reflect.Ptr {
+				ftype = ftype.Elem()
+			}
+			isList := ftype.Kind() == reflect.Slice || ftype.Kind() == reflect.Array
+			if ft.unordered {
+				if !isList {
+					return fmt.Errorf("field %s: unordered requires a slice or array", f.Name)
+				}
+				UnorderedArrays(true, fpath)(o)
+			}
+			if ft.tolerance != nil {
+				tpath := fpath
+				if isList {
+					tpath += "[*]"
+				}
+				PathTolerance(tpath, ft.tolerance.Abs, ft.tolerance.Rel)(o)
+			}
+			if err := collectTagRules(f.Type, fpath, walking, o); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		elem := t.Elem()
+		if elem.Kind() == reflect.Uint8 {
+			return nil // encoded as a base64 string
+		}
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			key, err := keyField(elem)
+			if err != nil {
+				return fmt.Errorf("%s: %w", elem, err)
+			}
+			if key != "" {
+				ArraysByKey(key, path)(o)
+			}
+		}
+		return collectTagRules(t.Elem(), path+"[*]", walking, o)
+
+	case reflect.Map:
+		return collectTagRules(t.Elem(), path+".*", walking, o)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type typedItem struct {
+	SKU   string  `json:"sku" flow:"key"`
+	Price float64 `json:"price" flow:"tolerance=1%"`
+}
+
+type typedMeta struct {
+	TraceID string `json:"trace_id" flow:"ignore"`
+}
+
+type typedOrder struct {
+	typedMeta
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"created_at" flow:"ignore"`
+	Total     float64           `json:"total" flow:"tolerance=0.01"`
+	Items     []typedItem       `json:"items"`
+	Tags      []string          `json:"tags" flow:"unordered"`
+	Labels    map[string]*typed `json:"labels,omitempty"`
+	Secret    string            `json:"-" flow:"ignore"`
+	internal  int
+}
+
+type typed struct {
+	Name     string   `json:"name" flow:"ignore"`
+	Children []*typed `json:"children"`
+}
+
+// recordingExecutor keeps what PointOf and AssertOf pass to the executor.
+type recordingExecutor struct {
+	point  Point
+	actual interface{}
+}
+
+func (r *recordingExecutor) CreatePoint(ctx context.Context, description string, expected interface{}, opts ...PointOption) error {
+	r.point = Point{Description: description}
+	for _, opt := range opts {
+		opt(&r.point)
+	}
+	return nil
+}
+
+func (r *recordingExecutor) AddAssertion(ctx context.Context, actual interface{}, opts ...AssertionOption) error {
+	r.actual = actual
+	return nil
+}
+
+func (r *recordingExecutor) AddIdentifier(ctx context.Context, kind, value string) error { return nil }
+func (r *recordingExecutor) Finish(ctx context.Context) (*FinishResult, error)           { return nil, nil }
+func (r *recordingExecutor) GetFlowInfo() *Flow                                          { return nil }
+
+func TestTagCompareOptions(t *testing.T) {
+	opts, err := TagCompareOptions[typedOrder]()
+	if err != nil {
+		t.Fatalf("TagCompareOptions() error = %v", err)
+	}
+
+	// typed is recursive: its tags apply at its outermost level only.
+	wantIgnore := []string{"$.trace_id", "$.created_at", "$.labels.*.name"}
+	if !reflect.DeepEqual(opts.IgnorePaths, wantIgnore) {
+		t.Errorf("IgnorePaths = %v, want %v", opts.IgnorePaths, wantIgnore)
+	}
+	wantTols := []NumericTolerance{{Path: "$.total", Abs: 0.01}, {Path: "$.items[*].price", Rel: 0.01}}
+	if !reflect.DeepEqual(opts.Tolerances, wantTols) {
+		t.Errorf("Tolerances = %v, want %v", opts.Tolerances, wantTols)
+	}
+	wantArrays := []ArrayRule{{Path: "$.items", Mode: ArrayKey, Key: "sku"}, {Path: "$.tags", Mode: ArrayMultiset}}
+	if !reflect.DeepEqual(opts.Arrays, wantArrays) {
+		t.Errorf("Arrays = %v, want %v", opts.Arrays, wantArrays)
+	}
+
+	if opts, err := TagCompareOptions[[]typedItem](); err != nil || len(opts.Arrays) != 1 || opts.Arrays[0].Path != "$" {
+		t.Errorf("TagCompareOptions([]typedItem) = %+v, %v", opts, err)
+	}
+}
+
+func TestTagCompareOptionsErrors(t *testing.T) {
+	type badOption struct {
+		A int `json:"a" flow:"sorted"`
+	}
+	type badTolerance struct {
+		A float64 `json:"a" flow:"tolerance=-1"`
+	}
+	type notList struct {
+		A string `json:"a" flow:"unordered"`
+	}
+	type twoKeys struct {
+		A string `json:"a" flow:"key"`
+		B string `json:"b" flow:"key"`
+	}
+	type twoKeysList struct {
+		L []twoKeys `json:"l"`
+	}
+
+	var cfgErr *ConfigError
+	for name, fn := range map[string]func() (CompareOptions, error){
+		"unknown option":   TagCompareOptions[badOption],
+		"bad tolerance":    TagCompareOptions[badTolerance],
+		"unordered scalar": TagCompareOptions[notList],
+		"two keys":         TagCompareOptions[twoKeysList],
+	} {
+		if _, err := fn(); !errors.As(err, &cfgErr) {
+			t.Errorf("%s: error = %v, want a ConfigError", name, err)
+		}
+	}
+}
+
+func TestPointOfAndAssertOf(t *testing.T) {
+	f := &recordingExecutor{}
+	order := typedOrder{ID: "ORD-1", Total: 10}
+	if err := PointOf(context.Background(), f, "Order Created", order, WithCompareOptions(IgnorePaths("$.id"))); err != nil {
+		t.Fatalf("PointOf() error = %v", err)
+	}
+	if f.point.Compare == nil || f.point.Compare.IgnorePaths[0] != "$.trace_id" || f.point.Compare.IgnorePaths[len(f.point.Compare.IgnorePaths)-1] != "$.id" {
+		t.Errorf("PointOf() compare = %+v, want tag rules before explicit ones", f.point.Compare)
+	}
+
+	if err := AssertOf(context.Background(), f, order); err != nil || f.actual.(typedOrder).ID != "ORD-1" {
+		t.Errorf("AssertOf() = %v, actual %v", err, f.actual)
+	}
+
+	// The tag rules accept what they declare.
+	opts, _ := TagCompareOptions[typedOrder]()
+	expected, _ := json.Marshal(typedOrder{ID: "1", Total: 10, Items: []typedItem{{"a", 100}, {"b", 5}}, Tags: []string{"x", "y"}})
+	actual, _ := json.Marshal(typedOrder{ID: "1", Total: 10.005, CreatedAt: time.Now(), Items: []typedItem{{"b", 5}, {"a", 100.5}}, Tags: []string{"y", "x"}})
+	if diffs, equal := DeepCompareWithOptions(expected, actual, opts); !equal {
+		t.Errorf("DeepCompareWithOptions() = %v", diffs)
+	}
+}
@@ -6,14 +6,22 @@ import (
 )
 
 type Flow struct {
-	ID         int64           `json:"id"`
-	Name       string          `json:"name"`
-	Identifier string          `json:"identifier,omitempty"`
-	Status     string          `json:"status"`
-	CreatedAt  time.Time       `json:"created_at"`
-	UpdatedAt  time.Time       `json:"updated_at"`
-	Service    string          `json:"service"`
-	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	ID         int64            `json:"id"`
+	Name       string           `json:"name"`
+	Identifier string           `json:"identifier,omitempty"`
+	Status     string           `json:"status"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	Service    string           `json:"service"`
+	Metadata   json.RawMessage  `json:"metadata,omitempty"`
+	Aliases    []FlowIdentifier `json:"aliases,omitempty"`
+}
+
+// FlowIdentifier is an alias correlation ID picked up by a flow as it moves
+// through services, e.g. {Kind: "payment_id", Value: "PAY-1"}.
+type FlowIdentifier struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
 }
 
 type Point struct {
@@ -25,6 +33,15 @@ type Point struct {
 	CreatedAt   time.Time       `json:"created_at"`
 	Schema      json.RawMessage `json:"schema,omitempty"`
 	Timeout     *time.Duration  `json:"timeout,omitempty"`
+	Compare     *CompareOptions `json:"compare,omitempty"`
+	Validator   string          `json:"validator,omitempty"`
+	Expressions []string        `json:"expressions,omitempty"`
+	// ContentType and Raw are set for payloads encoded with a codec other
+	// than JSON; Expected holds the decoded document.
+	ContentType string `json:"content_type,omitempty"`
+	Raw         []byte `json:"raw,omitempty"`
+
+	codec Codec
 }
 
 type Assertion struct {
@@ -34,13 +51,22 @@ type Assertion struct {
 	ServiceName string          `json:"service_name"`
 	CreatedAt   time.Time       `json:"created_at"`
 	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Raw         []byte          `json:"raw,omitempty"`
+
+	codec Codec
 }
 
+// FinishResult reports failing discrepancies, warnings and infos separately;
+// only failing ones make Success false.
 type FinishResult struct {
 	Success       bool          `json:"success"`
 	Discrepancies []Discrepancy `json:"discrepancies,omitempty"`
+	Warnings      []Discrepancy `json:"warnings,omitempty"`
+	Infos         []Discrepancy `json:"infos,omitempty"`
 	ExecutionTime time.Duration `json:"execution_time"`
 	ErrorCount    int           `json:"error_count"`
+	WarningCount  int           `json:"warning_count"`
 }
 
 type Discrepancy struct {
@@ -70,3 +96,31 @@ func WithTimeout(d time.Duration) PointOption {
 		p.Timeout = &d
 	}
 }
+
+// WithValidator checks this point with the validator registered under name
+// instead of DeepCompare.
+func WithValidator(name string) PointOption {
+	return func(p *Point) {
+		p.Validator = name
+	}
+}
+
+// WithExpression checks this point with expressions such as "amount > 0"
+// instead of DeepCompare. See EvaluateExpression for the syntax.
+func WithExpression(exprs ...string) PointOption {
+	return func(p *Point) {
+		p.Expressions = append(p.Expressions, exprs...)
+	}
+}
+
+// WithCompareOptions sets comparison rules for this point, on top of the
+// client and flow-name rules.
+func WithCompareOptions(opts ...CompareOption) PointOption {
+	return func(p *Point) {
+		merged := NewCompareOptions(opts...)
+		if p.Compare != nil {
+			merged = p.Compare.Merge(merged)
+		}
+		p.Compare = &merged
+	}
+}
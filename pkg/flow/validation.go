@@ -2,52 +2,24 @@ package flow
 
 import (
 	"encoding/json"
+	"strings"
 )
 
+// ValidateWithSchema compares actual with expected and, when schema is set,
+// validates actual against it. Both kinds of diffs are returned as one message.
 func ValidateWithSchema(expected, actual, schema json.RawMessage) (string, bool) {
-	var expectedVal, actualVal interface{}
+	diffs, equal := DeepCompare(expected, actual)
 
-	if err := json.Unmarshal(expected, &expectedVal); err != nil {
-		return "Invalid expected value: " + err.Error(), false
-	}
-
-	if err := json.Unmarshal(actual, &actualVal); err != nil {
-		return "Invalid actual value: " + err.Error(), false
-	}
-
-	if expectedVal != nil && actualVal != nil {
-		if err := validateTypes(expectedVal, actualVal); err != nil {
-			return "Type mismatch: " + err.Error(), false
+	if len(schema) > 0 {
+		violations, err := ValidateSchema(schema, actual)
+		if err != nil {
+			return "Invalid schema: " + strings.TrimPrefix(err.Error(), "invalid schema: "), false
 		}
+		diffs = append(diffs, violations...)
+		equal = equal && len(violations) == 0
 	}
 
-	return DeepCompareString(expected, actual)
-}
-
-func validateTypes(expected, actual interface{}) error {
-	switch expected.(type) {
-	case string:
-		if _, ok := actual.(string); !ok {
-			return &TypeError{expected: "string", actual: actual}
-		}
-	case float64:
-		if _, ok := actual.(float64); !ok {
-			return &TypeError{expected: "number", actual: actual}
-		}
-	case bool:
-		if _, ok := actual.(bool); !ok {
-			return &TypeError{expected: "boolean", actual: actual}
-		}
-	case []interface{}:
-		if _, ok := actual.([]interface{}); !ok {
-			return &TypeError{expected: "array", actual: actual}
-		}
-	case map[string]interface{}:
-		if _, ok := actual.(map[string]interface{}); !ok {
-			return &TypeError{expected: "object", actual: actual}
-		}
-	}
-	return nil
+	return FormatDiffs(diffs), equal
 }
 
 type TypeError struct {
@@ -59,10 +31,18 @@ func (e *TypeError) Error() string {
 	return "expected " + e.expected + ", got " + getTypeName(e.actual)
 }
 
+// getTypeName returns the JSON Schema type of a decoded value.
 func getTypeName(v interface{}) string {
-	switch v.(type) {
+	switch val := v.(type) {
+	case nil:
+		return "null"
 	case string:
 		return "string"
+	case json.Number:
+		if strings.ContainsAny(val.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
 	case float64:
 		return "number"
 	case bool:
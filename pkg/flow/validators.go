@@ -0,0 +1,103 @@
+package flow
+
+import "fmt"
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(expected, actual interface{}) (string, bool)
+
+func (fn ValidatorFunc) Validate(expected, actual interface{}) (string, bool) {
+	return fn(expected, actual)
+}
+
+// RegisterValidator makes v available to points created WithValidator(name).
+// Every service that finishes such flows must register the same name.
+func (c *FlowClient) RegisterValidator(name string, v Validator) error {
+	if name == "" || v == nil {
+		return &ConfigError{msg: "validator name and implementation are required"}
+	}
+	c.validatorsMu.Lock()
+	defer c.validatorsMu.Unlock()
+	if c.validators == nil {
+		c.validators = map[string]Validator{}
+	}
+	c.validators[name] = v
+	return nil
+}
+
+func (c *FlowClient) validator(name string) (Validator, bool) {
+	c.validatorsMu.RLock()
+	defer c.validatorsMu.RUnlock()
+	v, ok := c.validators[name]
+	return v, ok
+}
+
+// comparePoint checks an assertion against its point: with the point's
+// validator and expressions when set, otherwise with DeepCompare under the
+// options stored with the point. CreatePoint already merged the producer's
+// client, flow-name and point rules into them; only comparators, which are
+// never stored, come from this client. With SchemaEnabled, the assertion is
+// also validated against the point's schema. Severity rules and known
+// differences of the options apply to every diff.
+func (c *FlowClient) comparePoint(flowName string, p Point, a Assertion) []DiffEntry {
+	var compare CompareOptions
+	if p.Compare != nil {
+		compare = *p.Compare
+	}
+	compare.comparators = c.compareOptionsFor(flowName).comparators
+
+	var diffs, other []DiffEntry
+	if p.Validator != "" {
+		other = c.runValidator(p.Validator, p.Expected, a.Actual)
+	}
+	if len(p.Expressions) > 0 {
+		other = append(other, EvaluateExpressions(p.Expressions, p.Expected, a.Actual)...)
+	}
+	if p.Validator == "" && len(p.Expressions) == 0 {
+		diffs, _ = DeepCompareWithOptions(p.Expected, a.Actual, compare)
+	}
+
+	if c.Config.SchemaEnabled && len(p.Schema) > 0 {
+		violations, err := ValidateSchema(p.Schema, a.Actual)
+		if err != nil {
+			violations = []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: err.Error()}}
+		}
+		other = append(other, violations...)
+	}
+	return append(diffs, ClassifyDiffs(compare, other)...)
+}
+
+func (c *FlowClient) runValidator(name string, expectedJSON, actualJSON []byte) []DiffEntry {
+	v, ok := c.validator(name)
+	if !ok {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("validator %q is not registered", name)}}
+	}
+
+	expected, err := decodeJSON(expectedJSON)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("failed to unmarshal expected: %v", err)}}
+	}
+	actual, err := decodeJSON(actualJSON)
+	if err != nil {
+		return []DiffEntry{{Path: "$", Kind: DiffInvalid, Message: fmt.Sprintf("failed to unmarshal actual: %v", err)}}
+	}
+	if _, ok := reducedDigest(expected); ok {
+		return []DiffEntry{unverifiable("validator " + name)}
+	}
+	if _, ok := reducedDigest(actual); ok {
+		return []DiffEntry{unverifiable("validator " + name)}
+	}
+
+	if msg, ok := v.Validate(expected, actual); !ok {
+		if msg == "" {
+			msg = "validation failed"
+		}
+		return []DiffEntry{{
+			Path:     "$",
+			Kind:     DiffValidatorFailed,
+			Expected: expected,
+			Actual:   actual,
+			Message:  fmt.Sprintf("validator %s: %s", name, msg),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package flow
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// moneyValidator accepts amounts equal to the cent.
+var moneyValidator = ValidatorFunc(func(expected, actual interface{}) (string, bool) {
+	e, _ := expected.(map[string]interface{})["amount"].(json.Number)
+	a, _ := actual.(map[string]interface{})["amount"].(json.Number)
+	er, _ := new(big.Rat).SetString(e.String())
+	ar, _ := new(big.Rat).SetString(a.String())
+	if er == nil || ar == nil || er.FloatString(2) != ar.FloatString(2) {
+		return "amount " + a.String() + " != " + e.String(), false
+	}
+	return "", true
+})
+
+func TestComparePointWithValidator(t *testing.T) {
+	client, err := NewClient(nil, FlowConfig{
+		IsProduction: true,
+		Validators:   map[string]Validator{"money": moneyValidator},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		validator string
+		expected  string
+		actual    string
+		wantKind  DiffKind
+	}{
+		{"Validator passes", "money", `{"amount": 10.001}`, `{"amount": 10.004, "extra": true}`, ""},
+		{"Validator fails", "money", `{"amount": 10}`, `{"amount": 10.5}`, DiffValidatorFailed},
+		{"Unregistered validator", "tax", `{"amount": 10}`, `{"amount": 10}`, DiffInvalid},
+		{"No validator uses DeepCompare", "", `{"amount": 10}`, `{"amount": 10, "extra": true}`, DiffExtraKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Point{Expected: json.RawMessage(tt.expected), Validator: tt.validator}
+			a := Assertion{Actual: json.RawMessage(tt.actual)}
+			diffs := client.comparePoint("Order Processing", p, a)
+			if tt.wantKind == "" {
+				if len(diffs) != 0 {
+					t.Errorf("comparePoint() = %v, want no diffs", diffs)
+				}
+				return
+			}
+			if len(diffs) != 1 || diffs[0].Kind != tt.wantKind {
+				t.Errorf("comparePoint() = %v, want one %s diff", diffs, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	client, _ := NewClient(nil, FlowConfig{IsProduction: true})
+
+	if err := client.RegisterValidator("", moneyValidator); err == nil {
+		t.Error("RegisterValidator() should reject an empty name")
+	}
+	if err := client.RegisterValidator("money", nil); err == nil {
+		t.Error("RegisterValidator() should reject a nil validator")
+	}
+	if err := client.RegisterValidator("money", moneyValidator); err != nil {
+		t.Fatalf("RegisterValidator() error = %v", err)
+	}
+
+	diffs := client.runValidator("money", []byte(`{"amount": 1}`), []byte(`{"amount": 2}`))
+	if len(diffs) != 1 || !strings.Contains(diffs[0].Message, "validator money: amount 2 != 1") {
+		t.Errorf("runValidator() = %v", diffs)
+	}
+}